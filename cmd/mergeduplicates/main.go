@@ -0,0 +1,34 @@
+// Command mergeduplicates merges links whose original URLs are equal after canonicalization.
+// It is run once after canonicalization settings are changed, short links of merged duplicates keep working.
+package main
+
+import (
+	"context"
+	"github.com/magmel48/go-web/internal/config"
+	"github.com/magmel48/go-web/internal/db"
+	"github.com/magmel48/go-web/internal/shortener"
+	"log"
+)
+
+func main() {
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	config.Parse()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	database := db.SQLDB{}
+	if err := database.CreateSchema(); err != nil {
+		log.Fatalln("cannot prepare database", err)
+	}
+
+	s := shortener.NewShortener(ctx, config.BaseShortenerURL, &database)
+
+	merged, err := s.MergeDuplicateLinks(ctx)
+	if err != nil {
+		log.Fatalf("merging stopped after %d links: %v", merged, err)
+	}
+
+	log.Printf("%d duplicate links merged\n", merged)
+}
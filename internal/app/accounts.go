@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/magmel48/go-web/internal/auth"
+	"github.com/magmel48/go-web/internal/db/accounts"
+	"github.com/magmel48/go-web/internal/identity"
+	"github.com/valyala/fasthttp"
+)
+
+// credentialsAction registers or logs the user in.
+type credentialsAction func(
+	ctx context.Context, userID auth.UserID, login string, password string) (*accounts.Account, error)
+
+// CredentialsPayload represents payload of a request to /api/auth/register and /api/auth/login.
+type CredentialsPayload struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// AccountResult represents response from /api/auth/register and /api/auth/login.
+type AccountResult struct {
+	Login string `json:"login"`
+}
+
+// HandleRegisterPost handles POST on "/api/auth/register" and creates account of the current user, links made
+// before registration are kept.
+func (app App) HandleRegisterPost(ctx *fasthttp.RequestCtx) {
+	app.handleCredentials(ctx, fasthttp.StatusCreated, app.identity.Register)
+}
+
+// HandleLoginPost handles POST on "/api/auth/login" and logs the user in, links of the anonymous user
+// are given to the account.
+func (app App) HandleLoginPost(ctx *fasthttp.RequestCtx) {
+	if app.loginAttempts != nil && !app.loginAttempts.Allow(ctx.RemoteIP().String()) {
+		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusTooManyRequests), fasthttp.StatusTooManyRequests)
+		return
+	}
+
+	app.handleCredentials(ctx, fasthttp.StatusOK, app.identity.Login)
+}
+
+// HandleLogoutPost handles POST on "/api/auth/logout" and replaces session of the user with new anonymous one,
+// stored session of the user is revoked.
+func (app App) HandleLogoutPost(ctx *fasthttp.RequestCtx) {
+	if err := app.revokeCurrentSession(ctx); err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	setSessionCookie(ctx, app.authenticator, newSession(ctx, auth.NewUserID()))
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+// handleCredentials reads credentials, passes them to the action and sets session of the returned account.
+func (app App) handleCredentials(ctx *fasthttp.RequestCtx, statusCode int, action credentialsAction) {
+	userID, err := getUserID(ctx, app.authenticator)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	var payload CredentialsPayload
+
+	body := ctx.Request.Body()
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		ctx.Error("wrong payload format", fasthttp.StatusBadRequest)
+		return
+	}
+
+	account, err := action(ctx, userID, payload.Login, payload.Password)
+	if err != nil {
+		handleIdentityError(ctx, err)
+		return
+	}
+
+	response, err := json.Marshal(AccountResult{Login: account.Login})
+	if err != nil {
+		ctx.Error("json marshal error", fasthttp.StatusBadRequest)
+		return
+	}
+
+	setSessionCookie(ctx, app.authenticator, newSession(ctx, account.UserID))
+
+	ctx.SetContentType("application/json; charset=utf-8")
+	ctx.SetStatusCode(statusCode)
+	ctx.SetBody(response)
+}
+
+// handleIdentityError sets response status code according to the error of registration or login.
+func handleIdentityError(ctx *fasthttp.RequestCtx, err error) {
+	switch {
+	case errors.Is(err, identity.ErrWrongLogin), errors.Is(err, identity.ErrWeakPassword):
+		ctx.Error(err.Error(), fasthttp.StatusBadRequest)
+	case errors.Is(err, identity.ErrAccountExists):
+		ctx.Error(err.Error(), fasthttp.StatusConflict)
+	case errors.Is(err, identity.ErrWrongCredentials):
+		ctx.Error(err.Error(), fasthttp.StatusUnauthorized)
+	default:
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,150 @@
+package app
+
+import (
+	"encoding/json"
+	"github.com/magmel48/go-web/internal/db/apikeys"
+	"github.com/valyala/fasthttp"
+	routercontext "github.com/vardius/gorouter/v4/context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxAPIKeyNameLength is limit of API key names, it is the size of the database column.
+const maxAPIKeyNameLength = 255
+
+// APIKeyPayload represents payload of a request to /api/user/keys.
+type APIKeyPayload struct {
+	Name      string          `json:"name"`
+	Scopes    []apikeys.Scope `json:"scopes"`
+	ExpiresAt *time.Time      `json:"expires_at"`
+}
+
+// APIKeyResult represents response from /api/user/keys, the key is returned only once.
+type APIKeyResult struct {
+	apikeys.APIKey
+	Key string `json:"key"`
+}
+
+// HandleAPIKeysPost handles POST on "/api/user/keys" and creates new API key of the user.
+func (app App) HandleAPIKeysPost(ctx *fasthttp.RequestCtx) {
+	userID, err := getUserID(ctx, app.authenticator)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	var payload APIKeyPayload
+
+	body := ctx.Request.Body()
+	err = json.Unmarshal(body, &payload)
+	if err != nil {
+		ctx.Error("wrong payload format", fasthttp.StatusBadRequest)
+		return
+	}
+
+	payload.Name = strings.TrimSpace(payload.Name)
+	if payload.Name == "" || len(payload.Name) > maxAPIKeyNameLength {
+		ctx.Error("name is required and must be shorter than 256 characters", fasthttp.StatusBadRequest)
+		return
+	}
+
+	if err := apikeys.ValidateScopes(payload.Scopes); err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+
+	if payload.ExpiresAt != nil && !payload.ExpiresAt.After(time.Now()) {
+		ctx.Error(apikeys.ErrWrongExpiry.Error(), fasthttp.StatusBadRequest)
+		return
+	}
+
+	key, err := apikeys.NewKey()
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	created, err := app.apiKeys.Create(ctx, apikeys.APIKey{
+		UserID:    userID,
+		Name:      payload.Name,
+		Prefix:    apikeys.DisplayPrefix(key),
+		Hash:      apikeys.HashKey(key),
+		Scopes:    payload.Scopes,
+		ExpiresAt: payload.ExpiresAt,
+	})
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	response, err := json.Marshal(APIKeyResult{APIKey: *created, Key: key})
+	if err != nil {
+		ctx.Error("json marshal error", fasthttp.StatusBadRequest)
+		return
+	}
+
+	ctx.Response.Header.Set(fasthttp.HeaderCacheControl, "no-store")
+	ctx.SetContentType("application/json; charset=utf-8")
+	ctx.SetStatusCode(fasthttp.StatusCreated)
+	ctx.SetBody(response)
+}
+
+// HandleAPIKeysGet handles GET on "/api/user/keys" and returns API keys of the user without keys themselves.
+func (app App) HandleAPIKeysGet(ctx *fasthttp.RequestCtx) {
+	userID, err := getUserID(ctx, app.authenticator)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	result, err := app.apiKeys.List(ctx, userID)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if len(result) == 0 {
+		ctx.SetStatusCode(fasthttp.StatusNoContent)
+		return
+	}
+
+	response, err := json.Marshal(result)
+	if err != nil {
+		ctx.Error("json marshal error", fasthttp.StatusBadRequest)
+		return
+	}
+
+	ctx.SetContentType("application/json; charset=utf-8")
+	ctx.SetBody(response)
+}
+
+// HandleAPIKeyDelete handles DELETE on "/api/user/keys/{id}" and revokes API key of the user.
+func (app App) HandleAPIKeyDelete(ctx *fasthttp.RequestCtx) {
+	params := ctx.UserValue("params").(routercontext.Params)
+
+	userID, err := getUserID(ctx, app.authenticator)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	id, err := strconv.Atoi(params.Value("id"))
+	if err != nil {
+		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusNotFound), fasthttp.StatusNotFound)
+		return
+	}
+
+	revoked, err := app.apiKeys.Revoke(ctx, userID, id)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if !revoked {
+		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusNotFound), fasthttp.StatusNotFound)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
@@ -4,32 +4,98 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/magmel48/go-web/internal/auth"
+	"github.com/magmel48/go-web/internal/config"
 	"github.com/magmel48/go-web/internal/db"
+	"github.com/magmel48/go-web/internal/db/apikeys"
 	"github.com/magmel48/go-web/internal/db/links"
+	"github.com/magmel48/go-web/internal/db/sessions"
+	"github.com/magmel48/go-web/internal/identity"
+	"github.com/magmel48/go-web/internal/limiter"
+	"github.com/magmel48/go-web/internal/oidc"
 	"github.com/magmel48/go-web/internal/shortener"
+	"github.com/magmel48/go-web/internal/validation"
 	"github.com/valyala/fasthttp"
 	"github.com/vardius/gorouter/v4"
 	routercontext "github.com/vardius/gorouter/v4/context"
+	"html/template"
+	"net/url"
 	"os"
 	"runtime"
 	"runtime/pprof"
+	"strings"
+	"time"
+)
+
+const (
+	// variantCookieMaxAge is how long a visitor sees the same split destination of a sticky link.
+	variantCookieMaxAge = 30 * 24 * time.Hour
+
+	// passwordAttemptsLimit is how many passwords can be tried for a link from one IP during passwordAttemptsWindow.
+	passwordAttemptsLimit  = 5
+	passwordAttemptsWindow = time.Minute
+	// loginAttemptsLimit is how many logins can be tried from one IP during loginAttemptsWindow.
+	loginAttemptsLimit  = 10
+	loginAttemptsWindow = time.Minute
+
+	// errorCodeHeader is response header with the code of the rule that rejected the request.
+	errorCodeHeader = "X-Error-Code"
+
+	// deepLinkTimeout is how long the deep link page waits for the app before falling back.
+	deepLinkTimeout = 1500 * time.Millisecond
 )
 
 // App makes urls shorter.
 type App struct {
-	shortener     shortener.Shortener
-	authenticator auth.Auth
+	shortener        shortener.Shortener
+	authenticator    auth.Auth
+	apiKeys          apikeys.Repository
+	identity         identity.Service
+	oidc             *oidc.Client
+	sessions         sessions.Repository
+	passwordAttempts *limiter.Limiter
+	loginAttempts    *limiter.Limiter
 }
 
 // ShortenPayload represents payload of a request to /api/shorten.
 type ShortenPayload struct {
-	URL string `json:"url"`
+	URL          string            `json:"url"`
+	RedirectType int               `json:"redirect_type,omitempty"`
+	ForwardQuery bool              `json:"forward_query,omitempty"`
+	UTMParams    map[string]string `json:"utm_params,omitempty"`
+	Password     string            `json:"password,omitempty"`
+	MaxClicks    int               `json:"max_clicks,omitempty"`
+	Rules        []links.Rule      `json:"rules,omitempty"`
+	Split        *links.Split      `json:"split,omitempty"`
+	IsPrefix     bool              `json:"prefix,omitempty"`
+	DeepLink     *links.DeepLink   `json:"deep_link,omitempty"`
+	links.Schedule
+}
+
+// ErrorResponse is response for requests rejected by a rule, Code identifies the rule.
+type ErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
 }
 
 // ShortenResult represents response from /api/shorten.
 type ShortenResult struct {
 	Result string `json:"result"`
+	// OriginalURL is stored form of the URL with punycode host and percent-encoded path.
+	OriginalURL string `json:"original_url"`
+	// OriginalURLUnicode is the same URL readable by people.
+	OriginalURLUnicode string `json:"original_url_unicode"`
+	// Warnings tell about accepted but suspicious URLs, e.g. possible homograph attacks.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// TokenResult represents response from /api/user/token.
+type TokenResult struct {
+	Token     string `json:"token"`
+	TokenType string `json:"token_type"`
+	// ExpiresIn is lifetime of the token in seconds.
+	ExpiresIn int `json:"expires_in"`
 }
 
 // BatchPayloadElement is one element from array from payload of a request to /api/shorten/batch.
@@ -56,28 +122,82 @@ func NewApp(ctx context.Context, baseURL string) App {
 		panic(err)
 	}
 
+	var sessionStore sessions.Repository
+	switch config.SessionStore {
+	case config.SessionStorePostgres:
+		store := sessions.NewPostgresRepository(database.Instance())
+		go store.PruneUntilDone(ctx)
+		sessionStore = store
+	case config.SessionStoreMemory:
+		sessionStore = sessions.NewMemoryRepository()
+	}
+
+	if sessionStore != nil {
+		authenticator.Sessions = sessionStore
+	}
+
+	var oidcClient *oidc.Client
+	if config.OIDCIssuerURL != "" {
+		oidcClient = oidc.NewClient(oidc.Config{
+			IssuerURL:    config.OIDCIssuerURL,
+			ClientID:     config.OIDCClientID,
+			ClientSecret: config.OIDCClientSecret,
+			RedirectURL:  config.OIDCRedirectURL,
+		}, nil)
+	}
+
 	return App{
-		shortener:     shortener.NewShortener(ctx, baseURL, &database),
-		authenticator: authenticator,
+		shortener:        shortener.NewShortener(ctx, baseURL, &database),
+		authenticator:    authenticator,
+		apiKeys:          apikeys.NewPostgresRepository(database.Instance()),
+		identity:         identity.NewService(&database),
+		oidc:             oidcClient,
+		sessions:         sessionStore,
+		passwordAttempts: limiter.NewLimiter(passwordAttemptsLimit, passwordAttemptsWindow),
+		loginAttempts:    limiter.NewLimiter(loginAttemptsLimit, loginAttemptsWindow),
 	}
 }
 
 // HTTPHandler handles http requests.
 func (app App) HTTPHandler() func(ctx *fasthttp.RequestCtx) {
 	router := gorouter.NewFastHTTPRouter()
-	router.POST("/", app.HandlePost)
-	router.POST("/api/shorten", app.HandleJSONPost)
-	router.POST("/api/shorten/batch", app.HandleBatchPost)
-	router.GET("/api/user/urls", app.HandleUserGet)
+	router.POST("/", scopeHandler(apikeys.ScopeShorten, app.HandlePost))
+	router.POST("/api/shorten", scopeHandler(apikeys.ScopeShorten, app.HandleJSONPost))
+	router.POST("/api/shorten/batch", scopeHandler(apikeys.ScopeShorten, app.HandleBatchPost))
+	router.GET("/api/user/urls", scopeHandler(apikeys.ScopeRead, app.HandleUserGet))
+	router.POST("/api/auth/register", sessionOnlyHandler(app.HandleRegisterPost))
+	router.POST("/api/auth/login", sessionOnlyHandler(app.HandleLoginPost))
+	router.POST("/api/auth/logout", sessionOnlyHandler(app.HandleLogoutPost))
+	router.GET("/api/auth/oidc/login", sessionOnlyHandler(app.HandleOIDCLoginGet))
+	router.GET("/api/auth/oidc/callback", sessionOnlyHandler(app.HandleOIDCCallbackGet))
+	router.POST("/api/user/token", userOnlyHandler(app.HandleTokenPost))
+	router.POST("/api/user/keys", userOnlyHandler(app.HandleAPIKeysPost))
+	router.GET("/api/user/keys", userOnlyHandler(app.HandleAPIKeysGet))
+	router.DELETE("/api/user/keys/{id}", userOnlyHandler(app.HandleAPIKeyDelete))
+	router.GET("/api/user/sessions", userOnlyHandler(app.HandleSessionsGet))
+	router.DELETE("/api/user/sessions/{id}", userOnlyHandler(app.HandleSessionDelete))
+	router.GET("/api/user/urls/{id}/rules", scopeHandler(apikeys.ScopeStats, app.HandleRulesGet))
+	router.PUT("/api/user/urls/{id}/rules", scopeHandler(apikeys.ScopeShorten, app.HandleRulesPut))
+	router.GET("/api/user/urls/{id}/split", scopeHandler(apikeys.ScopeStats, app.HandleSplitGet))
+	router.PUT("/api/user/urls/{id}/split", scopeHandler(apikeys.ScopeShorten, app.HandleSplitPut))
+	router.GET("/api/user/urls/{id}/schedule", scopeHandler(apikeys.ScopeRead, app.HandleScheduleGet))
+	router.PUT("/api/user/urls/{id}/schedule", scopeHandler(apikeys.ScopeShorten, app.HandleSchedulePut))
+	router.PUT("/api/admin/urls/{id}/trust", adminHandler(app.HandleTrustPut))
 	router.GET("/ping", app.HandlePing)
 	router.GET("/{id}", app.HandleGet)
-	router.DELETE("/api/user/urls", app.HandleDelete)
+	router.POST("/{id}", app.HandlePasswordPost)
+	router.DELETE("/api/user/urls", scopeHandler(apikeys.ScopeDelete, app.HandleDelete))
 	router.GET("/internal/pprof", app.pprof)
-
-	return cookiesHandler(app.authenticator)(
-		decompressHandler( // only for reading request
-			fasthttp.CompressHandlerBrotliLevel( // only for writing response
-				router.HandleFastHTTP, fasthttp.CompressBrotliBestSpeed, fasthttp.CompressBestSpeed)))
+	// "/{id}" matches one path segment only, longer paths can be handled by prefix links
+	router.NotFound(app.HandlePrefix)
+
+	return corsHandler(
+		apiKeysHandler(app.apiKeys)(
+			csrfHandler(
+				cookiesHandler(app.authenticator)(
+					decompressHandler( // only for reading request
+						fasthttp.CompressHandlerBrotliLevel( // only for writing response
+							router.HandleFastHTTP, fasthttp.CompressBrotliBestSpeed, fasthttp.CompressBestSpeed))))))
 }
 
 // HandlePost handles POST on "/" route - creates new short link.
@@ -94,11 +214,19 @@ func (app App) HandlePost(ctx *fasthttp.RequestCtx) {
 	}
 
 	body := string(ctx.Request.Body())
-	shortURL, err := app.shortener.MakeShorter(ctx, body, userID)
+	shortURL, err := app.shortener.MakeShorter(ctx, body, userID, links.Options{})
 
 	if err != nil {
 		if !errors.Is(err, links.ErrConflict) {
 			ctx.Error(err.Error(), fasthttp.StatusBadRequest)
+
+			// the endpoint responds with plain text, so the code of violated rule is passed in the header only,
+			// it is set after ctx.Error that resets response headers
+			var validationErr *validation.Error
+			if errors.As(err, &validationErr) {
+				ctx.Response.Header.Set(errorCodeHeader, validationErr.Code)
+			}
+
 			return
 		}
 
@@ -128,8 +256,37 @@ func (app App) HandleJSONPost(ctx *fasthttp.RequestCtx) {
 		return
 	}
 
-	shortURL, err := app.shortener.MakeShorter(ctx, payload.URL, userID)
+	options := links.Options{
+		RedirectType: payload.RedirectType,
+		ForwardQuery: payload.ForwardQuery,
+		MaxClicks:    payload.MaxClicks,
+		Rules:        payload.Rules,
+		Split:        payload.Split,
+		IsPrefix:     payload.IsPrefix,
+		DeepLink:     payload.DeepLink,
+		Schedule:     payload.Schedule,
+	}
+	if len(payload.UTMParams) > 0 {
+		options.UTMParams = make(url.Values, len(payload.UTMParams))
+		for key, value := range payload.UTMParams {
+			options.UTMParams.Set(key, value)
+		}
+	}
+
+	if payload.Password != "" {
+		options.PasswordHash, err = shortener.HashPassword(payload.Password)
+		if err != nil {
+			ctx.Error(err.Error(), fasthttp.StatusBadRequest)
+			return
+		}
+	}
+
+	shortURL, err := app.shortener.MakeShorter(ctx, payload.URL, userID, options)
 	if err != nil {
+		if handleValidationError(ctx, err) {
+			return
+		}
+
 		if !errors.Is(err, links.ErrConflict) {
 			ctx.Error(err.Error(), fasthttp.StatusBadRequest)
 			return
@@ -144,6 +301,16 @@ func (app App) HandleJSONPost(ctx *fasthttp.RequestCtx) {
 		Result: shortURL,
 	}
 
+	if forms, err := app.shortener.URLForms(payload.URL); err == nil {
+		result.OriginalURL = forms.ASCII
+		result.OriginalURLUnicode = forms.Unicode
+
+		for _, label := range forms.MixedScriptLabels {
+			result.Warnings = append(
+				result.Warnings, fmt.Sprintf("host label %q mixes letters of different scripts", label))
+		}
+	}
+
 	response, err := json.Marshal(result)
 	if err != nil {
 		ctx.Error("json marshal error", fasthttp.StatusBadRequest)
@@ -172,7 +339,11 @@ func (app App) HandleBatchPost(ctx *fasthttp.RequestCtx) {
 
 	shortURLs, err := app.shortener.MakeShorterBatch(ctx, originalURLs)
 	if err != nil {
-		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		if !handleValidationError(ctx, err) {
+			ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		}
+
+		return
 	}
 
 	result := make([]BatchResultElement, len(payload))
@@ -191,24 +362,101 @@ func (app App) HandleBatchPost(ctx *fasthttp.RequestCtx) {
 	ctx.SetBody(response)
 }
 
-// HandleGet handles GET on "/api/user/urls" and returns original link from specified identifier.
+// HandleGet handles GET on "/{id}" and redirects to original link from specified identifier.
 func (app App) HandleGet(ctx *fasthttp.RequestCtx) {
 	params := ctx.UserValue("params").(routercontext.Params)
-	id := params.Value("id")
 
-	initialURL, err := app.shortener.RestoreLong(ctx, id)
+	app.redirect(ctx, redirectRequest(ctx, params.Value("id")))
+}
+
+// HandlePasswordPost handles POST on "/{id}" from the password form of protected link
+// and redirects to original link if the password is correct.
+func (app App) HandlePasswordPost(ctx *fasthttp.RequestCtx) {
+	params := ctx.UserValue("params").(routercontext.Params)
+
+	app.redirectWithPassword(ctx, redirectRequest(ctx, params.Value("id")))
+}
+
+// HandlePrefix handles requests on "/{id}/rest/of/path" that are not matched by any route
+// and redirects them through the prefix link with the rest of path appended to its destination.
+func (app App) HandlePrefix(ctx *fasthttp.RequestCtx) {
+	id, rest := splitPrefixPath(string(ctx.Path()))
+	if id == "" || rest == "" {
+		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusNotFound), fasthttp.StatusNotFound)
+		return
+	}
+
+	request := redirectRequest(ctx, id)
+	request.Path = rest
+
+	switch {
+	case ctx.IsGet():
+		app.redirect(ctx, request)
+	case ctx.IsPost():
+		app.redirectWithPassword(ctx, request)
+	default:
+		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusNotFound), fasthttp.StatusNotFound)
+	}
+}
+
+// redirect writes redirect response for the request to the short link.
+func (app App) redirect(ctx *fasthttp.RequestCtx, request shortener.RedirectRequest) {
+	id := request.ShortID
+
+	redirect, err := app.shortener.Resolve(ctx, request)
 	if err != nil {
-		if errors.Is(err, shortener.ErrDeleted) {
-			ctx.SetStatusCode(fasthttp.StatusGone)
-			return
-		}
+		handleResolveError(ctx, err)
+		return
+	}
 
-		ctx.Error("initial version of the link is not found", fasthttp.StatusBadRequest)
+	setVariantCookie(ctx, id, redirect)
+	if redirect.Untrusted {
+		renderPage(ctx, interstitialPage, interstitialPageData{URL: redirect.URL}, fasthttp.StatusOK)
+		return
+	}
+
+	if redirect.AppURL != "" {
+		renderDeepLinkPage(ctx, redirect)
+		return
+	}
+
+	ctx.Response.Header.Set("Location", redirect.URL)
+	ctx.Response.Header.Set("Cache-Control", redirectCacheControl(redirect))
+	ctx.SetStatusCode(redirect.StatusCode)
+}
+
+// redirectWithPassword writes redirect response for the password form submission of protected link.
+func (app App) redirectWithPassword(ctx *fasthttp.RequestCtx, request shortener.RedirectRequest) {
+	id := request.ShortID
+
+	if app.passwordAttempts != nil && !app.passwordAttempts.Allow(id+"|"+ctx.RemoteIP().String()) {
+		ctx.Error("too many attempts, try again later", fasthttp.StatusTooManyRequests)
+		return
+	}
+
+	request.Password = string(ctx.PostArgs().Peek("password"))
+
+	redirect, err := app.shortener.Resolve(ctx, request)
+	if err != nil {
+		handleResolveError(ctx, err)
+		return
+	}
+
+	setVariantCookie(ctx, id, redirect)
+	if redirect.Untrusted {
+		renderPage(ctx, interstitialPage, interstitialPageData{URL: redirect.URL}, fasthttp.StatusOK)
 		return
 	}
 
-	ctx.Response.Header.Set("Location", initialURL)
-	ctx.SetStatusCode(fasthttp.StatusTemporaryRedirect)
+	if redirect.AppURL != "" {
+		renderDeepLinkPage(ctx, redirect)
+		return
+	}
+
+	// redirect after the form submission must turn POST into GET regardless of the link redirect type
+	ctx.Response.Header.Set("Location", redirect.URL)
+	ctx.Response.Header.Set("Cache-Control", "no-store")
+	ctx.SetStatusCode(fasthttp.StatusSeeOther)
 }
 
 // HandleUserGet handles GET on "/api/user/urls" and returns all links from the user.
@@ -239,6 +487,231 @@ func (app App) HandleUserGet(ctx *fasthttp.RequestCtx) {
 	}
 }
 
+// HandleRulesGet handles GET on "/api/user/urls/{id}/rules" and returns redirect rules of the user link.
+func (app App) HandleRulesGet(ctx *fasthttp.RequestCtx) {
+	params := ctx.UserValue("params").(routercontext.Params)
+	id := params.Value("id")
+
+	userID, err := getUserID(ctx, app.authenticator)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	result, err := app.shortener.GetRules(ctx, userID, id)
+	if err != nil {
+		handleUserLinkError(ctx, err)
+		return
+	}
+
+	response, err := json.Marshal(result)
+	if err != nil {
+		ctx.Error("json marshal error", fasthttp.StatusBadRequest)
+		return
+	}
+
+	ctx.SetContentType("application/json; charset=utf-8")
+	ctx.SetBody(response)
+}
+
+// HandleRulesPut handles PUT on "/api/user/urls/{id}/rules" and replaces redirect rules of the user link.
+func (app App) HandleRulesPut(ctx *fasthttp.RequestCtx) {
+	params := ctx.UserValue("params").(routercontext.Params)
+	id := params.Value("id")
+
+	var payload []links.Rule
+
+	body := ctx.Request.Body()
+	err := json.Unmarshal(body, &payload)
+	if err != nil {
+		ctx.Error("wrong payload format", fasthttp.StatusBadRequest)
+		return
+	}
+
+	userID, err := getUserID(ctx, app.authenticator)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if err := app.shortener.UpdateRules(ctx, userID, id, payload); err != nil {
+		handleUserLinkError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+// HandleSplitGet handles GET on "/api/user/urls/{id}/split" and returns split destinations of the user link
+// with clicks made by every destination.
+func (app App) HandleSplitGet(ctx *fasthttp.RequestCtx) {
+	params := ctx.UserValue("params").(routercontext.Params)
+	id := params.Value("id")
+
+	userID, err := getUserID(ctx, app.authenticator)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	result, err := app.shortener.GetSplit(ctx, userID, id)
+	if err != nil {
+		handleUserLinkError(ctx, err)
+		return
+	}
+
+	response, err := json.Marshal(result)
+	if err != nil {
+		ctx.Error("json marshal error", fasthttp.StatusBadRequest)
+		return
+	}
+
+	ctx.SetContentType("application/json; charset=utf-8")
+	ctx.SetBody(response)
+}
+
+// HandleSplitPut handles PUT on "/api/user/urls/{id}/split" and replaces split destinations of the user link.
+func (app App) HandleSplitPut(ctx *fasthttp.RequestCtx) {
+	params := ctx.UserValue("params").(routercontext.Params)
+	id := params.Value("id")
+
+	var payload links.Split
+
+	body := ctx.Request.Body()
+	err := json.Unmarshal(body, &payload)
+	if err != nil {
+		ctx.Error("wrong payload format", fasthttp.StatusBadRequest)
+		return
+	}
+
+	userID, err := getUserID(ctx, app.authenticator)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if err := app.shortener.UpdateSplit(ctx, userID, id, &payload); err != nil {
+		handleUserLinkError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+// HandleScheduleGet handles GET on "/api/user/urls/{id}/schedule" and returns activation window of the user link.
+func (app App) HandleScheduleGet(ctx *fasthttp.RequestCtx) {
+	params := ctx.UserValue("params").(routercontext.Params)
+	id := params.Value("id")
+
+	userID, err := getUserID(ctx, app.authenticator)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	result, err := app.shortener.GetSchedule(ctx, userID, id)
+	if err != nil {
+		handleUserLinkError(ctx, err)
+		return
+	}
+
+	response, err := json.Marshal(result)
+	if err != nil {
+		ctx.Error("json marshal error", fasthttp.StatusBadRequest)
+		return
+	}
+
+	ctx.SetContentType("application/json; charset=utf-8")
+	ctx.SetBody(response)
+}
+
+// HandleSchedulePut handles PUT on "/api/user/urls/{id}/schedule" and replaces activation window of the user link.
+func (app App) HandleSchedulePut(ctx *fasthttp.RequestCtx) {
+	params := ctx.UserValue("params").(routercontext.Params)
+	id := params.Value("id")
+
+	var payload links.Schedule
+
+	body := ctx.Request.Body()
+	err := json.Unmarshal(body, &payload)
+	if err != nil {
+		ctx.Error("wrong payload format", fasthttp.StatusBadRequest)
+		return
+	}
+
+	userID, err := getUserID(ctx, app.authenticator)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if err := app.shortener.UpdateSchedule(ctx, userID, id, payload); err != nil {
+		handleUserLinkError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+// TrustPayload is request payload of "/api/admin/urls/{id}/trust".
+type TrustPayload struct {
+	Trust links.Trust `json:"trust"`
+}
+
+// HandleTrustPut handles PUT on "/api/admin/urls/{id}/trust" and replaces trust policy decision for the link.
+func (app App) HandleTrustPut(ctx *fasthttp.RequestCtx) {
+	params := ctx.UserValue("params").(routercontext.Params)
+	id := params.Value("id")
+
+	var payload TrustPayload
+
+	body := ctx.Request.Body()
+	err := json.Unmarshal(body, &payload)
+	if err != nil {
+		ctx.Error("wrong payload format", fasthttp.StatusBadRequest)
+		return
+	}
+
+	if err := app.shortener.SetTrustOverride(ctx, id, payload.Trust); err != nil {
+		handleUserLinkError(ctx, err)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+// HandleTokenPost handles POST on "/api/user/token" and returns bearer token of the current user, so scripts
+// can act as the user without cookies.
+func (app App) HandleTokenPost(ctx *fasthttp.RequestCtx) {
+	userID, err := getUserID(ctx, app.authenticator)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	// the token gets its own session, so it can be revoked without logging the user out
+	token, err := app.authenticator.EncodeSession(ctx, newSession(ctx, userID))
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	response, err := json.Marshal(TokenResult{
+		Token:     string(token),
+		TokenType: "Bearer",
+		ExpiresIn: int(config.SessionTTL.Seconds()),
+	})
+	if err != nil {
+		ctx.Error("json marshal error", fasthttp.StatusBadRequest)
+		return
+	}
+
+	ctx.Response.Header.Set(fasthttp.HeaderCacheControl, "no-store")
+	ctx.SetContentType("application/json; charset=utf-8")
+	ctx.SetStatusCode(fasthttp.StatusCreated)
+	ctx.SetBody(response)
+}
+
 // HandlePing handles GET on "/ping" and checks database availability.
 func (app App) HandlePing(ctx *fasthttp.RequestCtx) {
 	if !app.shortener.IsStorageAvailable(ctx) {
@@ -267,6 +740,150 @@ func (app App) HandleDelete(ctx *fasthttp.RequestCtx) {
 	ctx.SetStatusCode(fasthttp.StatusAccepted)
 }
 
+// redirectRequest collects everything about a request to the short link that can affect the redirect.
+func redirectRequest(ctx *fasthttp.RequestCtx, id string) shortener.RedirectRequest {
+	request := shortener.RedirectRequest{
+		ShortID:        id,
+		Query:          string(ctx.URI().QueryString()),
+		UserAgent:      string(ctx.UserAgent()),
+		AcceptLanguage: string(ctx.Request.Header.Peek("Accept-Language")),
+	}
+
+	if config.CountryHeader != "" {
+		request.Country = string(ctx.Request.Header.Peek(config.CountryHeader))
+	}
+
+	request.Variant = string(ctx.Request.Header.Cookie(variantCookieName(id)))
+
+	return request
+}
+
+// renderDeepLinkPage writes the page that tries to open the app and falls back to redirect URL.
+func renderDeepLinkPage(ctx *fasthttp.RequestCtx, redirect *shortener.Redirect) {
+	data := deepLinkPageData{
+		// app url is validated on link creation, so its custom scheme is trusted
+		AppURL:      template.URL(redirect.AppURL),
+		FallbackURL: redirect.URL,
+		TimeoutMs:   int(deepLinkTimeout.Milliseconds()),
+	}
+
+	renderPage(ctx, deepLinkPage, data, fasthttp.StatusOK)
+}
+
+// splitPrefixPath splits request path into short identifier and the rest of path,
+// e.g. "/docs/guides/intro" into "docs" and "/guides/intro".
+func splitPrefixPath(requestPath string) (string, string) {
+	requestPath = strings.TrimPrefix(requestPath, "/")
+
+	i := strings.Index(requestPath, "/")
+	if i < 0 {
+		return requestPath, ""
+	}
+
+	return requestPath[:i], requestPath[i:]
+}
+
+// variantCookieName returns name of the cookie that pins split destination of the link for a visitor.
+func variantCookieName(id string) string {
+	return "variant_" + id
+}
+
+// setVariantCookie pins picked split destination for the visitor if the link is sticky.
+func setVariantCookie(ctx *fasthttp.RequestCtx, id string, redirect *shortener.Redirect) {
+	if !redirect.StickyVariant {
+		return
+	}
+
+	cookie := fasthttp.Cookie{}
+	cookie.SetKey(variantCookieName(id))
+	cookie.SetValue(redirect.Variant)
+	cookie.SetPath("/" + id)
+	cookie.SetMaxAge(int(variantCookieMaxAge.Seconds()))
+	cookie.SetHTTPOnly(true)
+
+	ctx.Response.Header.SetCookie(&cookie)
+}
+
+// handleValidationError writes response with the code of violated rule for rejected link destination.
+// It returns false and writes nothing if err is not a validation error.
+func handleValidationError(ctx *fasthttp.RequestCtx, err error) bool {
+	var validationErr *validation.Error
+	if !errors.As(err, &validationErr) {
+		return false
+	}
+
+	response, marshalErr := json.Marshal(ErrorResponse{Error: err.Error(), Code: validationErr.Code})
+	if marshalErr != nil {
+		ctx.Error("json marshal error", fasthttp.StatusBadRequest)
+		return true
+	}
+
+	ctx.Response.Header.Set(errorCodeHeader, validationErr.Code)
+	ctx.SetContentType("application/json; charset=utf-8")
+	ctx.SetStatusCode(fasthttp.StatusBadRequest)
+	ctx.SetBody(response)
+
+	return true
+}
+
+// handleUserLinkError writes response for a failed operation on the user link.
+func handleUserLinkError(ctx *fasthttp.RequestCtx, err error) {
+	if handleValidationError(ctx, err) {
+		return
+	}
+
+	switch {
+	case errors.Is(err, shortener.ErrNotFound), errors.Is(err, shortener.ErrDeleted):
+		ctx.Error(err.Error(), fasthttp.StatusNotFound)
+	case errors.Is(err, shortener.ErrNotOwner):
+		ctx.Error(err.Error(), fasthttp.StatusForbidden)
+	case errors.Is(err, shortener.ErrWrongRule),
+		errors.Is(err, shortener.ErrWrongSplit),
+		errors.Is(err, shortener.ErrWrongSchedule),
+		errors.Is(err, shortener.ErrWrongTrust):
+		ctx.Error(err.Error(), fasthttp.StatusBadRequest)
+	default:
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+	}
+}
+
+// handleResolveError writes response for a short link that cannot be resolved into redirect.
+func handleResolveError(ctx *fasthttp.RequestCtx, err error) {
+	switch {
+	case errors.Is(err, shortener.ErrDeleted):
+		ctx.SetStatusCode(fasthttp.StatusGone)
+	case errors.Is(err, shortener.ErrExpired):
+		ctx.Error(err.Error(), fasthttp.StatusGone)
+	case errors.Is(err, shortener.ErrNotActiveYet):
+		ctx.Error(err.Error(), fasthttp.StatusNotFound)
+	case errors.Is(err, shortener.ErrBlocked):
+		ctx.Error(shortener.ErrBlocked.Error(), fasthttp.StatusForbidden)
+	case errors.Is(err, shortener.ErrPasswordRequired):
+		renderPage(ctx, passwordPage, passwordPageData{}, fasthttp.StatusOK)
+	case errors.Is(err, shortener.ErrWrongPassword):
+		renderPage(ctx, passwordPage, passwordPageData{Error: "Wrong password"}, fasthttp.StatusForbidden)
+	default:
+		ctx.Error("initial version of the link is not found", fasthttp.StatusBadRequest)
+	}
+}
+
+// redirectCacheControl returns Cache-Control header value suitable for specified redirect.
+// Permanent redirects can be cached by browsers for a short time unless the link leads to different places,
+// so blocked or changed links stop working soon, temporary ones must be requested every time.
+// Shared caches never keep redirects, responses may carry cookies of the user.
+func redirectCacheControl(redirect *shortener.Redirect) string {
+	if !redirect.Cacheable {
+		return "private, no-cache, no-store, must-revalidate"
+	}
+
+	switch redirect.StatusCode {
+	case fasthttp.StatusMovedPermanently, fasthttp.StatusPermanentRedirect:
+		return "private, max-age=300"
+	default:
+		return "private, no-cache, no-store, must-revalidate"
+	}
+}
+
 // pprof is using for internal purposes to retrieve current CPU and memory profiles.
 func (app App) pprof(ctx *fasthttp.RequestCtx) {
 	// CPU first
@@ -4,20 +4,33 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/magmel48/go-web/internal/auth"
 	authmocks "github.com/magmel48/go-web/internal/auth/mocks"
+	"github.com/magmel48/go-web/internal/config"
+	"github.com/magmel48/go-web/internal/db/apikeys"
+	apikeysmocks "github.com/magmel48/go-web/internal/db/apikeys/mocks"
 	dbmocks "github.com/magmel48/go-web/internal/db/mocks"
+	"github.com/magmel48/go-web/internal/db/sessions"
+	"github.com/magmel48/go-web/internal/identity"
+	"github.com/magmel48/go-web/internal/limiter"
+	"github.com/magmel48/go-web/internal/oidc"
+	"github.com/magmel48/go-web/internal/oidc/oidctest"
 	"github.com/magmel48/go-web/internal/shortener"
+	"github.com/magmel48/go-web/internal/validation"
 	"github.com/rs/zerolog/log"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/valyala/fasthttp"
 	"github.com/valyala/fasthttp/fasthttputil"
+	"golang.org/x/crypto/bcrypt"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"regexp"
+	"strings"
 	"testing"
 	"time"
 )
@@ -45,6 +58,13 @@ func serve(handler fasthttp.RequestHandler, req *fasthttp.Request, res *fasthttp
 	return client.Do(req, res)
 }
 
+// userSession matches sessions of the user.
+func userSession(userID string) interface{} {
+	return mock.MatchedBy(func(session *auth.Session) bool {
+		return session != nil && session.UserID != nil && *session.UserID == userID
+	})
+}
+
 func acquireRequest(method string, url string, body string, headers map[string]string) *fasthttp.Request {
 	request := fasthttp.AcquireRequest()
 	request.Header.SetMethod(method)
@@ -77,8 +97,8 @@ func TestApp_handlePost(t *testing.T) {
 	}
 
 	mockAuth := &authmocks.Auth{}
-	mockAuth.On("Decode", mock.Anything).Return(nil, nil)
-	mockAuth.On("Encode", mock.Anything).Return(nil)
+	mockAuth.On("DecodeSession", mock.Anything, mock.Anything).Return(nil, nil)
+	mockAuth.On("EncodeSession", mock.Anything, mock.Anything).Return(nil)
 
 	mockDB := &dbmocks.DB{}
 	mockDB.On("CreateSchema").Return(nil)
@@ -87,7 +107,7 @@ func TestApp_handlePost(t *testing.T) {
 	mockDB.On("Instance").Return(db)
 
 	sqlMock.ExpectQuery(`INSERT INTO "links"`).WillReturnRows(
-		sqlmock.NewRows([]string{"id", "short_id"}).AddRow(1, "1"))
+		sqlmock.NewRows([]string{"id", "short_id", "redirect_type"}).AddRow(1, "1", 0))
 
 	malformedURLInBodyRequest := acquireRequest(
 		fasthttp.MethodPost, "http://localhost:8080", "test", emptyHeaders)
@@ -169,8 +189,8 @@ func TestApp_handleJSONPost(t *testing.T) {
 	}
 
 	mockAuth := &authmocks.Auth{}
-	mockAuth.On("Decode", mock.Anything).Return(nil, nil)
-	mockAuth.On("Encode", mock.Anything).Return(nil)
+	mockAuth.On("DecodeSession", mock.Anything, mock.Anything).Return(nil, nil)
+	mockAuth.On("EncodeSession", mock.Anything, mock.Anything).Return(nil)
 
 	mockDB := &dbmocks.DB{}
 	mockDB.On("CreateSchema").Return(nil)
@@ -179,7 +199,7 @@ func TestApp_handleJSONPost(t *testing.T) {
 	mockDB.On("Instance").Return(db)
 
 	sqlMock.ExpectQuery(`INSERT INTO "links"`).WillReturnRows(
-		sqlmock.NewRows([]string{"id", "short_id"}).AddRow(1, "1"))
+		sqlmock.NewRows([]string{"id", "short_id", "redirect_type"}).AddRow(1, "1", 0))
 
 	headers := make(map[string]string)
 	headers["Content-Type"] = "application/json"
@@ -226,7 +246,11 @@ func TestApp_handleJSONPost(t *testing.T) {
 			want: want{
 				contentType: "application/json; charset=utf-8",
 				statusCode:  fasthttp.StatusCreated,
-				result:      ShortenResult{Result: "http://localhost:8080/1"},
+				result: ShortenResult{
+					Result:             "http://localhost:8080/1",
+					OriginalURL:        "https://google.com/",
+					OriginalURLUnicode: "https://google.com/",
+				},
 			},
 		},
 	}
@@ -275,8 +299,8 @@ func TestApp_handleBatchPost(t *testing.T) {
 	}
 
 	mockAuth := &authmocks.Auth{}
-	mockAuth.On("Decode", mock.Anything).Return(nil, nil)
-	mockAuth.On("Encode", mock.Anything).Return(nil)
+	mockAuth.On("DecodeSession", mock.Anything, mock.Anything).Return(nil, nil)
+	mockAuth.On("EncodeSession", mock.Anything, mock.Anything).Return(nil)
 
 	mockDB := &dbmocks.DB{}
 	mockDB.On("CreateSchema").Return(nil)
@@ -286,11 +310,11 @@ func TestApp_handleBatchPost(t *testing.T) {
 
 	sqlMock.ExpectBegin().WillReturnError(nil)
 	sqlMock.ExpectPrepare(
-		regexp.QuoteMeta(`INSERT INTO "links" ("short_id", "original_url") VALUES($1, $2) RETURNING "id", "short_id"`))
+		regexp.QuoteMeta(`INSERT INTO "links" ("short_id", "original_url", "original_url_hash") VALUES($1, $2, $3)`))
 	sqlMock.ExpectPrepare(
-		regexp.QuoteMeta(`SELECT "id", "short_id" FROM "links" WHERE "original_url" = $1 LIMIT 1`))
+		regexp.QuoteMeta(`SELECT "id", "short_id" FROM "links" WHERE "original_url_hash" = $1 AND "is_plain" AND "is_deleted" IS NOT TRUE LIMIT 1`))
 	selectPrepare := sqlMock.ExpectPrepare(
-		regexp.QuoteMeta(`SELECT "id", "short_id" FROM "links" WHERE "original_url" = $1 LIMIT 1`))
+		regexp.QuoteMeta(`SELECT "id", "short_id" FROM "links" WHERE "original_url_hash" = $1 AND "is_plain" AND "is_deleted" IS NOT TRUE LIMIT 1`))
 
 	selectPrepare.ExpectQuery().WillReturnRows(sqlmock.NewRows([]string{"id", "short_id"}).AddRow(1, "1"))
 	sqlMock.ExpectCommit()
@@ -361,8 +385,8 @@ func TestApp_handleGet(t *testing.T) {
 	}
 
 	mockAuth := &authmocks.Auth{}
-	mockAuth.On("Decode", mock.Anything).Return(nil, nil)
-	mockAuth.On("Encode", mock.Anything).Return(nil)
+	mockAuth.On("DecodeSession", mock.Anything, mock.Anything).Return(nil, nil)
+	mockAuth.On("EncodeSession", mock.Anything, mock.Anything).Return(nil)
 
 	mockDB := &dbmocks.DB{}
 	mockDB.On("CreateSchema").Return(nil)
@@ -414,6 +438,176 @@ func TestApp_handleGet(t *testing.T) {
 	}
 }
 
+func TestApp_handlePasswordPost(t *testing.T) {
+	type fields struct {
+		shortener        shortener.Shortener
+		authenticator    auth.Auth
+		passwordAttempts *limiter.Limiter
+	}
+	type args struct {
+		w *fasthttp.Response
+		r *fasthttp.Request
+	}
+	type want struct {
+		statusCode int
+	}
+
+	headers := make(map[string]string)
+	headers["Content-Type"] = "application/x-www-form-urlencoded"
+
+	request := acquireRequest(fasthttp.MethodPost, "http://localhost:8080/1", "password=secret", headers)
+
+	mockAuth := &authmocks.Auth{}
+	mockAuth.On("DecodeSession", mock.Anything, mock.Anything).Return(nil, nil)
+	mockAuth.On("EncodeSession", mock.Anything, mock.Anything).Return(nil)
+
+	mockDB := &dbmocks.DB{}
+	mockDB.On("CreateSchema").Return(nil)
+	mockDB.On("Instance").Return(nil)
+
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   want
+	}{
+		{
+			name: "should restrict password attempts",
+			fields: fields{
+				shortener:        shortener.NewShortener(context.TODO(), "http://localhost:8080", mockDB),
+				authenticator:    mockAuth,
+				passwordAttempts: limiter.NewLimiter(0, time.Minute),
+			},
+			args: args{
+				w: fasthttp.AcquireResponse(),
+				r: request,
+			},
+			want: want{
+				statusCode: fasthttp.StatusTooManyRequests,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := App{
+				shortener:        tt.fields.shortener,
+				authenticator:    tt.fields.authenticator,
+				passwordAttempts: tt.fields.passwordAttempts,
+			}
+
+			err := serve(app.HTTPHandler(), tt.args.r, tt.args.w)
+			assert.NoError(t, err, "POST request error")
+
+			assert.Equal(t, tt.want.statusCode, tt.args.w.StatusCode())
+		})
+	}
+}
+
+func Test_redirectCacheControl(t *testing.T) {
+	tests := []struct {
+		name     string
+		redirect shortener.Redirect
+		want     string
+	}{
+		{
+			name:     "should cache permanent redirect in browser only",
+			redirect: shortener.Redirect{StatusCode: fasthttp.StatusMovedPermanently, Cacheable: true},
+			want:     "private, max-age=300",
+		},
+		{
+			name:     "should not cache permanent redirect leading to different places",
+			redirect: shortener.Redirect{StatusCode: fasthttp.StatusPermanentRedirect},
+			want:     "private, no-cache, no-store, must-revalidate",
+		},
+		{
+			name:     "should not cache temporary redirect",
+			redirect: shortener.Redirect{StatusCode: fasthttp.StatusTemporaryRedirect, Cacheable: true},
+			want:     "private, no-cache, no-store, must-revalidate",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, redirectCacheControl(&tt.redirect))
+		})
+	}
+}
+
+func Test_splitPrefixPath(t *testing.T) {
+	tests := []struct {
+		path     string
+		wantID   string
+		wantRest string
+	}{
+		{path: "/docs/guides/intro", wantID: "docs", wantRest: "/guides/intro"},
+		{path: "/docs/", wantID: "docs", wantRest: "/"},
+		{path: "/docs", wantID: "docs", wantRest: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			id, rest := splitPrefixPath(tt.path)
+			assert.Equal(t, tt.wantID, id)
+			assert.Equal(t, tt.wantRest, rest)
+		})
+	}
+}
+
+func TestApp_handleRulesPut_notOwner(t *testing.T) {
+	userID := "user_b"
+	mockAuth := &authmocks.Auth{}
+	mockAuth.On("DecodeSession", mock.Anything, mock.Anything).Return(&auth.Session{UserID: &userID}, nil)
+
+	mockDB := &dbmocks.DB{}
+	db, sqlMock, _ := sqlmock.New()
+	mockDB.On("Instance").Return(db)
+
+	// user B shortens the URL shortened by user A before and gets the link of user A
+	sqlMock.ExpectQuery(regexp.QuoteMeta(`SELECT (SELECT COUNT(*) FROM "links")`)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	sqlMock.ExpectQuery(`INSERT INTO "links"`).
+		WithArgs("2", "https://example.com/", 0, false, "", "", 0, "[]", nil, nil, nil, "", false, nil,
+			sqlmock.AnyArg(), true, userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "short_id", "redirect_type"}).AddRow(1, "1", 0))
+	sqlMock.ExpectQuery(`SELECT "id", "user_id", "link_id" FROM "user_links"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "link_id"}))
+	sqlMock.ExpectExec(`INSERT INTO "user_links"`).WillReturnResult(sqlmock.NewResult(1, 1))
+
+	// the link of user A is still theirs
+	sqlMock.ExpectQuery(`SELECT (.+) FROM "links"`).WithArgs("1").WillReturnRows(
+		sqlmock.NewRows([]string{
+			"id", "short_id", "original_url", "is_deleted", "redirect_type", "forward_query", "utm_params",
+			"password_hash", "max_clicks", "rules", "split", "active_from", "active_until", "placeholder_url",
+			"is_prefix", "deep_link", "created_at", "trust_override", "owner_id",
+		}).AddRow(
+			1, "1", "https://example.com/", false, 0, false, "", "", 0, []byte("[]"), nil, nil, nil, "",
+			false, nil, time.Now(), "", "user_a"))
+
+	app := App{
+		shortener:     shortener.NewShortener(context.TODO(), "http://localhost:8080", mockDB),
+		authenticator: mockAuth,
+	}
+
+	response := fasthttp.AcquireResponse()
+	err := serve(app.HTTPHandler(), acquireRequest(
+		fasthttp.MethodPost, "http://localhost:8080", "https://example.com", emptyHeaders), response)
+	assert.NoError(t, err)
+	assert.Equal(t, fasthttp.StatusConflict, response.StatusCode())
+	assert.Equal(t, "http://localhost:8080/1", string(response.Body()))
+
+	response = fasthttp.AcquireResponse()
+	err = serve(app.HTTPHandler(), acquireRequest(
+		fasthttp.MethodPut,
+		"http://localhost:8080/api/user/urls/1/rules",
+		`[{"name":"all","url":"https://evil.example.com"}]`,
+		emptyHeaders), response)
+	assert.NoError(t, err)
+	assert.Equal(t, fasthttp.StatusForbidden, response.StatusCode())
+
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
 func TestApp_handleUserGet(t *testing.T) {
 	type fields struct {
 		shortener     shortener.Shortener
@@ -434,7 +628,7 @@ func TestApp_handleUserGet(t *testing.T) {
 	userID := "user_id_1"
 
 	mockAuth := &authmocks.Auth{}
-	mockAuth.On("Decode", mock.Anything).Return(&userID, nil)
+	mockAuth.On("DecodeSession", mock.Anything, mock.Anything).Return(&auth.Session{UserID: &userID}, nil)
 
 	mockDB := &dbmocks.DB{}
 	mockDB.On("CreateSchema").Return(nil)
@@ -444,7 +638,9 @@ func TestApp_handleUserGet(t *testing.T) {
 
 	sqlMock.ExpectQuery(
 		`SELECT l."short_id", l."original_url" FROM "user_links"`).WillReturnRows(
-		sqlmock.NewRows([]string{"short_id", "original_url"}).AddRow("1", "https://google.com"))
+		sqlmock.NewRows([]string{"short_id", "original_url"}).
+			AddRow("1", "https://google.com").
+			AddRow("2", "https://xn--e1afmkfd.xn--p1ai/%D0%BF%D1%83%D1%82%D1%8C"))
 
 	tests := []struct {
 		name   string
@@ -465,7 +661,11 @@ func TestApp_handleUserGet(t *testing.T) {
 			want: want{
 				contentType: "application/json; charset=utf-8",
 				statusCode:  fasthttp.StatusOK,
-				result:      `[{"original_url":"https://google.com", "short_url":"http://localhost:8080/1"}]`,
+				result: `[
+					{"original_url":"https://google.com", "display_url":"https://google.com",
+						"short_url":"http://localhost:8080/1"},
+					{"original_url":"https://xn--e1afmkfd.xn--p1ai/%D0%BF%D1%83%D1%82%D1%8C",
+						"display_url":"https://пример.рф/путь", "short_url":"http://localhost:8080/2"}]`,
 			},
 		},
 	}
@@ -561,8 +761,8 @@ func TestApp_handleDelete(t *testing.T) {
 		fasthttp.MethodDelete, "http://localhost:8080/api/user/urls", `["1"]`, emptyHeaders)
 
 	mockAuth := &authmocks.Auth{}
-	mockAuth.On("Decode", mock.Anything).Return(nil, nil)
-	mockAuth.On("Encode", mock.Anything).Return(nil)
+	mockAuth.On("DecodeSession", mock.Anything, mock.Anything).Return(nil, nil)
+	mockAuth.On("EncodeSession", mock.Anything, mock.Anything).Return(nil)
 
 	mockDB := &dbmocks.DB{}
 	mockDB.On("CreateSchema").Return(nil)
@@ -858,3 +1058,727 @@ func ExampleApp_HandleDelete() {
 
 	log.Print("successful response", string(res))
 }
+
+func Test_renderDeepLinkPage(t *testing.T) {
+	ctx := &fasthttp.RequestCtx{}
+	renderDeepLinkPage(ctx, &shortener.Redirect{URL: "https://example.com/?a=1&b=</script>", AppURL: "myapp://home"})
+
+	body := string(ctx.Response.Body())
+	assert.Equal(t, fasthttp.StatusOK, ctx.Response.StatusCode())
+	assert.Contains(t, body, `href="myapp://home"`)
+	assert.Contains(t, body, `window.location.href = "myapp://home"`)
+	assert.NotContains(t, body, "b=</script>")
+}
+
+func Test_adminHandler(t *testing.T) {
+	defer func() { config.AdminToken = "" }()
+
+	handler := adminHandler(func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(fasthttp.StatusNoContent)
+	})
+
+	tests := []struct {
+		name       string
+		adminToken string
+		token      string
+		want       int
+	}{
+		{name: "should hide admin endpoints without admin token", adminToken: "", token: "", want: 404},
+		{name: "should reject wrong token", adminToken: "admin", token: "user", want: 403},
+		{name: "should accept admin token", adminToken: "admin", token: "admin", want: 204},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.AdminToken = tt.adminToken
+
+			ctx := &fasthttp.RequestCtx{}
+			ctx.Request.Header.Set("X-Admin-Token", tt.token)
+			handler(ctx)
+
+			assert.Equal(t, tt.want, ctx.Response.StatusCode())
+		})
+	}
+}
+
+func Test_handleValidationError(t *testing.T) {
+	ctx := &fasthttp.RequestCtx{}
+	err := fmt.Errorf("rule %q: %w", "ios", &validation.Error{Code: validation.CodeSelfLoop, Reason: "loop"})
+
+	assert.True(t, handleValidationError(ctx, err))
+	assert.Equal(t, fasthttp.StatusBadRequest, ctx.Response.StatusCode())
+	assert.Equal(t, validation.CodeSelfLoop, string(ctx.Response.Header.Peek(errorCodeHeader)))
+	assert.JSONEq(t, `{"error":"rule \"ios\": loop","code":"self_loop"}`, string(ctx.Response.Body()))
+
+	assert.False(t, handleValidationError(&fasthttp.RequestCtx{}, errors.New("other")))
+}
+
+func Test_cookiesHandler(t *testing.T) {
+	userID := "26d1ac21-57d5-43ba-b2f7-08d36310aa07"
+
+	tests := []struct {
+		name       string
+		cookie     string
+		decodeErr  error
+		wantCookie string
+	}{
+		{name: "should keep valid cookie", cookie: "v1.1.valid", decodeErr: nil, wantCookie: ""},
+		{name: "should encode again cookie of old key", cookie: "v1.0.old", decodeErr: auth.ErrOldKey, wantCookie: "v1.1.new"},
+		{name: "should renew expiring cookie", cookie: "v1.1.old", decodeErr: auth.ErrExpiring, wantCookie: "v1.1.new"},
+	}
+
+	defer func() { config.SessionTTL, config.CookieSecure, config.CookieSameSite = 0, false, "" }()
+	config.SessionTTL, config.CookieSecure, config.CookieSameSite = time.Hour, true, config.SameSiteStrict
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAuth := &authmocks.Auth{}
+			mockAuth.On("DecodeSession", mock.Anything, []byte(tt.cookie)).Return(&auth.Session{UserID: &userID}, tt.decodeErr)
+			mockAuth.On("EncodeSession", mock.Anything, userSession(userID)).Return([]byte("v1.1.new"), nil)
+
+			var gotUserID auth.UserID
+			handler := cookiesHandler(mockAuth)(func(ctx *fasthttp.RequestCtx) {
+				gotUserID, _ = getUserID(ctx, mockAuth)
+			})
+
+			ctx := &fasthttp.RequestCtx{}
+			ctx.Request.Header.SetCookie("session", tt.cookie)
+			mockAuth.On("DecodeSession", mock.Anything, []byte("v1.1.new")).Return(&auth.Session{UserID: &userID}, nil)
+			handler(ctx)
+
+			cookie := fasthttp.Cookie{}
+			cookie.SetKey("session")
+			ctx.Response.Header.Cookie(&cookie)
+
+			assert.Equal(t, tt.wantCookie, string(cookie.Value()))
+			assert.Equal(t, userID, *gotUserID)
+
+			if tt.wantCookie != "" {
+				assert.Equal(t, 3600, cookie.MaxAge())
+				assert.True(t, cookie.Secure())
+				assert.True(t, cookie.HTTPOnly())
+				assert.Equal(t, fasthttp.CookieSameSiteStrictMode, cookie.SameSite())
+			}
+		})
+	}
+}
+
+func Test_cookiesHandler_noUser(t *testing.T) {
+	mockAuth := &authmocks.Auth{}
+
+	handler := cookiesHandler(mockAuth)(func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(fasthttp.StatusTemporaryRedirect)
+	})
+
+	ctx := &fasthttp.RequestCtx{}
+	handler(ctx)
+
+	assert.Equal(t, fasthttp.StatusTemporaryRedirect, ctx.Response.StatusCode())
+	assert.Empty(t, ctx.Response.Header.Peek(fasthttp.HeaderSetCookie))
+	mockAuth.AssertNotCalled(t, "DecodeSession", mock.Anything, mock.Anything)
+	mockAuth.AssertNotCalled(t, "EncodeSession", mock.Anything, mock.Anything)
+}
+
+func Test_cookiesHandler_bearer(t *testing.T) {
+	userID := "26d1ac21-57d5-43ba-b2f7-08d36310aa07"
+
+	tests := []struct {
+		name       string
+		header     string
+		decodeErr  error
+		wantStatus int
+	}{
+		{name: "should accept valid token", header: "Bearer v2.1.token", decodeErr: nil, wantStatus: 204},
+		{name: "should accept token expiring soon", header: "bearer v2.1.token", decodeErr: auth.ErrExpiring, wantStatus: 204},
+		{name: "should reject wrong token", header: "Bearer v2.1.token", decodeErr: auth.ErrExpired, wantStatus: 401},
+		{name: "should reject token without session", header: "Bearer v2.1.token", decodeErr: auth.ErrNoSession, wantStatus: 401},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockAuth := &authmocks.Auth{}
+			mockAuth.On("DecodeSession", mock.Anything, []byte("v2.1.token")).Return(&auth.Session{UserID: &userID}, tt.decodeErr)
+
+			handler := cookiesHandler(mockAuth)(func(ctx *fasthttp.RequestCtx) {
+				ctx.SetStatusCode(fasthttp.StatusNoContent)
+			})
+
+			ctx := &fasthttp.RequestCtx{}
+			ctx.Request.Header.Set(fasthttp.HeaderAuthorization, tt.header)
+			ctx.Request.Header.SetCookie("session", "v2.1.cookie")
+			handler(ctx)
+
+			assert.Equal(t, tt.wantStatus, ctx.Response.StatusCode())
+			assert.Empty(t, ctx.Response.Header.Peek(fasthttp.HeaderSetCookie))
+			mockAuth.AssertNotCalled(t, "EncodeSession", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestApp_handleTokenPost(t *testing.T) {
+	userID := "26d1ac21-57d5-43ba-b2f7-08d36310aa07"
+
+	mockAuth := &authmocks.Auth{}
+	mockAuth.On("DecodeSession", mock.Anything, []byte("v2.1.cookie")).Return(&auth.Session{UserID: &userID}, nil)
+	mockAuth.On("EncodeSession", mock.Anything, userSession(userID)).Return([]byte("v2.1.token"), nil)
+
+	defer func() { config.SessionTTL = 0 }()
+	config.SessionTTL = time.Hour
+
+	app := App{authenticator: mockAuth}
+
+	request := acquireRequest(fasthttp.MethodPost, "http://localhost:8080/api/user/token", "", nil)
+	request.Header.SetCookie("session", "v2.1.cookie")
+	response := fasthttp.AcquireResponse()
+
+	err := serve(app.HTTPHandler(), request, response)
+	assert.NoError(t, err, "POST request error")
+
+	assert.Equal(t, fasthttp.StatusCreated, response.StatusCode())
+	assert.JSONEq(t, `{"token":"v2.1.token","token_type":"Bearer","expires_in":3600}`, string(response.Body()))
+}
+
+func Test_apiKeysHandler(t *testing.T) {
+	userID := "26d1ac21-57d5-43ba-b2f7-08d36310aa07"
+	expiredAt := time.Now().Add(-time.Hour)
+	readKey := &apikeys.APIKey{ID: 1, UserID: &userID, Scopes: []apikeys.Scope{apikeys.ScopeRead}}
+	expiredKey := &apikeys.APIKey{ID: 2, UserID: &userID, Scopes: apikeys.Scopes, ExpiresAt: &expiredAt}
+
+	mockAPIKeys := &apikeysmocks.Repository{}
+	mockAPIKeys.On("FindByHash", mock.Anything, apikeys.HashKey("gwk_read")).Return(readKey, nil)
+	mockAPIKeys.On("FindByHash", mock.Anything, apikeys.HashKey("gwk_expired")).Return(expiredKey, nil)
+	mockAPIKeys.On("FindByHash", mock.Anything, apikeys.HashKey("gwk_revoked")).Return(nil, nil)
+
+	mockAuth := &authmocks.Auth{}
+
+	tests := []struct {
+		name    string
+		token   string
+		handler fasthttp.RequestHandler
+		want    int
+	}{
+		{name: "should accept key with scope", token: "gwk_read", want: 204},
+		{name: "should reject key without scope", token: "gwk_read", want: 403},
+		{name: "should reject key for user only endpoint", token: "gwk_read", want: 403},
+		{name: "should reject expired key", token: "gwk_expired", want: 401},
+		{name: "should reject revoked key", token: "gwk_revoked", want: 401},
+	}
+
+	endpoint := func(ctx *fasthttp.RequestCtx) {
+		got, err := getUserID(ctx, mockAuth)
+		assert.NoError(t, err)
+		assert.Equal(t, userID, *got)
+		ctx.SetStatusCode(fasthttp.StatusNoContent)
+	}
+	tests[0].handler = scopeHandler(apikeys.ScopeRead, endpoint)
+	tests[1].handler = scopeHandler(apikeys.ScopeDelete, endpoint)
+	tests[2].handler = userOnlyHandler(endpoint)
+	tests[3].handler = endpoint
+	tests[4].handler = endpoint
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := apiKeysHandler(mockAPIKeys)(cookiesHandler(mockAuth)(tt.handler))
+
+			ctx := &fasthttp.RequestCtx{}
+			ctx.Request.Header.Set(fasthttp.HeaderAuthorization, "Bearer "+tt.token)
+			handler(ctx)
+
+			assert.Equal(t, tt.want, ctx.Response.StatusCode())
+			assert.Empty(t, ctx.Response.Header.Peek(fasthttp.HeaderSetCookie))
+		})
+	}
+
+	mockAuth.AssertNotCalled(t, "DecodeSession", mock.Anything, mock.Anything)
+}
+
+func TestApp_handleAPIKeysPost(t *testing.T) {
+	userID := "26d1ac21-57d5-43ba-b2f7-08d36310aa07"
+	createdAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mockAuth := &authmocks.Auth{}
+	mockAuth.On("DecodeSession", mock.Anything, []byte("v2.1.cookie")).Return(&auth.Session{UserID: &userID}, nil)
+
+	mockAPIKeys := &apikeysmocks.Repository{}
+	mockAPIKeys.On("Create", mock.Anything, mock.MatchedBy(func(key apikeys.APIKey) bool {
+		return *key.UserID == userID && key.Name == "ci" && apikeys.IsKey(key.Prefix) && len(key.Hash) > 0
+	})).Return(func(_ context.Context, key apikeys.APIKey) *apikeys.APIKey {
+		key.ID, key.CreatedAt = 1, createdAt
+		return &key
+	}, nil)
+
+	app := App{authenticator: mockAuth, apiKeys: mockAPIKeys}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "should create key", body: `{"name":"ci","scopes":["shorten","read"]}`, want: 201},
+		{name: "should reject key without name", body: `{"name":" ","scopes":["read"]}`, want: 400},
+		{name: "should reject unknown scope", body: `{"name":"ci","scopes":["admin"]}`, want: 400},
+		{
+			name: "should reject expired key",
+			body: `{"name":"ci","scopes":["read"],"expires_at":"2020-01-01T00:00:00Z"}`,
+			want: 400,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := acquireRequest(fasthttp.MethodPost, "http://localhost:8080/api/user/keys", tt.body, emptyHeaders)
+			request.Header.SetCookie("session", "v2.1.cookie")
+			response := fasthttp.AcquireResponse()
+
+			err := serve(app.HTTPHandler(), request, response)
+			assert.NoError(t, err, "POST request error")
+			assert.Equal(t, tt.want, response.StatusCode())
+
+			if tt.want == fasthttp.StatusCreated {
+				var result APIKeyResult
+				assert.NoError(t, json.Unmarshal(response.Body(), &result))
+				assert.True(t, apikeys.IsKey(result.Key))
+				assert.Equal(t, apikeys.DisplayPrefix(result.Key), result.Prefix)
+				assert.Equal(t, []apikeys.Scope{apikeys.ScopeShorten, apikeys.ScopeRead}, result.Scopes)
+				assert.NotContains(t, string(response.Body()), "hash")
+			}
+		})
+	}
+}
+
+func TestApp_handleLoginPost(t *testing.T) {
+	anonymousID := "anonymous_user_id"
+	accountUserID := "account_user_id"
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+
+	mockAuth := &authmocks.Auth{}
+	mockAuth.On("DecodeSession", mock.Anything, []byte("anonymous")).Return(&auth.Session{UserID: &anonymousID}, nil)
+	mockAuth.On("EncodeSession", mock.Anything, userSession(accountUserID)).Return([]byte("account"), nil)
+
+	db, sqlMock, _ := sqlmock.New()
+	mockDB := &dbmocks.DB{}
+	mockDB.On("Instance").Return(db)
+
+	columns := []string{"id", "user_id", "login", "password_hash", "issuer", "subject", "created_at"}
+	sqlMock.ExpectQuery(`SELECT (.+) FROM "accounts" WHERE "login" = \$1`).WithArgs("alice").WillReturnRows(
+		sqlmock.NewRows(columns).AddRow(1, accountUserID, "alice", string(hash), "", "", time.Now()))
+	sqlMock.ExpectQuery(`SELECT (.+) FROM "accounts" WHERE "user_id" = \$1`).WithArgs(anonymousID).WillReturnRows(
+		sqlmock.NewRows(columns))
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec(`UPDATE "user_links"`).WithArgs(anonymousID, accountUserID).WillReturnResult(
+		sqlmock.NewResult(0, 2))
+	sqlMock.ExpectExec(`DELETE FROM "user_links"`).WithArgs(anonymousID).WillReturnResult(sqlmock.NewResult(0, 0))
+	sqlMock.ExpectExec(`UPDATE "links" SET "owner_id"`).WillReturnResult(sqlmock.NewResult(0, 0))
+	sqlMock.ExpectCommit()
+
+	app := App{authenticator: mockAuth, identity: identity.NewService(mockDB)}
+
+	request := acquireRequest(
+		fasthttp.MethodPost,
+		"http://localhost:8080/api/auth/login",
+		`{"login":"Alice","password":"correct horse"}`,
+		emptyHeaders)
+	request.Header.SetCookie("session", "anonymous")
+	response := fasthttp.AcquireResponse()
+
+	err := serve(app.HTTPHandler(), request, response)
+	assert.NoError(t, err, "POST request error")
+
+	assert.Equal(t, fasthttp.StatusOK, response.StatusCode())
+	assert.JSONEq(t, `{"login":"alice"}`, string(response.Body()))
+
+	cookie := fasthttp.Cookie{}
+	cookie.SetKey("session")
+	response.Header.Cookie(&cookie)
+	assert.Equal(t, "account", string(cookie.Value()))
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestApp_handleLoginPost_wrongPassword(t *testing.T) {
+	anonymousID := "anonymous_user_id"
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+
+	mockAuth := &authmocks.Auth{}
+	mockAuth.On("DecodeSession", mock.Anything, []byte("anonymous")).Return(&auth.Session{UserID: &anonymousID}, nil)
+
+	db, sqlMock, _ := sqlmock.New()
+	mockDB := &dbmocks.DB{}
+	mockDB.On("Instance").Return(db)
+
+	sqlMock.ExpectQuery(`SELECT (.+) FROM "accounts" WHERE "login" = \$1`).WithArgs("alice").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "user_id", "login", "password_hash", "issuer", "subject", "created_at"}).
+			AddRow(1, "account_user_id", "alice", string(hash), "", "", time.Now()))
+
+	app := App{authenticator: mockAuth, identity: identity.NewService(mockDB)}
+
+	request := acquireRequest(
+		fasthttp.MethodPost,
+		"http://localhost:8080/api/auth/login",
+		`{"login":"alice","password":"wrong horse"}`,
+		emptyHeaders)
+	request.Header.SetCookie("session", "anonymous")
+	response := fasthttp.AcquireResponse()
+
+	err := serve(app.HTTPHandler(), request, response)
+	assert.NoError(t, err, "POST request error")
+
+	assert.Equal(t, fasthttp.StatusUnauthorized, response.StatusCode())
+	assert.Empty(t, response.Header.Peek(fasthttp.HeaderSetCookie))
+	mockAuth.AssertNotCalled(t, "EncodeSession", mock.Anything, mock.Anything)
+}
+
+func TestApp_handleOIDCLogin(t *testing.T) {
+	anonymousID := "anonymous_user_id"
+
+	provider, server, err := oidctest.NewServer("go-web", "client secret")
+	assert.NoError(t, err)
+	defer server.Close()
+
+	provider.Subject = "alice"
+
+	mockAuth := &authmocks.Auth{}
+	mockAuth.On("DecodeSession", mock.Anything, []byte("anonymous")).Return(&auth.Session{UserID: &anonymousID}, nil)
+	mockAuth.On("EncodeSession", mock.Anything, userSession(anonymousID)).Return([]byte("account"), nil)
+
+	db, sqlMock, _ := sqlmock.New()
+	mockDB := &dbmocks.DB{}
+	mockDB.On("Instance").Return(db)
+
+	columns := []string{"id", "user_id", "login", "password_hash", "issuer", "subject", "created_at"}
+	sqlMock.ExpectQuery(`SELECT (.+) FROM "accounts" WHERE "issuer" = \$1 AND "subject" = \$2`).
+		WithArgs(server.URL, "alice").WillReturnRows(sqlmock.NewRows(columns))
+	sqlMock.ExpectQuery(`SELECT (.+) FROM "accounts" WHERE "user_id" = \$1`).WithArgs(anonymousID).WillReturnRows(
+		sqlmock.NewRows(columns))
+	sqlMock.ExpectQuery(`INSERT INTO "accounts"`).WithArgs(anonymousID, "", "", server.URL, "alice").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+
+	app := App{
+		authenticator: mockAuth,
+		identity:      identity.NewService(mockDB),
+		oidc: oidc.NewClient(oidc.Config{
+			IssuerURL:    server.URL,
+			ClientID:     "go-web",
+			ClientSecret: "client secret",
+			RedirectURL:  "http://localhost:8080/api/auth/oidc/callback",
+		}, nil),
+	}
+
+	request := acquireRequest(fasthttp.MethodGet, "http://localhost:8080/api/auth/oidc/login", "", emptyHeaders)
+	request.Header.SetCookie("session", "anonymous")
+	response := fasthttp.AcquireResponse()
+
+	err = serve(app.HTTPHandler(), request, response)
+	assert.NoError(t, err, "GET request error")
+	assert.Equal(t, fasthttp.StatusFound, response.StatusCode())
+
+	flow := fasthttp.Cookie{}
+	flow.SetKey(oidcFlowCookie)
+	assert.True(t, response.Header.Cookie(&flow))
+
+	// the fake provider logs the user in and redirects back at once
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	providerResponse, err := client.Get(string(response.Header.Peek(fasthttp.HeaderLocation)))
+	assert.NoError(t, err)
+	_ = providerResponse.Body.Close()
+
+	callbackURL := providerResponse.Header.Get("Location")
+	assert.True(t, strings.HasPrefix(callbackURL, "http://localhost:8080/api/auth/oidc/callback?"))
+
+	request = acquireRequest(fasthttp.MethodGet, callbackURL, "", emptyHeaders)
+	request.Header.SetCookie("session", "anonymous")
+	request.Header.SetCookie(oidcFlowCookie, string(flow.Value()))
+	response = fasthttp.AcquireResponse()
+
+	err = serve(app.HTTPHandler(), request, response)
+	assert.NoError(t, err, "GET request error")
+	assert.Equal(t, fasthttp.StatusFound, response.StatusCode())
+	assert.Equal(t, "http://localhost:8080/", string(response.Header.Peek(fasthttp.HeaderLocation)))
+
+	cookie := fasthttp.Cookie{}
+	cookie.SetKey("session")
+	response.Header.Cookie(&cookie)
+	assert.Equal(t, "account", string(cookie.Value()))
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
+
+	// the flow cannot be used again
+	request = acquireRequest(fasthttp.MethodGet, callbackURL, "", emptyHeaders)
+	request.Header.SetCookie("session", "anonymous")
+	response = fasthttp.AcquireResponse()
+
+	err = serve(app.HTTPHandler(), request, response)
+	assert.NoError(t, err, "GET request error")
+	assert.Equal(t, fasthttp.StatusBadRequest, response.StatusCode())
+}
+
+func TestApp_sessions(t *testing.T) {
+	authenticator, err := auth.NewCustomAuth()
+	assert.NoError(t, err)
+
+	store := sessions.NewMemoryRepository()
+	authenticator.Sessions = store
+
+	app := App{authenticator: authenticator, sessions: store}
+	handler := app.HTTPHandler()
+
+	do := func(method string, url string, cookie string, token string) *fasthttp.Response {
+		request := acquireRequest(method, url, "", map[string]string{fasthttp.HeaderUserAgent: "test agent"})
+		if cookie != "" {
+			request.Header.SetCookie("session", cookie)
+		}
+
+		if token != "" {
+			request.Header.Set(fasthttp.HeaderAuthorization, "Bearer "+token)
+		}
+
+		response := fasthttp.AcquireResponse()
+		assert.NoError(t, serve(handler, request, response))
+
+		return response
+	}
+
+	sessionCookie := func(response *fasthttp.Response) string {
+		cookie := fasthttp.Cookie{}
+		cookie.SetKey("session")
+		response.Header.Cookie(&cookie)
+
+		return string(cookie.Value())
+	}
+
+	response := do(fasthttp.MethodPost, "http://localhost:8080/api/user/token", "", "")
+	assert.Equal(t, fasthttp.StatusCreated, response.StatusCode())
+
+	cookie := sessionCookie(response)
+	var token TokenResult
+	assert.NoError(t, json.Unmarshal(response.Body(), &token))
+
+	response = do(fasthttp.MethodGet, "http://localhost:8080/api/user/sessions", cookie, "")
+	assert.Equal(t, fasthttp.StatusOK, response.StatusCode())
+
+	var list []SessionResult
+	assert.NoError(t, json.Unmarshal(response.Body(), &list))
+	assert.Len(t, list, 2)
+
+	var tokenSessionID string
+	for _, session := range list {
+		assert.Equal(t, "test agent", session.UserAgent)
+		if !session.Current {
+			tokenSessionID = session.ID
+		}
+	}
+
+	assert.NotEmpty(t, tokenSessionID)
+
+	response = do(fasthttp.MethodGet, "http://localhost:8080/api/user/sessions", "", token.Token)
+	assert.Equal(t, fasthttp.StatusOK, response.StatusCode())
+
+	response = do(fasthttp.MethodDelete, "http://localhost:8080/api/user/sessions/"+tokenSessionID, cookie, "")
+	assert.Equal(t, fasthttp.StatusNoContent, response.StatusCode())
+
+	response = do(fasthttp.MethodGet, "http://localhost:8080/api/user/sessions", "", token.Token)
+	assert.Equal(t, fasthttp.StatusUnauthorized, response.StatusCode())
+
+	response = do(fasthttp.MethodPost, "http://localhost:8080/api/auth/logout", cookie, "")
+	assert.Equal(t, fasthttp.StatusNoContent, response.StatusCode())
+
+	// the cookie of the revoked session is replaced with new anonymous one
+	response = do(fasthttp.MethodGet, "http://localhost:8080/api/user/sessions", cookie, "")
+	assert.Equal(t, fasthttp.StatusOK, response.StatusCode())
+	assert.NotEmpty(t, sessionCookie(response))
+	assert.NotEqual(t, cookie, sessionCookie(response))
+
+	assert.NoError(t, json.Unmarshal(response.Body(), &list))
+	assert.Len(t, list, 1)
+	assert.True(t, list[0].Current)
+}
+
+func Test_csrfHandler(t *testing.T) {
+	defer func() {
+		config.BaseShortenerURL, config.CSRFTrustedOrigins = "", nil
+		config.CORSAllowedOrigins, config.CORSAllowCredentials = nil, false
+	}()
+	config.BaseShortenerURL = "https://sho.rt"
+	config.CSRFTrustedOrigins = []string{"https://app.example.com"}
+	config.CORSAllowedOrigins = []string{"https://spa.example.com"}
+	config.CORSAllowCredentials = true
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		cookie  bool
+		want    int
+	}{
+		{name: "should let safe request through", method: fasthttp.MethodGet, cookie: true, headers: map[string]string{"Origin": "https://evil.example.com"}, want: 204},
+		{name: "should let request without cookie through", method: fasthttp.MethodPost, headers: map[string]string{"Origin": "https://evil.example.com"}, want: 204},
+		{name: "should let bearer request through", method: fasthttp.MethodPost, cookie: true, headers: map[string]string{"Origin": "https://evil.example.com", "Authorization": "Bearer token"}, want: 204},
+		{name: "should let request without browser headers through", method: fasthttp.MethodPost, cookie: true, want: 204},
+		{name: "should accept same origin fetch", method: fasthttp.MethodDelete, cookie: true, headers: map[string]string{"Sec-Fetch-Site": "same-origin"}, want: 204},
+		{name: "should accept origin of request host", method: fasthttp.MethodPost, cookie: true, headers: map[string]string{"Origin": "http://localhost:8080"}, want: 204},
+		{name: "should accept origin of base url", method: fasthttp.MethodPost, cookie: true, headers: map[string]string{"Origin": "https://SHO.RT"}, want: 204},
+		{name: "should accept trusted origin", method: fasthttp.MethodPost, cookie: true, headers: map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://app.example.com"}, want: 204},
+		{name: "should accept origin allowed to use cookies by CORS", method: fasthttp.MethodPut, cookie: true, headers: map[string]string{"Origin": "https://spa.example.com"}, want: 204},
+		{name: "should accept referer of the service", method: fasthttp.MethodPost, cookie: true, headers: map[string]string{"Referer": "https://sho.rt/page"}, want: 204},
+		{name: "should reject other origin", method: fasthttp.MethodPost, cookie: true, headers: map[string]string{"Origin": "https://evil.example.com"}, want: 403},
+		{name: "should reject null origin", method: fasthttp.MethodDelete, cookie: true, headers: map[string]string{"Origin": "null"}, want: 403},
+		{name: "should reject other referer", method: fasthttp.MethodPost, cookie: true, headers: map[string]string{"Referer": "https://evil.example.com/"}, want: 403},
+		{name: "should reject cross site fetch without origin", method: fasthttp.MethodPost, cookie: true, headers: map[string]string{"Sec-Fetch-Site": "cross-site"}, want: 403},
+	}
+
+	handler := csrfHandler(func(ctx *fasthttp.RequestCtx) {
+		ctx.SetStatusCode(fasthttp.StatusNoContent)
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := &fasthttp.RequestCtx{}
+			ctx.Request.Header.SetMethod(tt.method)
+			ctx.Request.SetRequestURI("http://localhost:8080/api/shorten")
+			for k, v := range tt.headers {
+				ctx.Request.Header.Set(k, v)
+			}
+
+			if tt.cookie {
+				ctx.Request.Header.SetCookie("session", "v2.1.cookie")
+			}
+
+			handler(ctx)
+
+			assert.Equal(t, tt.want, ctx.Response.StatusCode())
+			if tt.want == fasthttp.StatusForbidden {
+				assert.Equal(t, csrfErrorCode, string(ctx.Response.Header.Peek(errorCodeHeader)))
+			}
+		})
+	}
+}
+
+func Test_corsHandler(t *testing.T) {
+	defer func() {
+		config.CORSAllowedOrigins, config.CORSAllowedMethods, config.CORSAllowedHeaders = nil, nil, nil
+		config.CORSAllowCredentials, config.CORSMaxAge = false, 0
+	}()
+	config.CORSAllowedMethods = []string{"GET", "POST"}
+	config.CORSAllowedHeaders = []string{"content-type", "authorization"}
+	config.CORSMaxAge = 10 * time.Minute
+
+	tests := []struct {
+		name        string
+		origins     []string
+		credentials bool
+		method      string
+		headers     map[string]string
+		wantCode    int
+		wantHandled bool
+		wantOrigin  string
+		wantHeaders map[string]string
+	}{
+		{
+			name:        "should not answer without allowed origins",
+			method:      fasthttp.MethodOptions,
+			headers:     map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "POST"},
+			wantCode:    400,
+			wantHandled: true,
+		},
+		{
+			name:       "should answer preflight of allowed origin",
+			origins:    []string{"https://app.example.com"},
+			method:     fasthttp.MethodOptions,
+			headers:    map[string]string{"Origin": "https://App.Example.com", "Access-Control-Request-Method": "POST"},
+			wantCode:   204,
+			wantOrigin: "https://app.example.com",
+			wantHeaders: map[string]string{
+				"Access-Control-Allow-Methods": "GET, POST",
+				"Access-Control-Allow-Headers": "content-type, authorization",
+				"Access-Control-Max-Age":       "600",
+			},
+		},
+		{
+			name:        "should allow credentials of allowed origin",
+			origins:     []string{"https://app.example.com"},
+			credentials: true,
+			method:      fasthttp.MethodOptions,
+			headers:     map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "DELETE"},
+			wantCode:    204,
+			wantOrigin:  "https://app.example.com",
+			wantHeaders: map[string]string{"Access-Control-Allow-Credentials": "true"},
+		},
+		{
+			name:     "should reject preflight of other origin",
+			origins:  []string{"https://app.example.com"},
+			method:   fasthttp.MethodOptions,
+			headers:  map[string]string{"Origin": "https://evil.example.com", "Access-Control-Request-Method": "POST"},
+			wantCode: 403,
+		},
+		{
+			name:        "should route options without requested method",
+			origins:     []string{"https://app.example.com"},
+			method:      fasthttp.MethodOptions,
+			headers:     map[string]string{"Origin": "https://app.example.com"},
+			wantCode:    400,
+			wantHandled: true,
+			wantOrigin:  "https://app.example.com",
+		},
+		{
+			name:        "should keep headers of rejected request",
+			origins:     []string{"https://app.example.com"},
+			method:      fasthttp.MethodPost,
+			headers:     map[string]string{"Origin": "https://app.example.com"},
+			wantCode:    400,
+			wantHandled: true,
+			wantOrigin:  "https://app.example.com",
+			wantHeaders: map[string]string{"Access-Control-Expose-Headers": errorCodeHeader},
+		},
+		{
+			name:        "should allow any origin",
+			origins:     []string{config.CORSAnyOrigin},
+			method:      fasthttp.MethodGet,
+			headers:     map[string]string{"Origin": "https://other.example.com"},
+			wantCode:    400,
+			wantHandled: true,
+			wantOrigin:  "*",
+		},
+		{
+			name:        "should not allow other origin",
+			origins:     []string{"https://app.example.com"},
+			method:      fasthttp.MethodGet,
+			headers:     map[string]string{"Origin": "https://evil.example.com"},
+			wantCode:    400,
+			wantHandled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.CORSAllowedOrigins = tt.origins
+			config.CORSAllowCredentials = tt.credentials
+
+			handled := false
+			handler := corsHandler(func(ctx *fasthttp.RequestCtx) {
+				handled = true
+				ctx.Error("rejected", fasthttp.StatusBadRequest)
+			})
+
+			ctx := &fasthttp.RequestCtx{}
+			ctx.Request.Header.SetMethod(tt.method)
+			ctx.Request.SetRequestURI("http://localhost:8080/api/shorten")
+			for k, v := range tt.headers {
+				ctx.Request.Header.Set(k, v)
+			}
+
+			handler(ctx)
+
+			assert.Equal(t, tt.wantCode, ctx.Response.StatusCode())
+			assert.Equal(t, tt.wantHandled, handled)
+			assert.Equal(t, tt.wantOrigin, string(ctx.Response.Header.Peek("Access-Control-Allow-Origin")))
+			for k, v := range tt.wantHeaders {
+				assert.Equal(t, v, string(ctx.Response.Header.Peek(k)), k)
+			}
+
+			if len(tt.origins) > 0 {
+				assert.Contains(t, string(ctx.Response.Header.Peek("Vary")), "Origin")
+			}
+		})
+	}
+}
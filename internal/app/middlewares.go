@@ -1,9 +1,19 @@
 package app
 
 import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
 	"github.com/magmel48/go-web/internal/auth"
+	"github.com/magmel48/go-web/internal/config"
+	"github.com/magmel48/go-web/internal/db/apikeys"
 	"github.com/valyala/fasthttp"
 	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // decompressHandler reads compressed request payload and decodes it.
@@ -25,41 +35,400 @@ func decompressHandler(h fasthttp.RequestHandler) fasthttp.RequestHandler {
 	}
 }
 
-// cookiesHandler sets and validates proper cookies.
+// apiKeyUserValue is name of request user value with API key the request is authenticated by.
+const apiKeyUserValue = "apiKey"
+
+// csrfErrorCode is X-Error-Code of requests rejected by csrfHandler.
+const csrfErrorCode = "csrf"
+
+// sessionUserValue is name of request user value with session from the session cookie.
+const sessionUserValue = "session"
+
+// bearerPrefix starts Authorization header of requests authenticated by token.
+const bearerPrefix = "Bearer "
+
+// sameSiteModes are cookie modes by config values.
+var sameSiteModes = map[string]fasthttp.CookieSameSite{
+	config.SameSiteLax:    fasthttp.CookieSameSiteLaxMode,
+	config.SameSiteStrict: fasthttp.CookieSameSiteStrictMode,
+	config.SameSiteNone:   fasthttp.CookieSameSiteNoneMode,
+}
+
+// cookiesHandler rejects requests with bearer token that is not valid. Session cookies are checked, encoded again
+// and issued by getSession when the handler needs the user, so requests that do not (e.g. redirects) neither
+// store sessions nor get cookies.
 func cookiesHandler(authenticator auth.Auth) func(h fasthttp.RequestHandler) fasthttp.RequestHandler {
 	return func(h fasthttp.RequestHandler) fasthttp.RequestHandler {
 		return func(ctx *fasthttp.RequestCtx) {
-			if authenticator != nil {
-				_, err := getUserID(ctx, authenticator)
+			if authenticator == nil {
+				h(ctx)
+				return
+			}
 
-				// sets cookie if it's not valid (empty or wrong encoded)
-				if err != nil {
-					log.Println("user session invalidation error", err)
+			if _, ok := bearerToken(ctx); ok {
+				if requestAPIKey(ctx) != nil {
+					h(ctx)
+					return
+				}
 
-					userID := auth.NewUserID()
-					userToken, _ := authenticator.Encode(userID)
+				if _, err := getUserID(ctx, authenticator); err != nil {
+					unauthorized(ctx)
+					return
+				}
 
-					cookie := fasthttp.Cookie{}
-					cookie.SetKey("session")
-					cookie.SetValue(string(userToken))
-					cookie.SetPath("/")
-					cookie.SetHTTPOnly(true)
+				h(ctx)
+				return
+			}
 
-					ctx.Response.Header.SetCookie(&cookie)
+			h(ctx)
+		}
+	}
+}
 
-					// in case of first user request we also need to set request cookie here
-					// to be able to get it further
-					ctx.Request.Header.SetCookie(string(cookie.Key()), string(cookie.Value()))
-				}
+// csrfHandler rejects state-changing requests with session cookie that are sent by other sites. Browsers tell
+// where requests come from by Sec-Fetch-Site, Origin or Referer headers, requests without them are not sent
+// by browsers and are let through as well as requests with bearer token.
+func csrfHandler(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		_, isBearer := bearerToken(ctx)
+		if isSafeMethod(ctx) || isBearer || len(ctx.Request.Header.Cookie("session")) == 0 || isSameSiteRequest(ctx) {
+			h(ctx)
+			return
+		}
+
+		ctx.Error("cross-site request is rejected", fasthttp.StatusForbidden)
+		ctx.Response.Header.Set(errorCodeHeader, csrfErrorCode)
+	}
+}
+
+// isSafeMethod says if the request method does not change state.
+func isSafeMethod(ctx *fasthttp.RequestCtx) bool {
+	return ctx.IsGet() || ctx.IsHead() || ctx.IsOptions() || ctx.IsTrace()
+}
+
+// isSameSiteRequest says if the request is sent by the service itself or by one of trusted origins.
+func isSameSiteRequest(ctx *fasthttp.RequestCtx) bool {
+	fetchSite := string(ctx.Request.Header.Peek("Sec-Fetch-Site"))
+	if fetchSite == "same-origin" || fetchSite == "none" {
+		return true
+	}
+
+	origin := string(ctx.Request.Header.Peek("Origin"))
+	if origin == "" {
+		if referer, err := url.Parse(string(ctx.Request.Header.Referer())); err == nil && referer.Host != "" {
+			origin = originOf(referer)
+		}
+	}
+
+	if origin == "" {
+		// browsers that send Sec-Fetch-Site send Origin with state-changing requests too
+		return fetchSite == ""
+	}
+
+	return isTrustedOrigin(ctx, origin)
+}
+
+// isTrustedOrigin says if the origin is the host of the request, the base URL or one of trusted origins.
+func isTrustedOrigin(ctx *fasthttp.RequestCtx, origin string) bool {
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		// "null" origin of sandboxed pages and other malformed origins
+		return false
+	}
+
+	if strings.EqualFold(u.Host, string(ctx.Host())) {
+		return true
+	}
+
+	origin = originOf(u)
+	if base, err := url.Parse(config.BaseShortenerURL); err == nil && origin == originOf(base) {
+		return true
+	}
+
+	for _, trusted := range config.CSRFTrustedOrigins {
+		if origin == trusted {
+			return true
+		}
+	}
+
+	// origins allowed to use cookies by CORS are trusted as well, otherwise they could not change anything
+	if config.CORSAllowCredentials {
+		if _, ok := corsAllowedOrigin(origin); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// originOf returns lowercase origin of the URL.
+func originOf(u *url.URL) string {
+	return strings.ToLower(u.Scheme + "://" + u.Host)
+}
+
+// corsHandler lets browsers call the service from allowed origins. Preflight requests are answered here, they
+// carry no credentials and are not routed. Headers of other requests are set after the handler, because
+// ctx.Error resets them.
+func corsHandler(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if len(config.CORSAllowedOrigins) == 0 {
+			h(ctx)
+			return
+		}
+
+		origin := string(ctx.Request.Header.Peek(fasthttp.HeaderOrigin))
+		isPreflight := ctx.IsOptions() && len(ctx.Request.Header.Peek(fasthttp.HeaderAccessControlRequestMethod)) > 0
+
+		if !isPreflight {
+			h(ctx)
+		}
+
+		// responses depend on the origin, so caches must not give them to other origins
+		ctx.Response.Header.Add(fasthttp.HeaderVary, fasthttp.HeaderOrigin)
+
+		allowedOrigin, ok := corsAllowedOrigin(origin)
+		if !ok {
+			if isPreflight {
+				ctx.SetStatusCode(fasthttp.StatusForbidden)
 			}
 
+			return
+		}
+
+		header := &ctx.Response.Header
+		header.Set(fasthttp.HeaderAccessControlAllowOrigin, allowedOrigin)
+		if config.CORSAllowCredentials {
+			header.Set(fasthttp.HeaderAccessControlAllowCredentials, "true")
+		}
+
+		if !isPreflight {
+			header.Set(fasthttp.HeaderAccessControlExposeHeaders, errorCodeHeader)
+			return
+		}
+
+		header.Add(fasthttp.HeaderVary, fasthttp.HeaderAccessControlRequestMethod)
+		header.Add(fasthttp.HeaderVary, fasthttp.HeaderAccessControlRequestHeaders)
+		header.Set(fasthttp.HeaderAccessControlAllowMethods, strings.Join(config.CORSAllowedMethods, ", "))
+		header.Set(fasthttp.HeaderAccessControlAllowHeaders, strings.Join(config.CORSAllowedHeaders, ", "))
+		header.Set(fasthttp.HeaderAccessControlMaxAge, strconv.Itoa(int(config.CORSMaxAge.Seconds())))
+		ctx.SetStatusCode(fasthttp.StatusNoContent)
+	}
+}
+
+// corsAllowedOrigin returns value of Access-Control-Allow-Origin for the request origin and says if it is allowed.
+func corsAllowedOrigin(origin string) (string, bool) {
+	if origin == "" {
+		return "", false
+	}
+
+	u, err := url.Parse(origin)
+	if err == nil && u.Host != "" {
+		origin = originOf(u)
+	}
+
+	for _, allowed := range config.CORSAllowedOrigins {
+		switch allowed {
+		case origin:
+			return origin, true
+		case config.CORSAnyOrigin:
+			return config.CORSAnyOrigin, true
+		}
+	}
+
+	return "", false
+}
+
+// apiKeysHandler authenticates requests with API key as bearer token, requests with unknown, revoked or expired
+// keys are rejected.
+func apiKeysHandler(repository apikeys.Repository) func(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+		return func(ctx *fasthttp.RequestCtx) {
+			token, ok := bearerToken(ctx)
+			if repository == nil || !ok || !apikeys.IsKey(string(token)) {
+				h(ctx)
+				return
+			}
+
+			key, err := repository.FindByHash(ctx, apikeys.HashKey(string(token)))
+			if err != nil {
+				ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+				return
+			}
+
+			if key == nil || key.IsExpired(time.Now()) {
+				unauthorized(ctx)
+				return
+			}
+
+			ctx.SetUserValue(apiKeyUserValue, key)
 			h(ctx)
 		}
 	}
 }
 
+// scopeHandler rejects requests authenticated by API key without the scope, other requests are let through.
+func scopeHandler(scope apikeys.Scope, h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if key := requestAPIKey(ctx); key != nil && !key.HasScope(scope) {
+			ctx.Error(fasthttp.StatusMessage(fasthttp.StatusForbidden), fasthttp.StatusForbidden)
+			ctx.Response.Header.Set(
+				fasthttp.HeaderWWWAuthenticate, fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+			return
+		}
+
+		h(ctx)
+	}
+}
+
+// userOnlyHandler rejects requests authenticated by API key, so keys cannot be used to get other credentials.
+func userOnlyHandler(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if requestAPIKey(ctx) != nil {
+			ctx.Error(fasthttp.StatusMessage(fasthttp.StatusForbidden), fasthttp.StatusForbidden)
+			return
+		}
+
+		h(ctx)
+	}
+}
+
+// sessionOnlyHandler rejects requests with bearer token, the handler manages session cookie and makes no sense
+// for clients without cookies.
+func sessionOnlyHandler(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if _, ok := bearerToken(ctx); ok {
+			ctx.Error("session cookie is required", fasthttp.StatusBadRequest)
+			return
+		}
+
+		h(ctx)
+	}
+}
+
+// requestAPIKey returns API key the request is authenticated by, nil for other requests.
+func requestAPIKey(ctx *fasthttp.RequestCtx) *apikeys.APIKey {
+	key, _ := ctx.UserValue(apiKeyUserValue).(*apikeys.APIKey)
+	return key
+}
+
+// unauthorized rejects request with wrong bearer token.
+func unauthorized(ctx *fasthttp.RequestCtx) {
+	// ctx.Error resets response headers, so the header goes after it
+	ctx.Error(fasthttp.StatusMessage(fasthttp.StatusUnauthorized), fasthttp.StatusUnauthorized)
+	ctx.Response.Header.Set(fasthttp.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+}
+
+// newSession returns new session of the user on the device of the request.
+func newSession(ctx *fasthttp.RequestCtx, userID auth.UserID) *auth.Session {
+	return &auth.Session{UserID: userID, UserAgent: string(ctx.UserAgent()), IP: ctx.RemoteIP().String()}
+}
+
+// setSessionCookie sets session cookie with encoded session to response and request.
+func setSessionCookie(ctx *fasthttp.RequestCtx, authenticator auth.Auth, session *auth.Session) {
+	userToken, err := authenticator.EncodeSession(ctx, session)
+	if err != nil {
+		log.Println("user session encoding error", err)
+	}
+
+	cookie := fasthttp.Cookie{}
+	cookie.SetKey("session")
+	cookie.SetValue(string(userToken))
+	cookie.SetPath("/")
+	cookie.SetHTTPOnly(true)
+	cookie.SetMaxAge(int(config.SessionTTL.Seconds()))
+	cookie.SetDomain(config.CookieDomain)
+	cookie.SetSecure(config.CookieSecure)
+	cookie.SetSameSite(sameSiteModes[config.CookieSameSite])
+
+	ctx.Response.Header.SetCookie(&cookie)
+
+	// in case of first user request we also need to set request cookie here
+	// to be able to get it further
+	ctx.Request.Header.SetCookie(string(cookie.Key()), string(cookie.Value()))
+	ctx.SetUserValue(sessionUserValue, session)
+}
+
+// adminHandler lets only requests with valid admin token through, admin endpoints do not exist without the token.
+func adminHandler(h fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		if config.AdminToken == "" {
+			ctx.Error(fasthttp.StatusMessage(fasthttp.StatusNotFound), fasthttp.StatusNotFound)
+			return
+		}
+
+		token := ctx.Request.Header.Peek("X-Admin-Token")
+		if subtle.ConstantTimeCompare(token, []byte(config.AdminToken)) != 1 {
+			ctx.Error(fasthttp.StatusMessage(fasthttp.StatusForbidden), fasthttp.StatusForbidden)
+			return
+		}
+
+		h(ctx)
+	}
+}
+
 // getUserID returns user identifier from request context, mostly works like a helper.
+// API key and bearer token from Authorization header go before session cookie.
 func getUserID(ctx *fasthttp.RequestCtx, authenticator auth.Auth) (auth.UserID, error) {
-	sessionCookie := ctx.Request.Header.Cookie("session")
-	return authenticator.Decode(sessionCookie)
+	if key := requestAPIKey(ctx); key != nil {
+		return key.UserID, nil
+	}
+
+	session, err := getSession(ctx, authenticator)
+	if session == nil {
+		return nil, err
+	}
+
+	return session.UserID, err
+}
+
+// getSession returns session of bearer token or session cookie. Bearer tokens are never encoded again,
+// so ones without stored session are rejected. Session cookies encoded by old keys or expiring soon are encoded
+// again, requests without valid cookie (empty, wrong encoded or revoked) get a new anonymous session.
+// The session is kept in the request, so it is decoded once.
+func getSession(ctx *fasthttp.RequestCtx, authenticator auth.Auth) (*auth.Session, error) {
+	if sequence, ok := bearerToken(ctx); ok {
+		session, err := authenticator.DecodeSession(ctx, sequence)
+		if errors.Is(err, auth.ErrNoSession) {
+			return nil, err
+		}
+
+		if errors.Is(err, auth.ErrRenewal) {
+			return session, nil
+		}
+
+		return session, err
+	}
+
+	if session, ok := ctx.UserValue(sessionUserValue).(*auth.Session); ok && session != nil {
+		return session, nil
+	}
+
+	cookie := ctx.Request.Header.Cookie("session")
+	session, err := authenticator.DecodeSession(ctx, cookie)
+
+	switch {
+	case errors.Is(err, auth.ErrRenewal):
+		setSessionCookie(ctx, authenticator, session)
+	case err != nil:
+		if len(cookie) > 0 {
+			log.Println("user session invalidation error", err)
+		}
+
+		session = newSession(ctx, auth.NewUserID())
+		setSessionCookie(ctx, authenticator, session)
+	default:
+		ctx.SetUserValue(sessionUserValue, session)
+	}
+
+	return session, nil
+}
+
+// bearerToken returns token from Authorization header, ok is false if the request has no bearer token.
+func bearerToken(ctx *fasthttp.RequestCtx) ([]byte, bool) {
+	header := ctx.Request.Header.Peek(fasthttp.HeaderAuthorization)
+	if len(header) < len(bearerPrefix) || !strings.EqualFold(string(header[:len(bearerPrefix)]), bearerPrefix) {
+		return nil, false
+	}
+
+	return bytes.TrimSpace(header[len(bearerPrefix):]), true
 }
@@ -0,0 +1,128 @@
+package app
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/magmel48/go-web/internal/config"
+	"github.com/magmel48/go-web/internal/oidc"
+	"github.com/valyala/fasthttp"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	// oidcFlowCookie keeps state, nonce and PKCE verifier of OpenID Connect login until the user returns.
+	oidcFlowCookie = "oidc_flow"
+	// oidcFlowPath limits the cookie to OpenID Connect endpoints.
+	oidcFlowPath = "/api/auth/oidc"
+	// oidcFlowTTL is how long the user can spend at the provider.
+	oidcFlowTTL = 10 * time.Minute
+	// oidcFlowSeparator separates values in the cookie, it is not used by oidc.RandomString.
+	oidcFlowSeparator = "."
+)
+
+// HandleOIDCLoginGet handles GET on "/api/auth/oidc/login" and sends the user to OpenID Connect provider.
+func (app App) HandleOIDCLoginGet(ctx *fasthttp.RequestCtx) {
+	if app.oidc == nil {
+		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusNotFound), fasthttp.StatusNotFound)
+		return
+	}
+
+	values := make([]string, 3)
+	for i := range values {
+		value, err := oidc.RandomString()
+		if err != nil {
+			ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+			return
+		}
+
+		values[i] = value
+	}
+
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	authCodeURL, err := app.oidc.AuthCodeURL(ctx, state, nonce, oidc.Challenge(verifier))
+	if err != nil {
+		log.Printf("OpenID Connect provider is not available: %v\n", err)
+		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusBadGateway), fasthttp.StatusBadGateway)
+		return
+	}
+
+	setOIDCFlowCookie(ctx, strings.Join(values, oidcFlowSeparator), oidcFlowTTL)
+
+	ctx.Response.Header.Set(fasthttp.HeaderCacheControl, "no-store")
+	ctx.Redirect(authCodeURL, fasthttp.StatusFound)
+}
+
+// HandleOIDCCallbackGet handles GET on "/api/auth/oidc/callback", it logs the user returned by OpenID Connect
+// provider in. Links of the anonymous user are given to the account as on password login.
+func (app App) HandleOIDCCallbackGet(ctx *fasthttp.RequestCtx) {
+	if app.oidc == nil {
+		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusNotFound), fasthttp.StatusNotFound)
+		return
+	}
+
+	flow := strings.Split(string(ctx.Request.Header.Cookie(oidcFlowCookie)), oidcFlowSeparator)
+	// the flow is used once whatever the result is
+	setOIDCFlowCookie(ctx, "", -1)
+
+	args := ctx.QueryArgs()
+	if providerErr := args.Peek("error"); len(providerErr) > 0 {
+		ctx.Error("login is rejected by provider: "+string(providerErr), fasthttp.StatusUnauthorized)
+		return
+	}
+
+	if len(flow) != 3 || subtle.ConstantTimeCompare(args.Peek("state"), []byte(flow[0])) != 1 {
+		ctx.Error("wrong login state", fasthttp.StatusBadRequest)
+		return
+	}
+
+	claims, err := app.oidc.Exchange(ctx, string(args.Peek("code")), flow[2], flow[1])
+	switch {
+	case errors.Is(err, oidc.ErrDiscovery):
+		log.Printf("OpenID Connect provider is not available: %v\n", err)
+		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusBadGateway), fasthttp.StatusBadGateway)
+		return
+	case err != nil:
+		ctx.Error(err.Error(), fasthttp.StatusUnauthorized)
+		return
+	}
+
+	userID, err := getUserID(ctx, app.authenticator)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	account, err := app.identity.LoginSubject(ctx, userID, app.oidc.Issuer(), claims.Subject)
+	if err != nil {
+		handleIdentityError(ctx, err)
+		return
+	}
+
+	setSessionCookie(ctx, app.authenticator, newSession(ctx, account.UserID))
+
+	ctx.Response.Header.Set(fasthttp.HeaderCacheControl, "no-store")
+	ctx.Redirect("/", fasthttp.StatusFound)
+}
+
+// setOIDCFlowCookie sets cookie of OpenID Connect login, negative maxAge removes it. The cookie is Lax
+// whatever session cookies are, otherwise it is not sent back by the provider redirect.
+func setOIDCFlowCookie(ctx *fasthttp.RequestCtx, value string, maxAge time.Duration) {
+	cookie := fasthttp.Cookie{}
+	cookie.SetKey(oidcFlowCookie)
+	cookie.SetValue(value)
+	cookie.SetPath(oidcFlowPath)
+	cookie.SetHTTPOnly(true)
+	cookie.SetSecure(config.CookieSecure)
+	cookie.SetSameSite(fasthttp.CookieSameSiteLaxMode)
+
+	if maxAge < 0 {
+		cookie.SetExpire(fasthttp.CookieExpireDelete)
+	} else {
+		cookie.SetMaxAge(int(maxAge.Seconds()))
+	}
+
+	ctx.Response.Header.SetCookie(&cookie)
+}
@@ -0,0 +1,104 @@
+package app
+
+import (
+	"bytes"
+	"html/template"
+	"log"
+
+	"github.com/valyala/fasthttp"
+)
+
+// passwordPage is shown for password protected links instead of redirect.
+var passwordPage = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<meta name="robots" content="noindex">
+	<title>Protected link</title>
+</head>
+<body>
+	<form method="post">
+		<p>This link is protected with a password.</p>
+		{{if .Error}}<p><strong>{{.Error}}</strong></p>{{end}}
+		<input type="password" name="password" autofocus required>
+		<button type="submit">Open</button>
+	</form>
+</body>
+</html>
+`))
+
+// deepLinkPage tries to open the mobile app and falls back to the web or the app store if nothing happened.
+var deepLinkPage = template.Must(template.New("deeplink").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<meta name="robots" content="noindex">
+	<title>Opening the app</title>
+</head>
+<body>
+	<p><a href="{{.AppURL}}">Open in the app</a> or <a href="{{.FallbackURL}}">continue in the browser</a>.</p>
+	<script>
+		var fallback = setTimeout(function () { window.location.replace({{.FallbackURL}}); }, {{.TimeoutMs}});
+		// the page is hidden when the app is opened, the fallback is not needed anymore then
+		document.addEventListener("visibilitychange", function () {
+			if (document.hidden) { clearTimeout(fallback); }
+		});
+		window.location.href = {{.AppURL}};
+	</script>
+</body>
+</html>
+`))
+
+// deepLinkPageData is data for rendering deepLinkPage.
+type deepLinkPageData struct {
+	// AppURL is trusted, it was validated on link creation, so custom app schemes are not filtered out.
+	AppURL      template.URL
+	FallbackURL string
+	TimeoutMs   int
+}
+
+// interstitialPage warns the client about untrusted destination of the link before going there.
+var interstitialPage = template.Must(template.New("interstitial").Parse(`<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<meta name="viewport" content="width=device-width, initial-scale=1">
+	<meta name="robots" content="noindex">
+	<meta name="referrer" content="no-referrer">
+	<title>Check the link before going on</title>
+</head>
+<body>
+	<p>This short link leads to:</p>
+	<p><strong>{{.URL}}</strong></p>
+	<p>We cannot confirm the destination is safe. Continue only if you trust it.</p>
+	<p><a href="{{.URL}}" rel="noreferrer">Continue</a></p>
+</body>
+</html>
+`))
+
+// interstitialPageData is data for rendering interstitialPage.
+type interstitialPageData struct {
+	URL string
+}
+
+// passwordPageData is data for rendering passwordPage.
+type passwordPageData struct {
+	Error string
+}
+
+// renderPage renders specified template as HTML response that must not be cached.
+func renderPage(ctx *fasthttp.RequestCtx, page *template.Template, data interface{}, statusCode int) {
+	var buf bytes.Buffer
+	if err := page.Execute(&buf, data); err != nil {
+		log.Println("page rendering error", err)
+		ctx.Error("page rendering error", fasthttp.StatusInternalServerError)
+		return
+	}
+
+	ctx.Response.Header.Set("Cache-Control", "no-store")
+	ctx.SetContentType("text/html; charset=utf-8")
+	ctx.SetStatusCode(statusCode)
+	ctx.SetBody(buf.Bytes())
+}
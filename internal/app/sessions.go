@@ -0,0 +1,113 @@
+package app
+
+import (
+	"encoding/json"
+	"github.com/valyala/fasthttp"
+	routercontext "github.com/vardius/gorouter/v4/context"
+	"time"
+)
+
+// SessionResult represents one element of response from /api/user/sessions.
+type SessionResult struct {
+	ID         string     `json:"id"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	// Current is true for session of the request.
+	Current bool `json:"current"`
+}
+
+// HandleSessionsGet handles GET on "/api/user/sessions" and returns active sessions of the user.
+func (app App) HandleSessionsGet(ctx *fasthttp.RequestCtx) {
+	if app.sessions == nil {
+		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusNotFound), fasthttp.StatusNotFound)
+		return
+	}
+
+	current, err := getSession(ctx, app.authenticator)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if current == nil {
+		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusUnauthorized), fasthttp.StatusUnauthorized)
+		return
+	}
+
+	sessions, err := app.sessions.List(ctx, current.UserID)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	result := make([]SessionResult, 0, len(sessions))
+	for _, session := range sessions {
+		result = append(result, SessionResult{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == current.ID,
+		})
+	}
+
+	response, err := json.Marshal(result)
+	if err != nil {
+		ctx.Error("json marshal error", fasthttp.StatusBadRequest)
+		return
+	}
+
+	ctx.SetContentType("application/json; charset=utf-8")
+	ctx.SetBody(response)
+}
+
+// HandleSessionDelete handles DELETE on "/api/user/sessions/{id}" and revokes session of the user,
+// cookies and tokens of the session stop working at once.
+func (app App) HandleSessionDelete(ctx *fasthttp.RequestCtx) {
+	if app.sessions == nil {
+		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusNotFound), fasthttp.StatusNotFound)
+		return
+	}
+
+	params := ctx.UserValue("params").(routercontext.Params)
+
+	userID, err := getUserID(ctx, app.authenticator)
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	revoked, err := app.sessions.Revoke(ctx, userID, params.Value("id"))
+	if err != nil {
+		ctx.Error(err.Error(), fasthttp.StatusInternalServerError)
+		return
+	}
+
+	if !revoked {
+		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusNotFound), fasthttp.StatusNotFound)
+		return
+	}
+
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
+}
+
+// revokeCurrentSession revokes stored session of the request, so its cookie cannot be used after logout.
+func (app App) revokeCurrentSession(ctx *fasthttp.RequestCtx) error {
+	// requests without cookie have no session to revoke, a new one is not made for them
+	if app.sessions == nil || len(ctx.Request.Header.Cookie("session")) == 0 {
+		return nil
+	}
+
+	session, err := getSession(ctx, app.authenticator)
+	if err != nil || session == nil || session.ID == "" {
+		return err
+	}
+
+	_, err = app.sessions.Revoke(ctx, session.UserID, session.ID)
+	return err
+}
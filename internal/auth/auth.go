@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"github.com/google/uuid"
 )
 
@@ -21,4 +22,9 @@ func NewUserID() UserID {
 type Auth interface {
 	Decode(sequence []byte) (UserID, error)
 	Encode(id UserID) ([]byte, error)
+	// DecodeSession decodes sequence like Decode and returns its session, stored sessions are checked
+	// for revocation.
+	DecodeSession(ctx context.Context, sequence []byte) (*Session, error)
+	// EncodeSession encodes the session, the session is stored first if it has no identifier yet.
+	EncodeSession(ctx context.Context, session *Session) ([]byte, error)
 }
@@ -1,78 +1,436 @@
 package auth
 
 import (
+	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/magmel48/go-web/internal/config"
+	"golang.org/x/crypto/hkdf"
+	"io"
+	"time"
 )
 
+// tokenVersion starts every sequence encoded with a key identifier: "v2.<key id>.<base64 payload>".
+// Version 2 sequences are encoded by keys derived with HKDF, version 1 ones and sequences without version
+// are encoded by legacy keys.
+const tokenVersion = "v2"
+
+// legacyTokenVersion is version of sequences encoded by legacy keys with identifiers.
+const legacyTokenVersion = "v1"
+
+// keyInfo binds derived keys to their purpose, so the same secret gives other keys for other purposes.
+const keyInfo = "go-web session cookie"
+
+// keySize is size of derived keys, it makes AES-256.
+const keySize = 32
+
+// sessionIDSize is how many random bytes are in session identifiers.
+const sessionIDSize = 16
+
+// touchInterval is how often last seen time of stored sessions is updated, so not every request writes to the store.
+const touchInterval = time.Minute
+
+// tokenSeparator separates parts of encoded sequence, it is not used by base64 and key identifiers.
+const tokenSeparator = "."
+
+// ErrRenewal is returned together with valid user identifier when the sequence should be encoded again.
+var ErrRenewal = errors.New("sequence should be encoded again")
+
+// ErrOldKey is returned together with valid user identifier when the sequence is encoded by a key that is not
+// active anymore.
+var ErrOldKey = fmt.Errorf("%w: sequence is encoded by old key", ErrRenewal)
+
+// ErrExpiring is returned together with valid user identifier when the sequence expires soon.
+var ErrExpiring = fmt.Errorf("%w: sequence expires soon", ErrRenewal)
+
+// ErrExpired is returned when the sequence is expired.
+var ErrExpired = errors.New("sequence is expired")
+
+// ErrLegacyExpired is returned when the sequence has no expiration or no session and the migration window
+// of such sequences is over.
+var ErrLegacyExpired = fmt.Errorf("%w: legacy sequence", ErrExpired)
+
+// ErrUnknownKey is returned when the sequence is encoded by a key that is not in the keyring.
+var ErrUnknownKey = errors.New("unknown key")
+
 // CustomAuth is custom auth implementation.
 type CustomAuth struct {
-	algo      cipher.AEAD
-	NonceFunc NonceFunc
+	// algo is the active key, every new sequence is encoded by it
+	algo  cipher.AEAD
+	keyID string
+	// oldAlgos are previous keys by identifiers, they are accepted for decoding only
+	oldAlgos map[string]cipher.AEAD
+	// legacyAlgos are keys made of the first 16 bytes of every secret by identifiers, they are accepted for decoding
+	// only so users keep their sessions after keys got derived with HKDF
+	legacyAlgos map[string]cipher.AEAD
+	// ttl is lifetime of encoded sequences, zero means they never expire
+	ttl time.Duration
+	// renewBefore is time before expiration when sequences should be encoded again
+	renewBefore time.Duration
+	// legacyUntil is the end of migration window of sequences made without claims or, if sessions are stored,
+	// without session, zero means they are not accepted
+	legacyUntil time.Time
+	NonceFunc   NonceFunc
+	NowFunc     func() time.Time
+	// Sessions keeps sessions on the server, nil means sequences are the only state of sessions
+	Sessions SessionStore
+}
+
+// claims are encrypted together with user identifier.
+type claims struct {
+	UserID    string `json:"sub"`
+	SessionID string `json:"sid,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp,omitempty"`
 }
 
-// NewCustomAuth creates new CustomAuth instance.
+// NewCustomAuth creates new CustomAuth instance with keys from config.
 func NewCustomAuth() (*CustomAuth, error) {
-	aesBlock, err := aes.NewCipher([]byte(config.SecretKey)[:aes.BlockSize])
-	if err != nil {
+	auth := &CustomAuth{
+		keyID:       config.SecretKeyID,
+		oldAlgos:    make(map[string]cipher.AEAD, len(config.OldSecretKeys)),
+		legacyAlgos: make(map[string]cipher.AEAD, len(config.OldSecretKeys)+1),
+		ttl:         config.SessionTTL,
+		renewBefore: config.SessionRenewBefore,
+		legacyUntil: config.LegacySessionsUntil,
+		NonceFunc:   DefaultNonceFunc,
+		NowFunc:     time.Now,
+	}
+
+	var err error
+	if auth.algo, err = newAEAD(config.SecretKey); err != nil {
+		return nil, err
+	}
+
+	if auth.legacyAlgos[config.SecretKeyID], err = newLegacyAEAD(config.SecretKey); err != nil {
 		return nil, err
 	}
 
-	aesGCM, err := cipher.NewGCM(aesBlock)
+	for keyID, secret := range config.OldSecretKeys {
+		if auth.oldAlgos[keyID], err = newAEAD(secret); err != nil {
+			return nil, fmt.Errorf("old key %s: %w", keyID, err)
+		}
+
+		if auth.legacyAlgos[keyID], err = newLegacyAEAD(secret); err != nil {
+			return nil, fmt.Errorf("old key %s: %w", keyID, err)
+		}
+	}
+
+	return auth, nil
+}
+
+// newAEAD creates AES-256-GCM cipher with key derived from the whole secret with HKDF.
+func newAEAD(secret string) (cipher.AEAD, error) {
+	key := make([]byte, keySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(secret), nil, []byte(keyInfo)), key); err != nil {
+		return nil, err
+	}
+
+	return newGCM(key)
+}
+
+// newLegacyAEAD creates AES-128-GCM cipher with key made of the first 16 bytes of the secret padded with zeros.
+func newLegacyAEAD(secret string) (cipher.AEAD, error) {
+	key := make([]byte, aes.BlockSize)
+	copy(key, secret)
+
+	return newGCM(key)
+}
+
+// newGCM creates AES-GCM cipher with the key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	aesBlock, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
 
-	return &CustomAuth{algo: aesGCM, NonceFunc: DefaultNonceFunc}, nil
+	return cipher.NewGCM(aesBlock)
 }
 
 // Decode decodes encoded sequence (usually from user session)
-// and returns user identifier if the input sequence is valid.
+// and returns user identifier if the input sequence is valid and not expired.
+// If the sequence should be encoded again, user identifier is returned with ErrRenewal.
 func (auth CustomAuth) Decode(sequence []byte) (UserID, error) {
+	c, err := auth.decodeClaims(sequence)
+	if c == nil {
+		return nil, err
+	}
+
+	return &c.UserID, err
+}
+
+// DecodeSession decodes sequence like Decode and returns its session. If sessions are stored, the session
+// must be stored, not revoked and belong to the user of the sequence.
+func (auth CustomAuth) DecodeSession(ctx context.Context, sequence []byte) (*Session, error) {
+	c, err := auth.decodeClaims(sequence)
+	if c == nil {
+		return nil, err
+	}
+
+	session := &Session{ID: c.SessionID, UserID: &c.UserID}
+	if auth.Sessions == nil {
+		return session, err
+	}
+
+	if c.SessionID == "" {
+		if !auth.isLegacyAccepted() {
+			return nil, ErrLegacyExpired
+		}
+
+		return session, ErrNoSession
+	}
+
+	stored, findErr := auth.Sessions.Find(ctx, c.SessionID)
+	if findErr != nil {
+		return nil, findErr
+	}
+
+	now := auth.now()
+	if stored == nil || stored.UserID == nil || *stored.UserID != c.UserID || stored.IsExpired(now) {
+		return nil, ErrRevoked
+	}
+
+	if now.Sub(stored.LastSeenAt) >= touchInterval {
+		if touchErr := auth.Sessions.Touch(ctx, stored.ID, now, stored.ExpiresAt); touchErr != nil {
+			return nil, touchErr
+		}
+
+		stored.LastSeenAt = now
+	}
+
+	return stored, err
+}
+
+// decodeClaims decodes claims of the sequence, claims are returned with ErrRenewal if the sequence should be
+// encoded again.
+func (auth CustomAuth) decodeClaims(sequence []byte) (*claims, error) {
 	if len(sequence) == 0 {
 		return nil, errors.New("wrong bytes sequence")
 	}
 
-	encoded := make([]byte, base64.RawStdEncoding.DecodedLen(len(sequence)))
+	parts := bytes.SplitN(sequence, []byte(tokenSeparator), 3)
+	if len(parts) != 3 {
+		return auth.decodeLegacy(sequence)
+	}
+
+	keyID := string(parts[1])
+	switch string(parts[0]) {
+	case tokenVersion:
+		if keyID == auth.keyID {
+			plaintext, err := decode(auth.algo, parts[2])
+			if err != nil {
+				return nil, err
+			}
 
-	_, err := base64.RawStdEncoding.Decode(encoded, sequence)
+			return auth.checkClaims(plaintext, false)
+		}
+
+		return auth.decodeOld(auth.oldAlgos, keyID, parts[2])
+	case legacyTokenVersion:
+		return auth.decodeOld(auth.legacyAlgos, keyID, parts[2])
+	default:
+		return nil, errors.New("wrong bytes sequence")
+	}
+}
+
+// decodeOld decodes payload by one of old keys.
+func (auth CustomAuth) decodeOld(algos map[string]cipher.AEAD, keyID string, payload []byte) (*claims, error) {
+	algo, ok := algos[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+
+	plaintext, err := decode(algo, payload)
 	if err != nil {
 		return nil, err
 	}
 
-	encrypted := encoded[:len(encoded)-auth.algo.NonceSize()]
-	nonce := encoded[len(encoded)-auth.algo.NonceSize():]
+	return auth.checkClaims(plaintext, true)
+}
 
-	decrypted, err := auth.algo.Open(nil, nonce, encrypted, nil)
-	if err != nil {
+// decodeLegacy decodes sequence without key identifier trying every legacy key, the active one goes first.
+func (auth CustomAuth) decodeLegacy(sequence []byte) (*claims, error) {
+	algos := make([]cipher.AEAD, 0, len(auth.legacyAlgos))
+	if algo, ok := auth.legacyAlgos[auth.keyID]; ok {
+		algos = append(algos, algo)
+	}
+
+	for keyID, algo := range auth.legacyAlgos {
+		if keyID != auth.keyID {
+			algos = append(algos, algo)
+		}
+	}
+
+	err := errors.New("wrong bytes sequence")
+	for _, algo := range algos {
+		var plaintext []byte
+		if plaintext, err = decode(algo, sequence); err == nil {
+			return auth.checkClaims(plaintext, true)
+		}
+	}
+
+	return nil, err
+}
+
+// checkClaims returns decrypted claims if they are not expired.
+// Sequences made before claims have only user identifier, they are accepted once to be encoded again until
+// the migration window is over. Claims without expiration expire in ttl after they are issued.
+func (auth CustomAuth) checkClaims(plaintext []byte, oldKey bool) (*claims, error) {
+	if len(plaintext) == 0 || plaintext[0] != '{' {
+		if !auth.isLegacyAccepted() {
+			return nil, ErrLegacyExpired
+		}
+
+		c := &claims{UserID: string(plaintext)}
+		if oldKey {
+			return c, ErrOldKey
+		}
+
+		return c, ErrRenewal
+	}
+
+	var c claims
+	if err := json.Unmarshal(plaintext, &c); err != nil {
 		return nil, err
 	}
 
-	result := string(decrypted)
-	return &result, nil
+	if c.ExpiresAt == 0 && auth.ttl > 0 {
+		c.ExpiresAt = time.Unix(c.IssuedAt, 0).Add(auth.ttl).Unix()
+	}
+
+	now := auth.now()
+	if c.ExpiresAt != 0 && now.Unix() >= c.ExpiresAt {
+		return nil, ErrExpired
+	}
+
+	switch {
+	case oldKey:
+		return &c, ErrOldKey
+	case c.ExpiresAt != 0 && time.Unix(c.ExpiresAt, 0).Sub(now) < auth.renewBefore:
+		return &c, ErrExpiring
+	default:
+		return &c, nil
+	}
 }
 
-// Encode encodes user identifier and puts iv into the end of result for further decoding.
+// Encode encodes user identifier with issued at and expiration time by the active key and puts iv into the end
+// of result for further decoding.
 func (auth CustomAuth) Encode(id UserID) ([]byte, error) {
+	return auth.encode(claims{UserID: *id})
+}
+
+// EncodeSession encodes user identifier with identifier of the session. If sessions are stored, new sessions
+// are stored first and expiration of existing ones is extended.
+func (auth CustomAuth) EncodeSession(ctx context.Context, session *Session) ([]byte, error) {
+	if auth.Sessions == nil {
+		return auth.Encode(session.UserID)
+	}
+
+	now := auth.now()
+
+	var expiresAt *time.Time
+	if auth.ttl > 0 {
+		t := now.Add(auth.ttl)
+		expiresAt = &t
+	}
+
+	if session.ID == "" {
+		id, err := auth.NonceFunc(sessionIDSize)
+		if err != nil {
+			return nil, err
+		}
+
+		session.ID = base64.RawURLEncoding.EncodeToString(id)
+		session.CreatedAt = now
+		session.LastSeenAt = now
+		session.ExpiresAt = expiresAt
+
+		if err := auth.Sessions.Create(ctx, *session); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := auth.Sessions.Touch(ctx, session.ID, now, expiresAt); err != nil {
+			return nil, err
+		}
+
+		session.LastSeenAt = now
+		session.ExpiresAt = expiresAt
+	}
+
+	return auth.encode(claims{UserID: *session.UserID, SessionID: session.ID})
+}
+
+// encode encodes claims with issued at and expiration time by the active key and puts iv into the end
+// of result for further decoding.
+func (auth CustomAuth) encode(c claims) ([]byte, error) {
 	nonce, err := auth.NonceFunc(auth.algo.NonceSize())
 	if err != nil {
 		return nil, err
 	}
 
-	encrypted := auth.algo.Seal(nil, nonce, []byte(*id), nil)
+	now := auth.now()
+	c.IssuedAt = now.Unix()
+	if auth.ttl > 0 {
+		c.ExpiresAt = now.Add(auth.ttl).Unix()
+	}
+
+	plaintext, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted := auth.algo.Seal(nil, nonce, plaintext, nil)
 
 	raw := append(encrypted, nonce...)
-	serialized := make([]byte, base64.RawStdEncoding.EncodedLen(len(raw)))
+	prefix := tokenVersion + tokenSeparator + auth.keyID + tokenSeparator
+	serialized := make([]byte, len(prefix)+base64.RawStdEncoding.EncodedLen(len(raw)))
 
-	base64.RawStdEncoding.Encode(serialized, raw)
+	copy(serialized, prefix)
+	base64.RawStdEncoding.Encode(serialized[len(prefix):], raw)
 
 	return serialized, nil
 }
 
+// now returns current time.
+func (auth CustomAuth) now() time.Time {
+	if auth.NowFunc == nil {
+		return time.Now()
+	}
+
+	return auth.NowFunc()
+}
+
+// isLegacyAccepted says if the migration window of legacy sequences is not over yet.
+func (auth CustomAuth) isLegacyAccepted() bool {
+	return auth.now().Before(auth.legacyUntil)
+}
+
+// decode decrypts base64 payload with iv in the end by the key.
+func decode(algo cipher.AEAD, payload []byte) ([]byte, error) {
+	encoded := make([]byte, base64.RawStdEncoding.DecodedLen(len(payload)))
+
+	_, err := base64.RawStdEncoding.Decode(encoded, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(encoded) < algo.NonceSize() {
+		return nil, errors.New("wrong bytes sequence")
+	}
+
+	encrypted := encoded[:len(encoded)-algo.NonceSize()]
+	nonce := encoded[len(encoded)-algo.NonceSize():]
+
+	return algo.Open(nil, nonce, encrypted, nil)
+}
+
 // DefaultNonceFunc is default function for nonce retrieving.
 func DefaultNonceFunc(nonceSize int) ([]byte, error) {
 	nonce := make([]byte, nonceSize)
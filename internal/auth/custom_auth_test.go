@@ -1,9 +1,14 @@
 package auth
 
 import (
+	"context"
 	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"github.com/magmel48/go-web/internal/config"
 	"reflect"
 	"testing"
+	"time"
 )
 
 // TestAEAD represents algorithm that does not perform a mutation on provided bytes for encoding or decoding.
@@ -30,42 +35,127 @@ func (t TestAEAD) Open(dst, _, ciphertext, _ []byte) ([]byte, error) {
 	return dst, nil
 }
 
+// testSequence encodes plaintext like CustomAuth with TestAEAD and nonce 1.
+func testSequence(prefix string, plaintext string) []byte {
+	return []byte(prefix + base64.RawStdEncoding.EncodeToString(append([]byte(plaintext), 1)))
+}
+
 func TestCustomAuth_Decode(t *testing.T) {
 	type fields struct {
-		algo cipher.AEAD
+		algo        cipher.AEAD
+		keyID       string
+		oldAlgos    map[string]cipher.AEAD
+		legacyAlgos map[string]cipher.AEAD
+		legacyUntil time.Time
 	}
 	type args struct {
 		sequence []byte
 	}
 
 	id := "26d1ac21-57d5-43ba-b2f7-08d36310aa07"
+	now := time.Unix(1700000000, 0)
+	validClaims := `{"sub":"` + id + `","iat":1699990000,"exp":1700090000}`
+	legacySequence := []byte{
+		77, 106, 90, 107, 77, 87, 70, 106, 77, 106, 69, 116, 78, 84, 100, 107, 78, 83, 48, 48, 77, 50, 74, 104,
+		76, 87, 73, 121, 90, 106, 99, 116, 77, 68, 104, 107, 77, 122, 89, 122, 77, 84, 66, 104, 89, 84, 65, 51,
+		65, 81}
+	oldAlgos := map[string]cipher.AEAD{"0": TestAEAD{}}
+	legacyAlgos := map[string]cipher.AEAD{"1": TestAEAD{}}
+	legacyUntil := now.Add(time.Hour)
 
 	tests := []struct {
 		name    string
 		fields  fields
 		args    args
 		want    UserID
-		wantErr bool
+		wantErr error
 	}{
 		{
-			name:   "happy path",
-			fields: fields{algo: TestAEAD{}},
-			args: args{sequence: []byte{
-				77, 106, 90, 107, 77, 87, 70, 106, 77, 106, 69, 116, 78, 84, 100, 107, 78, 83, 48, 48, 77, 50, 74, 104,
-				76, 87, 73, 121, 90, 106, 99, 116, 77, 68, 104, 107, 77, 122, 89, 122, 77, 84, 66, 104, 89, 84, 65, 51,
-				65, 81}},
+			name:    "happy path",
+			fields:  fields{algo: TestAEAD{}, keyID: "1"},
+			args:    args{sequence: testSequence("v2.1.", validClaims)},
 			want:    &id,
-			wantErr: false,
+			wantErr: nil,
+		},
+		{
+			name:    "should ask to encode again sequence expiring soon",
+			fields:  fields{algo: TestAEAD{}, keyID: "1"},
+			args:    args{sequence: testSequence("v2.1.", `{"sub":"`+id+`","iat":1699990000,"exp":1700000100}`)},
+			want:    &id,
+			wantErr: ErrExpiring,
+		},
+		{
+			name:    "should reject expired sequence",
+			fields:  fields{algo: TestAEAD{}, keyID: "1", oldAlgos: oldAlgos},
+			args:    args{sequence: testSequence("v2.0.", `{"sub":"`+id+`","iat":1699990000,"exp":1700000000}`)},
+			want:    nil,
+			wantErr: ErrExpired,
+		},
+		{
+			name:    "should ask to encode again sequence without claims",
+			fields:  fields{algo: TestAEAD{}, keyID: "1", legacyUntil: legacyUntil},
+			args:    args{sequence: append([]byte("v2.1."), legacySequence...)},
+			want:    &id,
+			wantErr: ErrRenewal,
+		},
+		{
+			name:    "should reject sequence without claims after migration window",
+			fields:  fields{algo: TestAEAD{}, keyID: "1", legacyUntil: now},
+			args:    args{sequence: append([]byte("v2.1."), legacySequence...)},
+			want:    nil,
+			wantErr: ErrLegacyExpired,
+		},
+		{
+			name:    "should reject sequence without expiration issued longer than lifetime ago",
+			fields:  fields{algo: TestAEAD{}, keyID: "1"},
+			args:    args{sequence: testSequence("v2.1.", `{"sub":"`+id+`","iat":1699900000}`)},
+			want:    nil,
+			wantErr: ErrExpired,
+		},
+		{
+			name:    "should ask to encode again sequence of old key",
+			fields:  fields{algo: TestAEAD{}, keyID: "1", oldAlgos: oldAlgos},
+			args:    args{sequence: testSequence("v2.0.", validClaims)},
+			want:    &id,
+			wantErr: ErrOldKey,
+		},
+		{
+			name:    "should ask to encode again sequence of legacy key",
+			fields:  fields{algo: TestAEAD{}, keyID: "1", legacyAlgos: legacyAlgos, legacyUntil: legacyUntil},
+			args:    args{sequence: append([]byte("v1.1."), legacySequence...)},
+			want:    &id,
+			wantErr: ErrOldKey,
+		},
+		{
+			name:    "should ask to encode again sequence without key identifier",
+			fields:  fields{algo: TestAEAD{}, keyID: "1", legacyAlgos: legacyAlgos, legacyUntil: legacyUntil},
+			args:    args{sequence: legacySequence},
+			want:    &id,
+			wantErr: ErrOldKey,
+		},
+		{
+			name:    "should reject sequence of unknown key",
+			fields:  fields{algo: TestAEAD{}, keyID: "1", oldAlgos: oldAlgos},
+			args:    args{sequence: testSequence("v2.2.", validClaims)},
+			want:    nil,
+			wantErr: ErrUnknownKey,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			auth := CustomAuth{
-				algo: tt.fields.algo,
+				algo:        tt.fields.algo,
+				keyID:       tt.fields.keyID,
+				oldAlgos:    tt.fields.oldAlgos,
+				legacyAlgos: tt.fields.legacyAlgos,
+				ttl:         24 * time.Hour,
+				renewBefore: time.Hour,
+				legacyUntil: tt.fields.legacyUntil,
+				NowFunc:     func() time.Time { return now },
 			}
 			got, err := auth.Decode(tt.args.sequence)
-			if (err != nil) != tt.wantErr {
+			if !errors.Is(err, tt.wantErr) || (err != nil && tt.wantErr == nil) {
 				t.Errorf("Decode() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
@@ -77,9 +167,82 @@ func TestCustomAuth_Decode(t *testing.T) {
 	}
 }
 
+func TestCustomAuth_rotation(t *testing.T) {
+	secretKey, secretKeyID, oldSecretKeys := config.SecretKey, config.SecretKeyID, config.OldSecretKeys
+	defer func() {
+		config.SecretKey, config.SecretKeyID, config.OldSecretKeys = secretKey, secretKeyID, oldSecretKeys
+	}()
+
+	config.SecretKey, config.SecretKeyID, config.OldSecretKeys = "old_secret_key_0", "0", nil
+	oldAuth, err := NewCustomAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := "26d1ac21-57d5-43ba-b2f7-08d36310aa07"
+	sequence, _ := oldAuth.Encode(&id)
+
+	config.SecretKey, config.SecretKeyID = "new_secret_key_1", "1"
+	config.OldSecretKeys = map[string]string{"0": "old_secret_key_0"}
+	newAuth, err := NewCustomAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := newAuth.Decode(sequence)
+	if !errors.Is(err, ErrOldKey) || got == nil || *got != id {
+		t.Fatalf("Decode() of old key sequence got = %v, error = %v", got, err)
+	}
+
+	sequence, _ = newAuth.Encode(got)
+	if got, err = newAuth.Decode(sequence); err != nil || *got != id {
+		t.Fatalf("Decode() of encoded again sequence got = %v, error = %v", got, err)
+	}
+}
+
+func TestNewCustomAuth(t *testing.T) {
+	secretKey, secretKeyID, oldSecretKeys := config.SecretKey, config.SecretKeyID, config.OldSecretKeys
+	defer func() {
+		config.SecretKey, config.SecretKeyID, config.OldSecretKeys = secretKey, secretKeyID, oldSecretKeys
+	}()
+
+	id := "26d1ac21-57d5-43ba-b2f7-08d36310aa07"
+	config.SecretKeyID, config.OldSecretKeys = "1", nil
+
+	config.SecretKey = "0123456789abcdef-first"
+	first, err := NewCustomAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config.SecretKey = "0123456789abcdef-second"
+	second, err := NewCustomAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sequence, _ := first.Encode(&id)
+	if _, err = second.Decode(sequence); err == nil {
+		t.Fatal("Decode() accepted sequence of key with the same first 16 bytes")
+	}
+
+	// sequence made before keys got derived with HKDF
+	legacyAuth := CustomAuth{NonceFunc: DefaultNonceFunc}
+	legacyAuth.algo, _ = newLegacyAEAD(config.SecretKey)
+	legacySequence, _ := legacyAuth.Encode(&id)
+	legacySequence = legacySequence[len("v2.."):]
+
+	got, err := second.Decode(legacySequence)
+	if !errors.Is(err, ErrOldKey) || got == nil || *got != id {
+		t.Fatalf("Decode() of legacy sequence got = %v, error = %v", got, err)
+	}
+}
+
 func TestCustomAuth_Encode(t *testing.T) {
 	type fields struct {
 		algo      cipher.AEAD
+		keyID     string
+		ttl       time.Duration
 		NonceFunc NonceFunc
 	}
 	type args struct {
@@ -96,13 +259,15 @@ func TestCustomAuth_Encode(t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name:   "happy path",
-			fields: fields{algo: TestAEAD{}, NonceFunc: func(_ int) ([]byte, error) { return []byte{1}, nil }},
-			args:   args{id: &id},
-			want: []byte{
-				77, 106, 90, 107, 77, 87, 70, 106, 77, 106, 69, 116, 78, 84, 100, 107, 78, 83, 48, 48, 77, 50, 74, 104,
-				76, 87, 73, 121, 90, 106, 99, 116, 77, 68, 104, 107, 77, 122, 89, 122, 77, 84, 66, 104, 89, 84, 65, 51,
-				65, 81},
+			name: "happy path",
+			fields: fields{
+				algo:      TestAEAD{},
+				keyID:     "1",
+				ttl:       time.Hour,
+				NonceFunc: func(_ int) ([]byte, error) { return []byte{1}, nil },
+			},
+			args:    args{id: &id},
+			want:    testSequence("v2.1.", `{"sub":"`+id+`","iat":1700000000,"exp":1700003600}`),
 			wantErr: false,
 		},
 	}
@@ -111,7 +276,10 @@ func TestCustomAuth_Encode(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			auth := CustomAuth{
 				algo:      tt.fields.algo,
+				keyID:     tt.fields.keyID,
+				ttl:       tt.fields.ttl,
 				NonceFunc: tt.fields.NonceFunc,
+				NowFunc:   func() time.Time { return time.Unix(1700000000, 0) },
 			}
 
 			got, err := auth.Encode(tt.args.id)
@@ -181,3 +349,86 @@ func TestDefaultNonceFunc(t *testing.T) {
 		})
 	}
 }
+
+// testStore keeps sessions in map, revoked sessions are removed.
+type testStore map[string]Session
+
+func (s testStore) Create(_ context.Context, session Session) error {
+	s[session.ID] = session
+	return nil
+}
+
+func (s testStore) Find(_ context.Context, id string) (*Session, error) {
+	session, ok := s[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return &session, nil
+}
+
+func (s testStore) Touch(_ context.Context, id string, lastSeenAt time.Time, expiresAt *time.Time) error {
+	session := s[id]
+	session.LastSeenAt, session.ExpiresAt = lastSeenAt, expiresAt
+	s[id] = session
+
+	return nil
+}
+
+func TestCustomAuth_sessions(t *testing.T) {
+	store := testStore{}
+	now := time.Unix(1700000000, 0)
+	auth := CustomAuth{
+		algo:        TestAEAD{},
+		keyID:       "1",
+		ttl:         time.Hour,
+		renewBefore: time.Minute,
+		NonceFunc:   DefaultNonceFunc,
+		NowFunc:     func() time.Time { return now },
+		Sessions:    store,
+		legacyUntil: now.Add(time.Hour),
+	}
+
+	id := "26d1ac21-57d5-43ba-b2f7-08d36310aa07"
+	session := &Session{UserID: &id, UserAgent: "test agent"}
+
+	sequence, err := auth.EncodeSession(context.TODO(), session)
+	if err != nil || session.ID == "" || len(store) != 1 {
+		t.Fatalf("EncodeSession() did not store session, error = %v", err)
+	}
+
+	got, err := auth.DecodeSession(context.TODO(), sequence)
+	if err != nil || got.ID != session.ID || *got.UserID != id || got.UserAgent != "test agent" {
+		t.Fatalf("DecodeSession() got = %v, error = %v", got, err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err = auth.DecodeSession(context.TODO(), sequence); err != nil {
+		t.Fatalf("DecodeSession() error = %v", err)
+	}
+
+	if !store[session.ID].LastSeenAt.Equal(now) {
+		t.Errorf("DecodeSession() did not update last seen time")
+	}
+
+	stateless, _ := auth.Encode(&id)
+	if got, err = auth.DecodeSession(context.TODO(), stateless); !errors.Is(err, ErrNoSession) || *got.UserID != id {
+		t.Errorf("DecodeSession() of sequence without session got = %v, error = %v", got, err)
+	}
+
+	auth.legacyUntil = now
+	if got, err = auth.DecodeSession(context.TODO(), stateless); !errors.Is(err, ErrLegacyExpired) || got != nil {
+		t.Errorf("DecodeSession() of sequence without session after migration window got = %v, error = %v", got, err)
+	}
+
+	delete(store, session.ID)
+	if got, err = auth.DecodeSession(context.TODO(), sequence); !errors.Is(err, ErrRevoked) || got != nil {
+		t.Errorf("DecodeSession() of revoked session got = %v, error = %v", got, err)
+	}
+
+	other := "other_user_id"
+	store[session.ID] = Session{ID: session.ID, UserID: &other}
+	if _, err = auth.DecodeSession(context.TODO(), sequence); !errors.Is(err, ErrRevoked) {
+		t.Errorf("DecodeSession() of session of other user error = %v", err)
+	}
+}
@@ -2,7 +2,12 @@
 
 package mocks
 
-import mock "github.com/stretchr/testify/mock"
+import (
+	context "context"
+
+	auth "github.com/magmel48/go-web/internal/auth"
+	mock "github.com/stretchr/testify/mock"
+)
 
 // Auth is an autogenerated mock type for the Auth type
 type Auth struct {
@@ -54,3 +59,49 @@ func (_m *Auth) Encode(id *string) ([]byte, error) {
 
 	return r0, r1
 }
+
+// DecodeSession provides a mock function with given fields: ctx, sequence
+func (_m *Auth) DecodeSession(ctx context.Context, sequence []byte) (*auth.Session, error) {
+	ret := _m.Called(ctx, sequence)
+
+	var r0 *auth.Session
+	if rf, ok := ret.Get(0).(func(context.Context, []byte) *auth.Session); ok {
+		r0 = rf(ctx, sequence)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*auth.Session)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, []byte) error); ok {
+		r1 = rf(ctx, sequence)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// EncodeSession provides a mock function with given fields: ctx, session
+func (_m *Auth) EncodeSession(ctx context.Context, session *auth.Session) ([]byte, error) {
+	ret := _m.Called(ctx, session)
+
+	var r0 []byte
+	if rf, ok := ret.Get(0).(func(context.Context, *auth.Session) []byte); ok {
+		r0 = rf(ctx, session)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]byte)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *auth.Session) error); ok {
+		r1 = rf(ctx, session)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNoSession is returned together with session of valid user identifier when the sequence is made before
+// sessions were stored, the sequence should be encoded again to get stored session.
+var ErrNoSession = fmt.Errorf("%w: sequence has no session", ErrRenewal)
+
+// ErrRevoked is returned when session of the sequence is revoked, expired or unknown.
+var ErrRevoked = errors.New("session is revoked")
+
+// Session is login of the user on one device, it is stored on the server only if SessionStore is set.
+type Session struct {
+	// ID is empty for sessions that are not stored.
+	ID         string
+	UserID     UserID
+	UserAgent  string
+	IP         string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	// ExpiresAt is nil for sessions that never expire.
+	ExpiresAt *time.Time
+}
+
+// SessionStore keeps sessions on the server, so they can be revoked.
+//go:generate mockery --name=SessionStore
+type SessionStore interface {
+	Create(ctx context.Context, session Session) error
+	// Find returns not revoked session, nil means there is no such session.
+	Find(ctx context.Context, id string) (*Session, error)
+	Touch(ctx context.Context, id string, lastSeenAt time.Time, expiresAt *time.Time) error
+}
+
+// IsExpired says if the session is expired at the time.
+func (session Session) IsExpired(now time.Time) bool {
+	return session.ExpiresAt != nil && !now.Before(*session.ExpiresAt)
+}
@@ -0,0 +1,128 @@
+// Package canonical brings URLs to canonical form, so equal URLs written differently are shortened once.
+package canonical
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// defaultPorts are ports that are dropped from URLs of their schemes.
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// TrackingParams are query parameters that only track clients and do not change the page.
+// Parameters ending with "*" match by prefix.
+var TrackingParams = []string{
+	"utm_*", "fbclid", "gclid", "dclid", "gbraid", "wbraid", "msclkid", "yclid", "igshid", "mc_cid", "mc_eid", "_ga",
+}
+
+// Options are optional canonicalization steps that can change meaning of a URL for some sites.
+type Options struct {
+	// SortQuery orders query parameters by name keeping order of values of the same parameter.
+	SortQuery bool
+	// StripTracking removes TrackingParams from query.
+	StripTracking bool
+}
+
+// Canonicalize lowercases scheme and host, converts internationalized host into punycode, percent-encodes
+// non-ASCII path, drops default port and turns empty path into "/".
+// Query is changed only if options say so, the original encoding of kept parameters is preserved.
+func Canonicalize(rawURL string, options Options) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = strings.ToLower(parsed.Host)
+
+	if !isASCII(parsed.Host) {
+		host, err := HostToASCII(parsed.Hostname())
+		if err != nil {
+			return "", err
+		}
+
+		if port := parsed.Port(); port != "" {
+			host += ":" + port
+		}
+
+		parsed.Host = host
+	}
+
+	if port := parsed.Port(); port != "" && defaultPorts[parsed.Scheme] == port {
+		parsed.Host = strings.TrimSuffix(parsed.Host, ":"+port)
+	}
+
+	if parsed.Host != "" && parsed.Path == "" && parsed.Opaque == "" {
+		parsed.Path = "/"
+		parsed.RawPath = ""
+	}
+
+	if parsed.RawQuery != "" && (options.SortQuery || options.StripTracking) {
+		parsed.RawQuery = canonicalQuery(parsed.RawQuery, options)
+	}
+
+	// URL with empty query ending with "?" is the same as URL without it
+	parsed.ForceQuery = false
+
+	return parsed.String(), nil
+}
+
+// canonicalQuery strips tracking parameters and sorts raw query without re-encoding its pairs.
+func canonicalQuery(rawQuery string, options Options) string {
+	type pair struct {
+		key string
+		raw string
+	}
+
+	pairs := make([]pair, 0)
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+
+		key := raw
+		if i := strings.Index(raw, "="); i >= 0 {
+			key = raw[:i]
+		}
+
+		if unescaped, err := url.QueryUnescape(key); err == nil {
+			key = unescaped
+		}
+
+		if options.StripTracking && isTrackingParam(key) {
+			continue
+		}
+
+		pairs = append(pairs, pair{key: key, raw: raw})
+	}
+
+	if options.SortQuery {
+		sort.SliceStable(pairs, func(i, j int) bool {
+			return pairs[i].key < pairs[j].key
+		})
+	}
+
+	result := make([]string, len(pairs))
+	for i, p := range pairs {
+		result[i] = p.raw
+	}
+
+	return strings.Join(result, "&")
+}
+
+// isTrackingParam checks if query parameter is one of TrackingParams.
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	for _, param := range TrackingParams {
+		if strings.HasSuffix(param, "*") {
+			if strings.HasPrefix(key, strings.TrimSuffix(param, "*")) {
+				return true
+			}
+		} else if key == param {
+			return true
+		}
+	}
+
+	return false
+}
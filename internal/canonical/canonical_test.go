@@ -0,0 +1,63 @@
+package canonical
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		options Options
+		want    string
+	}{
+		{name: "should lowercase scheme and host", url: "HTTPS://Example.COM/Path", want: "https://example.com/Path"},
+		{name: "should add root path", url: "https://example.com", want: "https://example.com/"},
+		{name: "should drop default port", url: "https://example.com:443/", want: "https://example.com/"},
+		{name: "should keep other port", url: "http://example.com:8080", want: "http://example.com:8080/"},
+		{name: "should drop empty query", url: "https://example.com/?", want: "https://example.com/"},
+		{
+			name: "should keep query as is by default",
+			url:  "https://example.com/?b=2&utm_source=x&a=%20",
+			want: "https://example.com/?b=2&utm_source=x&a=%20",
+		},
+		{
+			name:    "should sort query",
+			url:     "https://example.com/?b=2&a=1&b=1",
+			options: Options{SortQuery: true},
+			want:    "https://example.com/?a=1&b=2&b=1",
+		},
+		{
+			name:    "should strip tracking params",
+			url:     "https://example.com/?id=1&UTM_Source=x&fbclid=y",
+			options: Options{StripTracking: true},
+			want:    "https://example.com/?id=1",
+		},
+		{
+			name:    "should keep fragment",
+			url:     "https://example.com/app?gclid=1#/home",
+			options: Options{StripTracking: true},
+			want:    "https://example.com/app#/home",
+		},
+		{name: "should convert host to punycode", url: "https://Bücher.de/", want: "https://xn--bcher-kva.de/"},
+		{
+			name: "should keep port of internationalized host",
+			url:  "http://пример.рф:8080/",
+			want: "http://xn--e1afmkfd.xn--p1ai:8080/",
+		},
+		{
+			name: "should percent-encode non-ascii path",
+			url:  "https://example.com/путь/1",
+			want: "https://example.com/%D0%BF%D1%83%D1%82%D1%8C/1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Canonicalize(tt.url, tt.options)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
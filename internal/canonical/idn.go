@@ -0,0 +1,198 @@
+package canonical
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// acePrefix marks punycode labels of internationalized domain names.
+const acePrefix = "xn--"
+
+// Forms are two forms of the same URL: ASCII one (punycode host, percent-encoded path) is stored and used for
+// redirects, Unicode one is for showing to people.
+type Forms struct {
+	ASCII   string
+	Unicode string
+	// MixedScriptLabels are host labels mixing letters of different scripts, e.g. Latin and Cyrillic,
+	// they often imitate other domains.
+	MixedScriptLabels []string
+}
+
+// HostToASCII converts internationalized host into punycode, ASCII hosts are only lowercased.
+func HostToASCII(host string) (string, error) {
+	if isASCII(host) {
+		return strings.ToLower(host), nil
+	}
+
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return "", fmt.Errorf("host %q: %w", host, err)
+	}
+
+	return ascii, nil
+}
+
+// HostToUnicode converts punycode labels of host back into Unicode, invalid labels are kept as is.
+func HostToUnicode(host string) string {
+	labels := strings.Split(host, ".")
+	for i, label := range labels {
+		if !strings.HasPrefix(strings.ToLower(label), acePrefix) {
+			continue
+		}
+
+		if decoded, err := idna.Lookup.ToUnicode(label); err == nil {
+			labels[i] = decoded
+		}
+	}
+
+	return strings.Join(labels, ".")
+}
+
+// URLForms canonicalizes URL and returns its ASCII and Unicode forms.
+func URLForms(rawURL string, options Options) (Forms, error) {
+	ascii, err := Canonicalize(rawURL, options)
+	if err != nil {
+		return Forms{}, err
+	}
+
+	parsed, err := url.Parse(ascii)
+	if err != nil {
+		return Forms{}, err
+	}
+
+	return Forms{
+		ASCII:             ascii,
+		Unicode:           unicodeForm(parsed),
+		MixedScriptLabels: MixedScriptLabels(HostToUnicode(parsed.Hostname())),
+	}, nil
+}
+
+// URLToUnicode returns Unicode form of stored ASCII URL, URL that cannot be parsed is returned as is.
+func URLToUnicode(asciiURL string) string {
+	parsed, err := url.Parse(asciiURL)
+	if err != nil {
+		return asciiURL
+	}
+
+	return unicodeForm(parsed)
+}
+
+// unicodeForm puts URL together with Unicode host and unescaped path.
+func unicodeForm(parsed *url.URL) string {
+	// Unicode form is not a valid URL, so it is put together by hand without escaping
+	unicodeHost := HostToUnicode(parsed.Hostname())
+	if port := parsed.Port(); port != "" {
+		unicodeHost += ":" + port
+	}
+
+	path := parsed.EscapedPath()
+	if unescaped, err := url.PathUnescape(path); err == nil && utf8.ValidString(unescaped) {
+		path = unescaped
+	}
+
+	result := parsed.Scheme + "://" + unicodeHost + path
+	if parsed.RawQuery != "" {
+		result += "?" + parsed.RawQuery
+	}
+
+	if parsed.Fragment != "" {
+		result += "#" + parsed.EscapedFragment()
+	}
+
+	return result
+}
+
+// compatibleScripts are scripts that are normally mixed in one word, e.g. Japanese uses Han with kana.
+var compatibleScripts = map[string][]string{
+	"Han":      {"Hiragana", "Katakana", "Hangul", "Bopomofo"},
+	"Hiragana": {"Han", "Katakana"},
+	"Katakana": {"Han", "Hiragana"},
+	"Hangul":   {"Han"},
+	"Bopomofo": {"Han"},
+}
+
+// MixedScriptLabels returns labels of Unicode host that mix letters of incompatible scripts.
+func MixedScriptLabels(host string) []string {
+	result := make([]string, 0)
+	for _, label := range strings.Split(host, ".") {
+		if isMixedScript(label) {
+			result = append(result, label)
+		}
+	}
+
+	return result
+}
+
+// isMixedScript checks if label has letters of incompatible scripts, digits and hyphens belong to any script.
+func isMixedScript(label string) bool {
+	scripts := make([]string, 0)
+	for _, r := range label {
+		script := scriptOf(r)
+		if script == "" {
+			continue
+		}
+
+		for _, seen := range scripts {
+			if seen != script && !isCompatibleScript(seen, script) {
+				return true
+			}
+		}
+
+		if !containsString(scripts, script) {
+			scripts = append(scripts, script)
+		}
+	}
+
+	return false
+}
+
+// scriptOf returns name of the script of letter, empty for common characters like digits and punctuation.
+func scriptOf(r rune) string {
+	if r < utf8.RuneSelf && !unicode.IsLetter(r) {
+		return ""
+	}
+
+	for name, table := range unicode.Scripts {
+		if name == "Common" || name == "Inherited" {
+			continue
+		}
+
+		if unicode.Is(table, r) {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// isCompatibleScript checks if letters of two scripts can be mixed in one label.
+func isCompatibleScript(a string, b string) bool {
+	return containsString(compatibleScripts[a], b)
+}
+
+// containsString checks if list has the item.
+func containsString(list []string, item string) bool {
+	for _, el := range list {
+		if el == item {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isASCII checks if s has only ASCII characters.
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,95 @@
+package canonical
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestHostToASCII(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		want string
+	}{
+		{name: "should keep ascii host", host: "Example.com", want: "example.com"},
+		{name: "should encode every label", host: "пример.рф", want: "xn--e1afmkfd.xn--p1ai"},
+		{name: "should keep basic characters", host: "bücher.de", want: "xn--bcher-kva.de"},
+		{name: "should normalize label", host: "bücher.de", want: "xn--bcher-kva.de"},
+		{name: "should encode japanese label", host: "例え.jp", want: "xn--r8jz45g.jp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := HostToASCII(tt.host)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestHostToUnicode(t *testing.T) {
+	assert.Equal(t, "пример.рф", HostToUnicode("xn--e1afmkfd.xn--p1ai"))
+	assert.Equal(t, "bücher.de", HostToUnicode("XN--bcher-kva.de"))
+	assert.Equal(t, "xn--!.de", HostToUnicode("xn--!.de"))
+}
+
+func TestURLForms(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want Forms
+	}{
+		{
+			name: "should return both forms",
+			url:  "https://пример.рф/путь?q=1",
+			want: Forms{
+				ASCII:             "https://xn--e1afmkfd.xn--p1ai/%D0%BF%D1%83%D1%82%D1%8C?q=1",
+				Unicode:           "https://пример.рф/путь?q=1",
+				MixedScriptLabels: []string{},
+			},
+		},
+		{
+			name: "should find mixed script labels",
+			url:  "https://pаypal.com/",
+			want: Forms{
+				ASCII:             "https://xn--pypal-4ve.com/",
+				Unicode:           "https://pаypal.com/",
+				MixedScriptLabels: []string{"pаypal"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := URLForms(tt.url, Options{})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestURLToUnicode(t *testing.T) {
+	assert.Equal(t, "https://пример.рф/путь?q=1", URLToUnicode("https://xn--e1afmkfd.xn--p1ai/%D0%BF%D1%83%D1%82%D1%8C?q=1"))
+	assert.Equal(t, "https://google.com", URLToUnicode("https://google.com"))
+	assert.Equal(t, "%zz", URLToUnicode("%zz"))
+}
+
+func TestMixedScriptLabels(t *testing.T) {
+	tests := []struct {
+		name string
+		host string
+		want []string
+	}{
+		{name: "should accept latin host", host: "example-1.com", want: []string{}},
+		{name: "should accept cyrillic host", host: "пример.рф", want: []string{}},
+		{name: "should accept japanese host", host: "東京タワー.jp", want: []string{}},
+		{name: "should flag latin with cyrillic", host: "аpple.com", want: []string{"аpple"}},
+		{name: "should flag latin with greek", host: "gοοgle.com", want: []string{"gοοgle"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, MixedScriptLabels(tt.host))
+		})
+	}
+}
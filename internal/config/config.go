@@ -1,13 +1,81 @@
 package config
 
 import (
+	"encoding/base64"
+	"errors"
 	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var defaultProtocol = "http://"
 
+// defaultMaxURLLength is enough for long query strings and still keeps the database safe from abuse
+const defaultMaxURLLength = 32 * 1024
+
+// defaultSecretKeyID is identifier of the secret key if it is not configured
+const defaultSecretKeyID = "1"
+
+// defaultSecretKey is for development only, the service refuses to start with it in production
+const defaultSecretKey = "secret_key"
+
+// minSecretKeyLength is minimal length of secret keys in production, 32 bytes are enough for AES-256
+const minSecretKeyLength = 32
+
+// defaultSessionTTL is lifetime of session cookies, active users get new ones before it ends
+const defaultSessionTTL = 30 * 24 * time.Hour
+
+// defaultLegacySessionsUntil ends migration window of legacy session cookies, it is
+// a fixed date, so restarts do not prolong the window
+const defaultLegacySessionsUntil = "2027-04-19T00:00:00Z"
+
+// SameSite values of session cookies.
+const (
+	SameSiteLax    = "lax"
+	SameSiteStrict = "strict"
+	SameSiteNone   = "none"
+)
+
+// Defaults of CORS settings, they are what the API is called with.
+const (
+	defaultCORSMethods = "GET,HEAD,POST,PUT,DELETE"
+	defaultCORSHeaders = "Authorization,Content-Type,Content-Encoding"
+	defaultCORSMaxAge  = 10 * time.Minute
+)
+
+// CORSAnyOrigin allows requests from any origin, it cannot be used with credentials.
+const CORSAnyOrigin = "*"
+
+// oidcCallbackPath is path of OpenID Connect callback, it is the default redirect URL on the base URL.
+const oidcCallbackPath = "/api/auth/oidc/callback"
+
+// Session stores keep sessions on the server, so they can be listed and revoked.
+const (
+	// SessionStoreCookie keeps sessions in cookies only, they cannot be revoked.
+	SessionStoreCookie = "cookie"
+	// SessionStorePostgres keeps sessions in the database.
+	SessionStorePostgres = "postgres"
+	// SessionStoreMemory keeps sessions in memory of a single instance, they are lost on restart.
+	SessionStoreMemory = "memory"
+)
+
+// base64Prefix marks secret keys that are given in base64, e.g. "base64:c2VjcmV0".
+const base64Prefix = "base64:"
+
+// Homograph policies say what to do with hosts mixing letters of different scripts.
+const (
+	// HomographReject rejects such URLs.
+	HomographReject = "reject"
+	// HomographWarn accepts such URLs with a warning in API response.
+	HomographWarn = "warn"
+)
+
 var (
 	// Address where the server starts their job
 	Address string
@@ -17,10 +85,85 @@ var (
 	BaseShortenerURL string
 	// FilePath is deprecated, previously was using for storing backup
 	FilePath string
+	// Production turns on checks that are too strict for development, e.g. of secret key strength
+	Production bool
 	// SecretKey is secret character sequence that is using for encoding/decoding user identifiers
 	SecretKey string
+	// SecretKeyID identifies SecretKey in encoded user identifiers, so the key can be rotated
+	SecretKeyID string
+	// OldSecretKeys are previous secret keys by their identifiers, they are accepted until users get new cookies
+	OldSecretKeys map[string]string
+	// SessionTTL is lifetime of session cookies
+	SessionTTL time.Duration
+	// SessionRenewBefore is time before session cookie expiration when it is renewed, half of SessionTTL by default
+	SessionRenewBefore time.Duration
+	// LegacySessionsUntil is the end of migration window of session cookies made without claims or, if sessions
+	// are stored, without session, they are encoded again until then, defaultLegacySessionsUntil by default
+	// and zero means they are not accepted
+	LegacySessionsUntil time.Time
+	// SessionStore is SessionStoreCookie, SessionStorePostgres or SessionStoreMemory
+	SessionStore string
+	// CookieSecure sends session cookies over HTTPS only, it is on by default for HTTPS base URL
+	CookieSecure bool
+	// CookieSameSite is SameSiteLax, SameSiteStrict or SameSiteNone, the last one requires CookieSecure
+	CookieSameSite string
+	// CookieDomain is domain of session cookies, empty means the host of requests only
+	CookieDomain string
+	// CSRFTrustedOrigins are origins (e.g. https://app.example.com) of other sites that can send state-changing
+	// requests with session cookies, the origin of the base URL is always trusted
+	CSRFTrustedOrigins []string
+	// CORSAllowedOrigins are origins that can call the API from browsers, empty list turns CORS off
+	CORSAllowedOrigins []string
+	// CORSAllowedMethods are methods of cross-origin requests, uppercase
+	CORSAllowedMethods []string
+	// CORSAllowedHeaders are request headers of cross-origin requests, lowercase
+	CORSAllowedHeaders []string
+	// CORSAllowCredentials lets cross-origin requests use session cookies, it requires SameSite=None secure cookies
+	CORSAllowCredentials bool
+	// CORSMaxAge is how long browsers cache responses to preflight requests
+	CORSMaxAge time.Duration
 	// DatabaseDSN is database connection string
 	DatabaseDSN string
+	// DefaultRedirectType is HTTP status code for redirects of links created without explicit redirect type
+	DefaultRedirectType int
+	// CountryHeader is request header with client country code set by a geo-aware proxy (e.g. CF-IPCountry)
+	CountryHeader string
+	// TrustedDomains are destinations (with their subdomains) that are redirected without a warning
+	TrustedDomains []string
+	// TrustMinLinkAge is how old a link should be to be redirected without a warning
+	TrustMinLinkAge time.Duration
+	// TrustMinOwnerAge is how long ago the link owner should have made their first link to be redirected without
+	// a warning, the owner should have an account too
+	TrustMinOwnerAge time.Duration
+	// AdminToken grants access to admin endpoints, empty value turns them off
+	AdminToken string
+	// AllowedSchemes are URL schemes that can be used for link destinations, empty means http and https only
+	AllowedSchemes []string
+	// OtherShorteners are domains of other URL shorteners, their links cannot be shortened
+	OtherShorteners []string
+	// BlockPrivateAddresses rejects link destinations with literal loopback and private network IP addresses
+	BlockPrivateAddresses bool
+	// BlocklistPath is file with domains that cannot be link destinations (plain list or hosts file)
+	BlocklistPath string
+	// AllowlistPath is file with domains that are never blocked even if they match the blocklist, it requires
+	// BlocklistPath
+	AllowlistPath string
+	// SortQuery orders query parameters of original URLs before searching for the same link shortened before
+	SortQuery bool
+	// MaxURLLength is maximal length of original URLs
+	MaxURLLength int
+	// StripTrackingParams removes tracking query parameters (utm_*, fbclid, etc.) from original URLs
+	StripTrackingParams bool
+	// HomographPolicy is HomographReject or HomographWarn
+	HomographPolicy string
+	// OIDCIssuerURL is URL of OpenID Connect provider, empty value turns login with the provider off
+	OIDCIssuerURL string
+	// OIDCClientID is identifier of the service at OpenID Connect provider
+	OIDCClientID string
+	// OIDCClientSecret is secret of the service at OpenID Connect provider
+	OIDCClientSecret string
+	// OIDCRedirectURL is where OpenID Connect provider sends users back, callback on the base URL by default
+	OIDCRedirectURL string
 )
 
 // Parse parses flags and gets default values for them from environment variables. Hides details of envs ingestion.
@@ -28,10 +171,89 @@ func Parse() {
 	flag.StringVar(&Address, "a", os.Getenv("SERVER_ADDRESS"), "server address")
 	flag.StringVar(&BaseShortenerURL, "b", os.Getenv("BASE_URL"), "base url for shortened urls")
 	flag.StringVar(&FilePath, "f", os.Getenv("FILE_STORAGE_PATH"), "file path for shortened links")
-	flag.StringVar(&SecretKey, "s", os.Getenv("SECRET_KEY"), "secret key for sessions")
+	flag.BoolVar(&Production, "production", os.Getenv("PRODUCTION") == "true", "production mode")
+	flag.StringVar(&SecretKey, "s", os.Getenv("SECRET_KEY"), "secret key for sessions, base64: prefix for binary keys")
+	secretKeyFile := flag.String("secret-key-file", os.Getenv("SECRET_KEY_FILE"), "file with secret key for sessions")
+	secretKeyBase64 := flag.String(
+		"secret-key-base64", os.Getenv("SECRET_KEY_BASE64"), "base64 encoded secret key for sessions")
+	flag.StringVar(&SecretKeyID, "secret-key-id", os.Getenv("SECRET_KEY_ID"), "identifier of secret key")
+	oldSecretKeys := flag.String(
+		"old-secret-keys",
+		os.Getenv("OLD_SECRET_KEYS"),
+		"comma separated previous secret keys as id:key, base64: prefix for binary keys")
+	flag.DurationVar(&SessionTTL, "session-ttl", durationFromEnv("SESSION_TTL"), "lifetime of session cookies")
+	flag.DurationVar(
+		&SessionRenewBefore,
+		"session-renew-before",
+		durationFromEnv("SESSION_RENEW_BEFORE"),
+		"time before session cookie expiration to renew it")
+	legacySessionsUntil := flag.String(
+		"legacy-sessions-until",
+		os.Getenv("LEGACY_SESSIONS_UNTIL"),
+		"RFC 3339 time until legacy session cookies are accepted to be renewed")
+	flag.StringVar(
+		&SessionStore, "session-store", os.Getenv("SESSION_STORE"), "where sessions are kept: cookie, postgres, memory")
+	cookieSecure := flag.String(
+		"cookie-secure", os.Getenv("COOKIE_SECURE"), "send session cookies over https only: true or false")
+	flag.StringVar(
+		&CookieSameSite, "cookie-samesite", os.Getenv("COOKIE_SAMESITE"), "SameSite of session cookies: lax, strict, none")
+	flag.StringVar(&CookieDomain, "cookie-domain", os.Getenv("COOKIE_DOMAIN"), "domain of session cookies")
+	csrfTrustedOrigins := flag.String(
+		"csrf-trusted-origins", os.Getenv("CSRF_TRUSTED_ORIGINS"), "comma separated origins trusted for CSRF checks")
+	corsAllowedOrigins := flag.String(
+		"cors-allowed-origins", os.Getenv("CORS_ALLOWED_ORIGINS"), "comma separated origins allowed by CORS or *")
+	corsAllowedMethods := flag.String(
+		"cors-allowed-methods", os.Getenv("CORS_ALLOWED_METHODS"), "comma separated methods allowed by CORS")
+	corsAllowedHeaders := flag.String(
+		"cors-allowed-headers", os.Getenv("CORS_ALLOWED_HEADERS"), "comma separated request headers allowed by CORS")
+	flag.BoolVar(
+		&CORSAllowCredentials, "cors-allow-credentials", os.Getenv("CORS_ALLOW_CREDENTIALS") == "true",
+		"allow cookies in cross-origin requests")
+	flag.DurationVar(&CORSMaxAge, "cors-max-age", durationFromEnv("CORS_MAX_AGE"), "lifetime of CORS preflight cache")
 	flag.StringVar(&DatabaseDSN, "d", os.Getenv("DATABASE_DSN"), "database connection string")
+	flag.IntVar(&DefaultRedirectType, "r", intFromEnv("REDIRECT_TYPE"), "default redirect status code")
+	flag.StringVar(&CountryHeader, "country-header", os.Getenv("COUNTRY_HEADER"), "request header with client country")
+	trustedDomains := flag.String("trusted-domains", os.Getenv("TRUSTED_DOMAINS"), "comma separated trusted domains")
+	flag.DurationVar(
+		&TrustMinLinkAge, "trust-min-link-age", durationFromEnv("TRUST_MIN_LINK_AGE"), "minimal age of a trusted link")
+	flag.DurationVar(
+		&TrustMinOwnerAge, "trust-min-owner-age", durationFromEnv("TRUST_MIN_OWNER_AGE"), "minimal age of a trusted owner")
+	flag.StringVar(&AdminToken, "admin-token", os.Getenv("ADMIN_TOKEN"), "token for admin endpoints")
+	allowedSchemes := flag.String("allowed-schemes", os.Getenv("ALLOWED_SCHEMES"), "comma separated allowed url schemes")
+	otherShorteners := flag.String(
+		"other-shorteners", os.Getenv("OTHER_SHORTENERS"), "comma separated domains of other shorteners")
+	flag.BoolVar(
+		&BlockPrivateAddresses,
+		"block-private-addresses",
+		os.Getenv("BLOCK_PRIVATE_ADDRESSES") == "true",
+		"reject private network addresses")
+	flag.StringVar(&BlocklistPath, "blocklist", os.Getenv("BLOCKLIST_FILE"), "file with blocked domains")
+	flag.StringVar(&AllowlistPath, "allowlist", os.Getenv("ALLOWLIST_FILE"), "file with never blocked domains")
+	flag.IntVar(&MaxURLLength, "max-url-length", intFromEnv("MAX_URL_LENGTH"), "maximal length of original urls")
+	flag.BoolVar(&SortQuery, "sort-query", os.Getenv("SORT_QUERY") == "true", "sort query parameters of urls")
+	flag.BoolVar(
+		&StripTrackingParams,
+		"strip-tracking-params",
+		os.Getenv("STRIP_TRACKING_PARAMS") == "true",
+		"remove tracking query parameters from urls")
+	flag.StringVar(
+		&HomographPolicy, "homograph-policy", os.Getenv("HOMOGRAPH_POLICY"), "reject or warn about mixed script hosts")
+	flag.StringVar(&OIDCIssuerURL, "oidc-issuer", os.Getenv("OIDC_ISSUER_URL"), "OpenID Connect provider url")
+	flag.StringVar(&OIDCClientID, "oidc-client-id", os.Getenv("OIDC_CLIENT_ID"), "OpenID Connect client identifier")
+	flag.StringVar(
+		&OIDCClientSecret, "oidc-client-secret", os.Getenv("OIDC_CLIENT_SECRET"), "OpenID Connect client secret")
+	flag.StringVar(
+		&OIDCRedirectURL, "oidc-redirect-url", os.Getenv("OIDC_REDIRECT_URL"), "OpenID Connect redirect url")
 	flag.Parse()
 
+	TrustedDomains = splitList(*trustedDomains)
+	OtherShorteners = splitList(*otherShorteners)
+	AllowedSchemes = splitList(*allowedSchemes)
+	CSRFTrustedOrigins = splitList(*csrfTrustedOrigins)
+	CORSAllowedOrigins = splitList(*corsAllowedOrigins)
+	CORSAllowedMethods = splitList(*corsAllowedMethods)
+	CORSAllowedHeaders = splitList(*corsAllowedHeaders)
+
 	if Address == "" {
 		Address = "localhost:8080"
 	}
@@ -51,11 +273,327 @@ func Parse() {
 		}
 	}
 
+	if MaxURLLength == 0 {
+		MaxURLLength = defaultMaxURLLength
+	}
+
 	if FilePath == "" {
 		FilePath = "backup.txt"
 	}
 
+	if err := loadSecretKey(*secretKeyFile, *secretKeyBase64); err != nil {
+		log.Fatalf("cannot load secret key: %v", err)
+	}
+
+	if SecretKeyID == "" {
+		SecretKeyID = defaultSecretKeyID
+	}
+
+	var err error
+	if OldSecretKeys, err = parseKeys(*oldSecretKeys); err != nil {
+		log.Fatalf("cannot load old secret keys: %v", err)
+	}
+
+	for keyID, secret := range OldSecretKeys {
+		if keyID == SecretKeyID || strings.Contains(keyID, ".") {
+			log.Fatalf("wrong old secret key identifier %s", keyID)
+		}
+
+		if err := checkSecretStrength(secret); err != nil {
+			log.Fatalf("wrong old secret key %s: %v", keyID, err)
+		}
+	}
+
+	if strings.Contains(SecretKeyID, ".") {
+		log.Fatalf("wrong secret key identifier %s", SecretKeyID)
+	}
+
+	// CORS settings go first, credentials change the default SameSite of session cookies
+	if err := parseCORSSettings(); err != nil {
+		log.Fatalf("wrong CORS settings: %v", err)
+	}
+
+	if err := parseCookieSettings(*cookieSecure); err != nil {
+		log.Fatalf("wrong session cookie settings: %v", err)
+	}
+
+	if *legacySessionsUntil == "" {
+		*legacySessionsUntil = defaultLegacySessionsUntil
+	}
+
+	if LegacySessionsUntil, err = time.Parse(time.RFC3339, *legacySessionsUntil); err != nil {
+		log.Fatalf("wrong legacy sessions deadline: %v", err)
+	}
+
+	if err := parseOrigins(CSRFTrustedOrigins); err != nil {
+		log.Fatalf("wrong CSRF trusted origins: %v", err)
+	}
+
+	if err := parseOIDCSettings(); err != nil {
+		log.Fatalf("wrong OpenID Connect settings: %v", err)
+	}
+
+	// allowlist only makes exceptions of the blocklist
+	if AllowlistPath != "" && BlocklistPath == "" {
+		log.Fatalf("allowlist %s is set without blocklist", AllowlistPath)
+	}
+
+	switch HomographPolicy {
+	case "":
+		HomographPolicy = HomographReject
+	case HomographReject, HomographWarn:
+	default:
+		log.Fatalf("unsupported homograph policy %s", HomographPolicy)
+	}
+
+	switch DefaultRedirectType {
+	case 0:
+		DefaultRedirectType = http.StatusTemporaryRedirect
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		log.Fatalf("unsupported redirect type %d", DefaultRedirectType)
+	}
+}
+
+// durationFromEnv returns duration value of specified environment variable or zero if it is not set or malformed.
+func durationFromEnv(key string) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return 0
+	}
+
+	return value
+}
+
+// loadSecretKey sets SecretKey from file, base64 value or SecretKey itself in that order and checks its strength.
+func loadSecretKey(path string, base64Value string) error {
+	switch {
+	case path != "":
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		SecretKey = strings.TrimRight(string(content), "\r\n")
+	case base64Value != "":
+		SecretKey = base64Prefix + base64Value
+	}
+
+	var err error
+	if SecretKey, err = decodeSecret(SecretKey); err != nil {
+		return err
+	}
+
 	if SecretKey == "" {
-		SecretKey = "secret_key"
+		SecretKey = defaultSecretKey
+	}
+
+	return checkSecretStrength(SecretKey)
+}
+
+// checkSecretStrength rejects default and short secret keys in production, elsewhere they are only reported.
+func checkSecretStrength(secret string) error {
+	if secret == defaultSecretKey || len(secret) < minSecretKeyLength {
+		if Production {
+			return fmt.Errorf("secret key must not be default and must have at least %d bytes", minSecretKeyLength)
+		}
+
+		log.Println("weak secret key is used, it is not allowed in production")
+	}
+
+	return nil
+}
+
+// parseCookieSettings sets defaults of session cookie settings and checks them.
+func parseCookieSettings(secure string) error {
+	if SessionTTL == 0 {
+		SessionTTL = defaultSessionTTL
+	}
+
+	if SessionRenewBefore == 0 {
+		SessionRenewBefore = SessionTTL / 2
+	}
+
+	if SessionRenewBefore >= SessionTTL {
+		return errors.New("session renewal must start before session expiration")
+	}
+
+	switch SessionStore {
+	case "":
+		SessionStore = SessionStoreCookie
+	case SessionStoreCookie, SessionStorePostgres, SessionStoreMemory:
+	default:
+		return fmt.Errorf("unsupported session store %s", SessionStore)
+	}
+
+	switch secure {
+	case "":
+		CookieSecure = strings.HasPrefix(BaseShortenerURL, "https://")
+	case "true", "false":
+		CookieSecure = secure == "true"
+	default:
+		return fmt.Errorf("cookie secure must be true or false, got %s", secure)
+	}
+
+	CookieSameSite = strings.ToLower(CookieSameSite)
+	switch CookieSameSite {
+	case "":
+		CookieSameSite = SameSiteLax
+	case SameSiteLax, SameSiteStrict:
+	case SameSiteNone:
+		if !CookieSecure {
+			return errors.New("SameSite=None cookies must be secure")
+		}
+	default:
+		return fmt.Errorf("unsupported SameSite %s", CookieSameSite)
+	}
+
+	return nil
+}
+
+// parseOrigins checks that every item is an origin like "https://example.com" and removes trailing slashes.
+func parseOrigins(origins []string) error {
+	for i, origin := range origins {
+		origin = strings.TrimRight(origin, "/")
+
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+			return fmt.Errorf("%s is not an origin", origin)
+		}
+
+		origins[i] = origin
+	}
+
+	return nil
+}
+
+// parseCORSSettings sets defaults of CORS settings and checks them. Cookies are sent with cross-origin requests
+// only if they are SameSite=None, so it is the default when credentials are allowed and other values are rejected.
+func parseCORSSettings() error {
+	if len(CORSAllowedMethods) == 0 {
+		CORSAllowedMethods = splitList(defaultCORSMethods)
+	}
+
+	for i, method := range CORSAllowedMethods {
+		CORSAllowedMethods[i] = strings.ToUpper(method)
+	}
+
+	if len(CORSAllowedHeaders) == 0 {
+		CORSAllowedHeaders = splitList(defaultCORSHeaders)
+	}
+
+	if CORSMaxAge == 0 {
+		CORSMaxAge = defaultCORSMaxAge
+	}
+
+	origins := make([]string, 0, len(CORSAllowedOrigins))
+	for _, origin := range CORSAllowedOrigins {
+		if origin != CORSAnyOrigin {
+			origins = append(origins, origin)
+		} else if CORSAllowCredentials {
+			return errors.New("any origin cannot be allowed with credentials")
+		}
+	}
+
+	if err := parseOrigins(origins); err != nil {
+		return err
+	}
+
+	if len(origins) < len(CORSAllowedOrigins) {
+		origins = append(origins, CORSAnyOrigin)
+	}
+
+	CORSAllowedOrigins = origins
+
+	if !CORSAllowCredentials {
+		return nil
 	}
+
+	switch strings.ToLower(CookieSameSite) {
+	case "":
+		CookieSameSite = SameSiteNone
+	case SameSiteNone:
+	default:
+		return errors.New("credentials require SameSite=None session cookies")
+	}
+
+	return nil
+}
+
+// parseOIDCSettings sets defaults of OpenID Connect settings and checks them.
+func parseOIDCSettings() error {
+	if OIDCIssuerURL == "" {
+		return nil
+	}
+
+	if OIDCClientID == "" {
+		return errors.New("client identifier is required")
+	}
+
+	if Production && !strings.HasPrefix(OIDCIssuerURL, "https://") {
+		return errors.New("provider url must be https in production")
+	}
+
+	if OIDCRedirectURL == "" {
+		OIDCRedirectURL = strings.TrimRight(BaseShortenerURL, "/") + oidcCallbackPath
+	}
+
+	return nil
+}
+
+// decodeSecret decodes secret given in base64 with base64Prefix, other secrets are returned as is.
+func decodeSecret(secret string) (string, error) {
+	if !strings.HasPrefix(secret, base64Prefix) {
+		return secret, nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, base64Prefix))
+	if err != nil {
+		return "", err
+	}
+
+	return string(decoded), nil
+}
+
+// parseKeys parses comma separated list of keys with identifiers like "id:key", items without identifier
+// are skipped.
+func parseKeys(list string) (map[string]string, error) {
+	keys := make(map[string]string)
+	for _, item := range strings.Split(list, ",") {
+		i := strings.Index(item, ":")
+		if i <= 0 {
+			continue
+		}
+
+		secret, err := decodeSecret(strings.TrimSpace(item[i+1:]))
+		if err != nil {
+			return nil, err
+		}
+
+		keys[strings.TrimSpace(item[:i])] = secret
+	}
+
+	return keys, nil
+}
+
+// splitList splits comma separated list into lowercase items skipping empty ones.
+func splitList(list string) []string {
+	result := make([]string, 0)
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			result = append(result, item)
+		}
+	}
+
+	return result
+}
+
+// intFromEnv returns integer value of specified environment variable or zero if it is not set or malformed.
+func intFromEnv(key string) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return 0
+	}
+
+	return value
 }
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_loadSecretKey(t *testing.T) {
+	strongKey := strings.Repeat("k", minSecretKeyLength)
+
+	path := filepath.Join(t.TempDir(), "secret_key")
+	assert.NoError(t, os.WriteFile(path, []byte(strongKey+"\n"), 0600))
+
+	tests := []struct {
+		name        string
+		secretKey   string
+		path        string
+		base64Value string
+		production  bool
+		want        string
+		wantErr     bool
+	}{
+		{
+			name:       "should refuse default key in production",
+			production: true,
+			wantErr:    true,
+		},
+		{
+			name:       "should refuse short key in production",
+			secretKey:  "short",
+			production: true,
+			wantErr:    true,
+		},
+		{
+			name:      "should use default key in development",
+			secretKey: "",
+			want:      defaultSecretKey,
+		},
+		{
+			name:       "should load key from file without trailing newline",
+			path:       path,
+			production: true,
+			want:       strongKey,
+		},
+		{
+			name:    "should fail on missing file",
+			path:    filepath.Join(t.TempDir(), "missing"),
+			wantErr: true,
+		},
+		{
+			name:        "should decode base64 key",
+			base64Value: "a2trS2trS2trS2trS2trS2trS2trS2trS2trS2trS2s=",
+			production:  true,
+			want:        "kkkKkkKkkKkkKkkKkkKkkKkkKkkKkkKk",
+		},
+		{
+			name:        "should fail on malformed base64 key",
+			base64Value: "not base64!",
+			wantErr:     true,
+		},
+		{
+			name:       "should decode base64 prefixed key",
+			secretKey:  "base64:a2trS2trS2trS2trS2trS2trS2trS2trS2trS2trS2s=",
+			production: true,
+			want:       "kkkKkkKkkKkkKkkKkkKkkKkkKkkKkkKk",
+		},
+	}
+
+	defer func() { SecretKey, Production = "", false }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SecretKey, Production = tt.secretKey, tt.production
+
+			err := loadSecretKey(tt.path, tt.base64Value)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, SecretKey)
+		})
+	}
+}
+
+func Test_parseKeys(t *testing.T) {
+	tests := []struct {
+		name    string
+		list    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "should parse keys with identifiers",
+			list: "0:old_key, 2:base64:b2xkZXJfa2V5",
+			want: map[string]string{"0": "old_key", "2": "older_key"},
+		},
+		{
+			name: "should skip items without identifier",
+			list: "old_key,:other_key",
+			want: map[string]string{},
+		},
+		{
+			name:    "should fail on malformed base64 key",
+			list:    "0:base64:not base64!",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseKeys(tt.list)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_checkSecretStrength(t *testing.T) {
+	tests := []struct {
+		name       string
+		secret     string
+		production bool
+		wantErr    bool
+	}{
+		{
+			name:       "should accept strong key in production",
+			secret:     strings.Repeat("k", minSecretKeyLength),
+			production: true,
+		},
+		{name: "should refuse default key in production", secret: defaultSecretKey, production: true, wantErr: true},
+		{name: "should refuse empty key in production", secret: "", production: true, wantErr: true},
+		{name: "should accept weak key in development", secret: "short"},
+	}
+
+	defer func() { Production = false }()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			Production = tt.production
+			assert.Equal(t, tt.wantErr, checkSecretStrength(tt.secret) != nil)
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package accounts
+
+import (
+	"context"
+	"errors"
+	"github.com/magmel48/go-web/internal/auth"
+	"time"
+)
+
+// Account is representing database table and a registered user DTO at the same time.
+type Account struct {
+	ID int
+	// UserID is identifier of the user that owns links, it does not change when the account logs in
+	// from other browsers.
+	UserID auth.UserID
+	// Login and PasswordHash are empty for accounts of an external identity provider.
+	Login        string
+	PasswordHash string
+	// Issuer and Subject identify the user at an external identity provider, they are empty for accounts
+	// with password.
+	Issuer    string
+	Subject   string
+	CreatedAt time.Time
+}
+
+// Repository is common interface for a work with accounts implementation.
+//go:generate mockery --name=Repository
+type Repository interface {
+	Create(ctx context.Context, account Account) (*Account, error)
+	FindByLogin(ctx context.Context, login string) (*Account, error)
+	FindByUserID(ctx context.Context, userID auth.UserID) (*Account, error)
+	FindBySubject(ctx context.Context, issuer string, subject string) (*Account, error)
+}
+
+// ErrConflict is using for notifying clients that the login or the external identity is taken already.
+var ErrConflict = errors.New("account already exists")
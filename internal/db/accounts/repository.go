@@ -0,0 +1,106 @@
+package accounts
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/magmel48/go-web/internal/auth"
+)
+
+// PostgresRepository is implementation of abstract Repository.
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresRepository returns new PostgresRepository for working with accounts.
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+// selectColumns are columns of accounts in the order they are scanned by find.
+const selectColumns = `"id", "user_id", COALESCE("login", ''), "password_hash", "issuer", "subject", "created_at"`
+
+// Create stores new account, ErrConflict is returned if the login, the external identity or the user
+// has an account already.
+func (repository *PostgresRepository) Create(ctx context.Context, account Account) (*Account, error) {
+	err := repository.db.QueryRowContext(
+		ctx,
+		`INSERT INTO "accounts" ("user_id", "login", "password_hash", "issuer", "subject") VALUES ($1, NULLIF($2, ''), $3, $4, $5) ON CONFLICT DO NOTHING RETURNING "id", "created_at"`,
+		*account.UserID,
+		account.Login,
+		account.PasswordHash,
+		account.Issuer,
+		account.Subject).Scan(&account.ID, &account.CreatedAt)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrConflict
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+// FindByLogin finds account by login, nil means there is no such account.
+func (repository *PostgresRepository) FindByLogin(ctx context.Context, login string) (*Account, error) {
+	return repository.find(
+		ctx,
+		`SELECT `+selectColumns+` FROM "accounts" WHERE "login" = $1 LIMIT 1`,
+		login)
+}
+
+// FindByUserID finds account of the user, nil means the user is anonymous.
+func (repository *PostgresRepository) FindByUserID(ctx context.Context, userID auth.UserID) (*Account, error) {
+	return repository.find(
+		ctx,
+		`SELECT `+selectColumns+` FROM "accounts" WHERE "user_id" = $1 LIMIT 1`,
+		*userID)
+}
+
+// FindBySubject finds account of the user of an external identity provider, nil means the user has not logged in
+// with the provider yet.
+func (repository *PostgresRepository) FindBySubject(
+	ctx context.Context, issuer string, subject string) (*Account, error) {
+	return repository.find(
+		ctx,
+		`SELECT `+selectColumns+` FROM "accounts" WHERE "issuer" = $1 AND "subject" = $2 LIMIT 1`,
+		issuer,
+		subject)
+}
+
+// find returns the first account selected by the query.
+func (repository *PostgresRepository) find(ctx context.Context, query string, args ...interface{}) (*Account, error) {
+	rows, err := repository.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	var (
+		account Account
+		userID  string
+	)
+
+	err = rows.Scan(
+		&account.ID,
+		&userID,
+		&account.Login,
+		&account.PasswordHash,
+		&account.Issuer,
+		&account.Subject,
+		&account.CreatedAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	account.UserID = &userID
+	return &account, nil
+}
@@ -0,0 +1,101 @@
+package accounts
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestPostgresRepository_Create(t *testing.T) {
+	userID := "test_user_id"
+	createdAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	query := regexp.QuoteMeta(
+		`INSERT INTO "accounts" ("user_id", "login", "password_hash", "issuer", "subject") VALUES ($1, NULLIF($2, ''), $3, $4, $5) ON CONFLICT DO NOTHING RETURNING "id", "created_at"`)
+
+	db, sqlMock, _ := sqlmock.New()
+	sqlMock.ExpectQuery(query).WithArgs(userID, "alice", "hash", "", "").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, createdAt))
+	sqlMock.ExpectQuery(query).WithArgs(userID, "alice", "hash", "", "").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "created_at"}))
+
+	account := Account{UserID: &userID, Login: "alice", PasswordHash: "hash"}
+
+	tests := []struct {
+		name    string
+		want    *Account
+		wantErr error
+	}{
+		{
+			name:    "should create account",
+			want:    &Account{ID: 1, UserID: &userID, Login: "alice", PasswordHash: "hash", CreatedAt: createdAt},
+			wantErr: nil,
+		},
+		{name: "should report taken login", want: nil, wantErr: ErrConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &PostgresRepository{db: db}
+			got, err := repository.Create(context.TODO(), account)
+
+			if err != tt.wantErr {
+				t.Errorf("Create() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Create() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgresRepository_FindByLogin(t *testing.T) {
+	type fields struct {
+		db *sql.DB
+	}
+
+	userID := "test_user_id"
+	createdAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	query := regexp.QuoteMeta(
+		`SELECT "id", "user_id", COALESCE("login", ''), "password_hash", "issuer", "subject", "created_at" FROM "accounts" WHERE "login" = $1 LIMIT 1`)
+	columns := []string{"id", "user_id", "login", "password_hash", "issuer", "subject", "created_at"}
+
+	db, sqlMock, _ := sqlmock.New()
+	sqlMock.ExpectQuery(query).WithArgs("alice").WillReturnRows(
+		sqlmock.NewRows(columns).AddRow(1, userID, "alice", "hash", "", "", createdAt))
+	sqlMock.ExpectQuery(query).WithArgs("bob").WillReturnRows(sqlmock.NewRows(columns))
+
+	tests := []struct {
+		name   string
+		fields fields
+		login  string
+		want   *Account
+	}{
+		{
+			name:   "should find account",
+			fields: fields{db: db},
+			login:  "alice",
+			want:   &Account{ID: 1, UserID: &userID, Login: "alice", PasswordHash: "hash", CreatedAt: createdAt},
+		},
+		{name: "should return nil for unknown login", fields: fields{db: db}, login: "bob", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &PostgresRepository{db: tt.fields.db}
+			got, err := repository.FindByLogin(context.TODO(), tt.login)
+			if err != nil {
+				t.Fatalf("FindByLogin() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindByLogin() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
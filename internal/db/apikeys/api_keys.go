@@ -0,0 +1,134 @@
+package apikeys
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/magmel48/go-web/internal/auth"
+	"strings"
+	"time"
+)
+
+// KeyPrefix starts every API key, so they are easy to tell from session tokens and to find in leaked secrets.
+const KeyPrefix = "gwk_"
+
+// keySize is number of random bytes of API keys.
+const keySize = 32
+
+// displayPrefixLength is number of API key characters that are stored as is to let users tell their keys apart.
+const displayPrefixLength = len(KeyPrefix) + 6
+
+// Scope is a kind of requests that can be authenticated by an API key.
+type Scope string
+
+const (
+	// ScopeShorten allows making links shorter and changing their settings.
+	ScopeShorten Scope = "shorten"
+	// ScopeRead allows reading user links.
+	ScopeRead Scope = "read"
+	// ScopeDelete allows deleting user links.
+	ScopeDelete Scope = "delete"
+	// ScopeStats allows reading clicks statistics of user links.
+	ScopeStats Scope = "stats"
+)
+
+// Scopes are all known scopes.
+var Scopes = []Scope{ScopeShorten, ScopeRead, ScopeDelete, ScopeStats}
+
+// ErrWrongScope is using for notifying clients about unknown or missing scopes of an API key.
+var ErrWrongScope = errors.New("wrong scope")
+
+// ErrWrongExpiry is using for notifying clients that an API key would be expired already.
+var ErrWrongExpiry = errors.New("expiration time must be in future")
+
+// APIKey is representing database table and an API key DTO at the same time. The key itself is never stored,
+// only its hash.
+type APIKey struct {
+	ID     int         `json:"id"`
+	UserID auth.UserID `json:"-"`
+	Name   string      `json:"name"`
+	// Prefix is the beginning of the key, it is shown to users instead of the key.
+	Prefix    string     `json:"prefix"`
+	Hash      []byte     `json:"-"`
+	Scopes    []Scope    `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Repository is common interface for a work with API keys implementation.
+//go:generate mockery --name=Repository
+type Repository interface {
+	Create(ctx context.Context, key APIKey) (*APIKey, error)
+	FindByHash(ctx context.Context, hash []byte) (*APIKey, error)
+	List(ctx context.Context, userID auth.UserID) ([]APIKey, error)
+	Revoke(ctx context.Context, userID auth.UserID, id int) (bool, error)
+}
+
+// NewKey generates new random API key.
+func NewKey() (string, error) {
+	random := make([]byte, keySize)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	return KeyPrefix + base64.RawURLEncoding.EncodeToString(random), nil
+}
+
+// HashKey returns hash that identifies API key, keys are random enough for hashing without salt.
+func HashKey(key string) []byte {
+	hash := sha256.Sum256([]byte(key))
+	return hash[:]
+}
+
+// IsKey checks if token looks like an API key.
+func IsKey(token string) bool {
+	return strings.HasPrefix(token, KeyPrefix)
+}
+
+// DisplayPrefix returns part of API key that can be stored and shown.
+func DisplayPrefix(key string) string {
+	if len(key) < displayPrefixLength {
+		return key
+	}
+
+	return key[:displayPrefixLength]
+}
+
+// ValidateScopes checks if every scope is known and there is at least one.
+func ValidateScopes(scopes []Scope) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("%w: at least one scope is required", ErrWrongScope)
+	}
+
+	for _, scope := range scopes {
+		if !containsScope(Scopes, scope) {
+			return fmt.Errorf("%w: %s", ErrWrongScope, scope)
+		}
+	}
+
+	return nil
+}
+
+// HasScope checks if the key allows requests of the scope.
+func (key APIKey) HasScope(scope Scope) bool {
+	return containsScope(key.Scopes, scope)
+}
+
+// IsExpired checks if the key cannot be used anymore.
+func (key APIKey) IsExpired(now time.Time) bool {
+	return key.ExpiresAt != nil && !now.Before(*key.ExpiresAt)
+}
+
+// containsScope checks if list has the scope.
+func containsScope(list []Scope, scope Scope) bool {
+	for _, el := range list {
+		if el == scope {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,139 @@
+package apikeys
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/magmel48/go-web/internal/auth"
+)
+
+// PostgresRepository is implementation of abstract Repository.
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresRepository returns new PostgresRepository for working with API keys.
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+// Create stores new API key and returns it with identifier and creation time.
+func (repository *PostgresRepository) Create(ctx context.Context, key APIKey) (*APIKey, error) {
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	err = repository.db.QueryRowContext(
+		ctx,
+		`INSERT INTO "api_keys" ("user_id", "name", "prefix", "key_hash", "scopes", "expires_at") VALUES ($1, $2, $3, $4, $5, $6) RETURNING "id", "created_at"`,
+		*key.UserID,
+		key.Name,
+		key.Prefix,
+		key.Hash,
+		string(scopes),
+		key.ExpiresAt).Scan(&key.ID, &key.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// FindByHash finds not revoked API key by hash of the key, nil means there is no such key.
+func (repository *PostgresRepository) FindByHash(ctx context.Context, hash []byte) (*APIKey, error) {
+	rows, err := repository.db.QueryContext(
+		ctx,
+		`SELECT "id", "user_id", "name", "prefix", "scopes", "expires_at", "created_at" FROM "api_keys" WHERE "key_hash" = $1 AND "revoked_at" IS NULL LIMIT 1`,
+		hash)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	key, err := scanKey(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Hash = hash
+	return key, nil
+}
+
+// List returns not revoked API keys of the user.
+func (repository *PostgresRepository) List(ctx context.Context, userID auth.UserID) ([]APIKey, error) {
+	rows, err := repository.db.QueryContext(
+		ctx,
+		`SELECT "id", "user_id", "name", "prefix", "scopes", "expires_at", "created_at" FROM "api_keys" WHERE "user_id" = $1 AND "revoked_at" IS NULL ORDER BY "id"`,
+		*userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	result := make([]APIKey, 0)
+	for rows.Next() {
+		key, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, *key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Revoke revokes API key of the user, false means the user has no such key.
+func (repository *PostgresRepository) Revoke(ctx context.Context, userID auth.UserID, id int) (bool, error) {
+	result, err := repository.db.ExecContext(
+		ctx,
+		`UPDATE "api_keys" SET "revoked_at" = NOW() WHERE "id" = $1 AND "user_id" = $2 AND "revoked_at" IS NULL`,
+		id,
+		*userID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// scanKey reads API key from the current row.
+func scanKey(rows *sql.Rows) (*APIKey, error) {
+	var (
+		key       APIKey
+		userID    string
+		scopes    []byte
+		expiresAt sql.NullTime
+	)
+
+	if err := rows.Scan(&key.ID, &userID, &key.Name, &key.Prefix, &scopes, &expiresAt, &key.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(scopes, &key.Scopes); err != nil {
+		return nil, err
+	}
+
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+
+	key.UserID = &userID
+	return &key, nil
+}
@@ -0,0 +1,242 @@
+package apikeys
+
+import (
+	"context"
+	"database/sql"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/magmel48/go-web/internal/auth"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestPostgresRepository_Create(t *testing.T) {
+	type fields struct {
+		db *sql.DB
+	}
+	type args struct {
+		ctx context.Context
+		key APIKey
+	}
+
+	userID := "test_user_id"
+	hash := HashKey("gwk_test")
+	createdAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	key := APIKey{UserID: &userID, Name: "ci", Prefix: "gwk_te", Hash: hash, Scopes: []Scope{ScopeShorten}}
+
+	db, sqlMock, _ := sqlmock.New()
+	e := sqlMock.ExpectQuery(regexp.QuoteMeta(
+		`INSERT INTO "api_keys" ("user_id", "name", "prefix", "key_hash", "scopes", "expires_at") VALUES ($1, $2, $3, $4, $5, $6) RETURNING "id", "created_at"`))
+	e.WithArgs(userID, "ci", "gwk_te", hash, `["shorten"]`, nil)
+	e.WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(7, createdAt))
+
+	want := key
+	want.ID = 7
+	want.CreatedAt = createdAt
+
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    *APIKey
+		wantErr bool
+	}{
+		{
+			name:    "should execute proper query",
+			fields:  fields{db: db},
+			args:    args{ctx: context.TODO(), key: key},
+			want:    &want,
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &PostgresRepository{
+				db: tt.fields.db,
+			}
+			got, err := repository.Create(tt.args.ctx, tt.args.key)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Create() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Create() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgresRepository_FindByHash(t *testing.T) {
+	type fields struct {
+		db *sql.DB
+	}
+	type args struct {
+		ctx  context.Context
+		hash []byte
+	}
+
+	userID := "test_user_id"
+	hash := HashKey("gwk_test")
+	createdAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	expiresAt := time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)
+	query := regexp.QuoteMeta(
+		`SELECT "id", "user_id", "name", "prefix", "scopes", "expires_at", "created_at" FROM "api_keys" WHERE "key_hash" = $1 AND "revoked_at" IS NULL LIMIT 1`)
+	columns := []string{"id", "user_id", "name", "prefix", "scopes", "expires_at", "created_at"}
+
+	db, sqlMock, _ := sqlmock.New()
+	sqlMock.ExpectQuery(query).WithArgs(hash).WillReturnRows(
+		sqlmock.NewRows(columns).AddRow(7, userID, "ci", "gwk_te", []byte(`["read","stats"]`), expiresAt, createdAt))
+	sqlMock.ExpectQuery(query).WithArgs(hash).WillReturnRows(sqlmock.NewRows(columns))
+
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    *APIKey
+		wantErr bool
+	}{
+		{
+			name:   "should find key",
+			fields: fields{db: db},
+			args:   args{ctx: context.TODO(), hash: hash},
+			want: &APIKey{
+				ID:        7,
+				UserID:    &userID,
+				Name:      "ci",
+				Prefix:    "gwk_te",
+				Hash:      hash,
+				Scopes:    []Scope{ScopeRead, ScopeStats},
+				ExpiresAt: &expiresAt,
+				CreatedAt: createdAt,
+			},
+			wantErr: false,
+		},
+		{
+			name:    "should return nil for unknown or revoked key",
+			fields:  fields{db: db},
+			args:    args{ctx: context.TODO(), hash: hash},
+			want:    nil,
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &PostgresRepository{
+				db: tt.fields.db,
+			}
+			got, err := repository.FindByHash(tt.args.ctx, tt.args.hash)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FindByHash() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindByHash() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgresRepository_List(t *testing.T) {
+	userID := "test_user_id"
+	createdAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	db, sqlMock, _ := sqlmock.New()
+	sqlMock.ExpectQuery(regexp.QuoteMeta(
+		`SELECT "id", "user_id", "name", "prefix", "scopes", "expires_at", "created_at" FROM "api_keys" WHERE "user_id" = $1 AND "revoked_at" IS NULL ORDER BY "id"`)).
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "prefix", "scopes", "expires_at", "created_at"}).
+			AddRow(7, userID, "ci", "gwk_te", []byte(`["delete"]`), nil, createdAt))
+
+	repository := &PostgresRepository{db: db}
+	got, err := repository.List(context.TODO(), &userID)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+
+	want := []APIKey{
+		{ID: 7, UserID: &userID, Name: "ci", Prefix: "gwk_te", Scopes: []Scope{ScopeDelete}, CreatedAt: createdAt},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("List() got = %v, want %v", got, want)
+	}
+}
+
+func TestPostgresRepository_Revoke(t *testing.T) {
+	type args struct {
+		userID auth.UserID
+		id     int
+	}
+
+	userID := "test_user_id"
+	query := regexp.QuoteMeta(
+		`UPDATE "api_keys" SET "revoked_at" = NOW() WHERE "id" = $1 AND "user_id" = $2 AND "revoked_at" IS NULL`)
+
+	db, sqlMock, _ := sqlmock.New()
+	sqlMock.ExpectExec(query).WithArgs(7, userID).WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectExec(query).WithArgs(8, userID).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	tests := []struct {
+		name string
+		args args
+		want bool
+	}{
+		{name: "should revoke key of the user", args: args{userID: &userID, id: 7}, want: true},
+		{name: "should report missing key", args: args{userID: &userID, id: 8}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &PostgresRepository{db: db}
+			got, err := repository.Revoke(context.TODO(), tt.args.userID, tt.args.id)
+			if err != nil {
+				t.Fatalf("Revoke() error = %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("Revoke() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  []Scope
+		wantErr bool
+	}{
+		{name: "should accept known scopes", scopes: []Scope{ScopeShorten, ScopeStats}, wantErr: false},
+		{name: "should reject empty scopes", scopes: nil, wantErr: true},
+		{name: "should reject unknown scope", scopes: []Scope{ScopeRead, "admin"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateScopes(tt.scopes); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateScopes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewKey(t *testing.T) {
+	key, err := NewKey()
+	if err != nil {
+		t.Fatalf("NewKey() error = %v", err)
+	}
+
+	if !IsKey(key) || len(DisplayPrefix(key)) != displayPrefixLength {
+		t.Errorf("NewKey() returned wrong key %s", key)
+	}
+
+	if other, _ := NewKey(); other == key {
+		t.Errorf("NewKey() returned the same key twice")
+	}
+}
@@ -2,7 +2,11 @@ package links
 
 import (
 	"context"
+	"crypto/sha256"
 	"errors"
+	"net/http"
+	"net/url"
+	"time"
 )
 
 // Link is representing database table and a link DTO at the same time.
@@ -11,16 +15,157 @@ type Link struct {
 	ShortID     string
 	OriginalURL string
 	IsDeleted   bool
+	CreatedAt   time.Time
+	// OwnerID is the user who made the link shorter, only they can change the link. It is empty for links
+	// made without a user, e.g. by batches.
+	OwnerID string
+	// Plain says if the link had no options ever, only plain links are deduplicated and merged.
+	Plain bool
+	// TrustOverride is set by admins and replaces trust policy decision for the link.
+	TrustOverride Trust
+	Options
+}
+
+// Trust is an admin decision about safety of a link destination.
+type Trust string
+
+const (
+	// TrustDefault means the link is checked by trust policy.
+	TrustDefault Trust = ""
+	// TrustTrusted means the link is always redirected without a warning.
+	TrustTrusted Trust = "trusted"
+	// TrustUntrusted means the link always shows a warning before redirect.
+	TrustUntrusted Trust = "untrusted"
+)
+
+// Options are optional link attributes that can be specified on link creation.
+type Options struct {
+	// RedirectType is HTTP status code for redirect to OriginalURL, zero means server default.
+	RedirectType int
+	// ForwardQuery enables passing query string of a short link request to OriginalURL.
+	ForwardQuery bool
+	// UTMParams are fixed parameters that are appended to OriginalURL query on every redirect.
+	UTMParams url.Values
+	// PasswordHash protects the link with a password, empty value means the link is public.
+	PasswordHash string
+	// MaxClicks is number of redirects after which the link is deleted, zero means unlimited.
+	MaxClicks int
+	// Rules are checked in order on every redirect, the first matching rule replaces OriginalURL.
+	Rules []Rule
+	// Split replaces OriginalURL with one of several destinations if no rule matches, nil means no split.
+	Split *Split
+	// IsPrefix makes the link cover a whole site: the rest of request path after short identifier
+	// is appended to the destination path.
+	IsPrefix bool
+	// DeepLink opens a mobile app instead of OriginalURL on mobile devices, nil means no app.
+	DeepLink *DeepLink
+	Schedule
+}
+
+// IsPlain says if no option is set. Only plain links are deduplicated by original URL,
+// so options requested for a link are never lost because of another link of the same URL.
+func (options Options) IsPlain() bool {
+	return options.RedirectType == 0 && !options.ForwardQuery && len(options.UTMParams) == 0 &&
+		options.PasswordHash == "" && options.MaxClicks == 0 && len(options.Rules) == 0 && options.Split == nil &&
+		!options.IsPrefix && options.DeepLink == nil && options.ActiveFrom == nil && options.ActiveUntil == nil &&
+		options.PlaceholderURL == ""
+}
+
+// Schedule limits time when a link can be used.
+type Schedule struct {
+	// ActiveFrom is time before which the link is not resolved yet, nil means the link is active since creation.
+	ActiveFrom *time.Time `json:"active_from,omitempty"`
+	// ActiveUntil is time after which the link is expired, nil means the link never expires.
+	ActiveUntil *time.Time `json:"active_until,omitempty"`
+	// PlaceholderURL is where clients are redirected before ActiveFrom, empty means they get not found error.
+	PlaceholderURL string `json:"placeholder_url,omitempty"`
+}
+
+// Rule redirects requests matching all its non-empty conditions to its own URL.
+type Rule struct {
+	// Name identifies the rule in clicks statistics.
+	Name string `json:"name"`
+	// OS is client operating system detected by User-Agent: "ios" or "android".
+	OS string `json:"os,omitempty"`
+	// Language is primary tag of the most preferred language from Accept-Language, e.g. "de".
+	Language string `json:"language,omitempty"`
+	// Country is ISO 3166-1 alpha-2 code of client country provided by a geo-aware proxy.
+	Country string `json:"country,omitempty"`
+	URL     string `json:"url"`
+}
+
+// DeepLink describes a mobile app that should be opened by the link, OriginalURL is used as web fallback.
+type DeepLink struct {
+	// AppURL is an app-scheme URL, e.g. "myapp://product/42".
+	AppURL string `json:"app_url"`
+	// IOSStoreURL and AndroidStoreURL are opened if the app is not installed, empty means web fallback.
+	IOSStoreURL     string `json:"ios_store_url,omitempty"`
+	AndroidStoreURL string `json:"android_store_url,omitempty"`
+}
+
+// Rotation is a way of picking one of split destinations.
+type Rotation string
+
+const (
+	// RotationWeighted picks a destination randomly in proportion to its weight.
+	RotationWeighted Rotation = "weighted"
+	// RotationRoundRobin picks destinations one by one.
+	RotationRoundRobin Rotation = "round_robin"
+)
+
+// Split spreads redirects of a link across several destinations, e.g. for A/B testing of landing pages.
+type Split struct {
+	Rotation Rotation `json:"rotation"`
+	// Sticky pins the destination picked for a visitor, so they see the same variant every time.
+	Sticky       bool          `json:"sticky,omitempty"`
+	Destinations []Destination `json:"destinations"`
+}
+
+// Destination is one of split variants of a link.
+type Destination struct {
+	// Name identifies the destination in clicks statistics and visitor cookies.
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Weight int    `json:"weight,omitempty"`
 }
 
 // Repository is common interface for a work with links implementation.
 //go:generate mockery --name=Repository
 type Repository interface {
-	Create(ctx context.Context, shortID string, originalURL string) (*Link, error)
+	Create(ctx context.Context, shortID string, originalURL string, ownerID string, options Options) (*Link, error)
 	CreateBatch(ctx context.Context, originalURLs []string) ([]Link, error)
 	FindByShortID(ctx context.Context, shortID string) (*Link, error)
+	UseClick(ctx context.Context, id int) (bool, error)
+	UpdateRules(ctx context.Context, id int, rules []Rule) error
+	RegisterBranch(ctx context.Context, id int, branch string) error
+	ListBranches(ctx context.Context, id int) (map[string]int, error)
+	UpdateSplit(ctx context.Context, id int, split *Split) error
+	NextRotation(ctx context.Context, id int) (int, error)
+	RegisterVariant(ctx context.Context, id int, variant string) error
+	ListVariants(ctx context.Context, id int) (map[string]int, error)
+	UpdateSchedule(ctx context.Context, id int, schedule Schedule) error
+	UpdateTrustOverride(ctx context.Context, id int, trust Trust) error
+	ListURLs(ctx context.Context) ([]Link, error)
+	Merge(ctx context.Context, id int, originalURL string, duplicateIDs []int) error
 }
 
 // ErrConflict is using for notifying clients about a conflict with shorter link identifiers. Usually it means
 // the link was made already shorter, but by another user.
 var ErrConflict = errors.New("conflict")
+
+// HashURL returns hash that identifies original URL, links are deduplicated by it.
+// It is the same as sha256(convert_to(url, 'UTF8')) in Postgres.
+func HashURL(originalURL string) []byte {
+	hash := sha256.Sum256([]byte(originalURL))
+	return hash[:]
+}
+
+// IsRedirectTypeValid checks if specified redirect type can be used for a link.
+func IsRedirectTypeValid(redirectType int) bool {
+	switch redirectType {
+	case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+
+	return false
+}
@@ -14,13 +14,13 @@ type Repository struct {
 	mock.Mock
 }
 
-// Create provides a mock function with given fields: ctx, shortID, originalURL
-func (_m *Repository) Create(ctx context.Context, shortID string, originalURL string) (*links.Link, error) {
-	ret := _m.Called(ctx, shortID, originalURL)
+// Create provides a mock function with given fields: ctx, shortID, originalURL, ownerID, options
+func (_m *Repository) Create(ctx context.Context, shortID string, originalURL string, ownerID string, options links.Options) (*links.Link, error) {
+	ret := _m.Called(ctx, shortID, originalURL, ownerID, options)
 
 	var r0 *links.Link
-	if rf, ok := ret.Get(0).(func(context.Context, string, string) *links.Link); ok {
-		r0 = rf(ctx, shortID, originalURL)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, links.Options) *links.Link); ok {
+		r0 = rf(ctx, shortID, originalURL, ownerID, options)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*links.Link)
@@ -28,8 +28,8 @@ func (_m *Repository) Create(ctx context.Context, shortID string, originalURL st
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
-		r1 = rf(ctx, shortID, originalURL)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string, links.Options) error); ok {
+		r1 = rf(ctx, shortID, originalURL, ownerID, options)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -82,3 +82,212 @@ func (_m *Repository) FindByShortID(ctx context.Context, shortID string) (*links
 
 	return r0, r1
 }
+
+// UseClick provides a mock function with given fields: ctx, id
+func (_m *Repository) UseClick(ctx context.Context, id int) (bool, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 bool
+	if rf, ok := ret.Get(0).(func(context.Context, int) bool); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(bool)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateRules provides a mock function with given fields: ctx, id, rules
+func (_m *Repository) UpdateRules(ctx context.Context, id int, rules []links.Rule) error {
+	ret := _m.Called(ctx, id, rules)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int, []links.Rule) error); ok {
+		r0 = rf(ctx, id, rules)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RegisterBranch provides a mock function with given fields: ctx, id, branch
+func (_m *Repository) RegisterBranch(ctx context.Context, id int, branch string) error {
+	ret := _m.Called(ctx, id, branch)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int, string) error); ok {
+		r0 = rf(ctx, id, branch)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ListBranches provides a mock function with given fields: ctx, id
+func (_m *Repository) ListBranches(ctx context.Context, id int) (map[string]int, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 map[string]int
+	if rf, ok := ret.Get(0).(func(context.Context, int) map[string]int); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]int)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateSplit provides a mock function with given fields: ctx, id, split
+func (_m *Repository) UpdateSplit(ctx context.Context, id int, split *links.Split) error {
+	ret := _m.Called(ctx, id, split)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int, *links.Split) error); ok {
+		r0 = rf(ctx, id, split)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// NextRotation provides a mock function with given fields: ctx, id
+func (_m *Repository) NextRotation(ctx context.Context, id int) (int, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 int
+	if rf, ok := ret.Get(0).(func(context.Context, int) int); ok {
+		r0 = rf(ctx, id)
+	} else {
+		r0 = ret.Get(0).(int)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// RegisterVariant provides a mock function with given fields: ctx, id, variant
+func (_m *Repository) RegisterVariant(ctx context.Context, id int, variant string) error {
+	ret := _m.Called(ctx, id, variant)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int, string) error); ok {
+		r0 = rf(ctx, id, variant)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ListVariants provides a mock function with given fields: ctx, id
+func (_m *Repository) ListVariants(ctx context.Context, id int) (map[string]int, error) {
+	ret := _m.Called(ctx, id)
+
+	var r0 map[string]int
+	if rf, ok := ret.Get(0).(func(context.Context, int) map[string]int); ok {
+		r0 = rf(ctx, id)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(map[string]int)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, int) error); ok {
+		r1 = rf(ctx, id)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// UpdateSchedule provides a mock function with given fields: ctx, id, schedule
+func (_m *Repository) UpdateSchedule(ctx context.Context, id int, schedule links.Schedule) error {
+	ret := _m.Called(ctx, id, schedule)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int, links.Schedule) error); ok {
+		r0 = rf(ctx, id, schedule)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// UpdateTrustOverride provides a mock function with given fields: ctx, id, trust
+func (_m *Repository) UpdateTrustOverride(ctx context.Context, id int, trust links.Trust) error {
+	ret := _m.Called(ctx, id, trust)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int, links.Trust) error); ok {
+		r0 = rf(ctx, id, trust)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// ListURLs provides a mock function with given fields: ctx
+func (_m *Repository) ListURLs(ctx context.Context) ([]links.Link, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []links.Link
+	if rf, ok := ret.Get(0).(func(context.Context) []links.Link); ok {
+		r0 = rf(ctx)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]links.Link)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// Merge provides a mock function with given fields: ctx, id, originalURL, duplicateIDs
+func (_m *Repository) Merge(ctx context.Context, id int, originalURL string, duplicateIDs []int) error {
+	ret := _m.Called(ctx, id, originalURL, duplicateIDs)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, int, string, []int) error); ok {
+		r0 = rf(ctx, id, originalURL, duplicateIDs)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
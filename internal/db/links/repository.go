@@ -3,7 +3,9 @@ package links
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"log"
+	"net/url"
 	"strconv"
 )
 
@@ -17,29 +19,68 @@ func NewPostgresRepository(db *sql.DB) *PostgresRepository {
 	return &PostgresRepository{db: db}
 }
 
-// Create creates new shorter link by specified originalURL.
-func (repository *PostgresRepository) Create(ctx context.Context, shortID string, originalURL string) (*Link, error) {
+// Create creates new shorter link by specified originalURL, ownerID becomes the owner of a new link.
+// Plain link of the URL made shorter before is returned along with ErrConflict, its owner is not changed,
+// links with options are always new.
+// Deleted links are not returned, so a URL whose link was deleted or used up can be made shorter again.
+func (repository *PostgresRepository) Create(
+	ctx context.Context, shortID string, originalURL string, ownerID string, options Options) (*Link, error) {
 	if shortID == "" {
 		linksCount, _ := repository.getNextShortID(ctx)
 		shortID = strconv.Itoa(linksCount)
 	}
 
+	rules, err := marshalRules(options.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	split, err := marshalSplit(options.Split)
+	if err != nil {
+		return nil, err
+	}
+
+	deepLink, err := marshalDeepLink(options.DeepLink)
+	if err != nil {
+		return nil, err
+	}
+
 	link := Link{}
 	if err := repository.db.QueryRowContext(
 		ctx,
 		`
-			INSERT INTO "links" ("short_id", "original_url") VALUES ($1, $2)
-			ON CONFLICT ("original_url") DO UPDATE SET "original_url" = "links"."original_url"
-			RETURNING "id", "short_id"
+			INSERT INTO "links" (
+				"short_id", "original_url", "redirect_type", "forward_query", "utm_params", "password_hash",
+				"max_clicks", "remaining_clicks", "rules", "split", "active_from", "active_until", "placeholder_url",
+				"is_prefix", "deep_link", "original_url_hash", "is_plain", "owner_id"
+			)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+			ON CONFLICT ("original_url_hash") WHERE "is_plain" AND "is_deleted" IS NOT TRUE
+			DO UPDATE SET "original_url" = "links"."original_url"
+			RETURNING "id", "short_id", "redirect_type"
 		`,
 		shortID,
-		originalURL).Scan(&link.ID, &link.ShortID); err != nil {
+		originalURL,
+		options.RedirectType,
+		options.ForwardQuery,
+		options.UTMParams.Encode(),
+		options.PasswordHash,
+		options.MaxClicks,
+		rules,
+		split,
+		options.ActiveFrom,
+		options.ActiveUntil,
+		options.PlaceholderURL,
+		options.IsPrefix,
+		deepLink,
+		HashURL(originalURL),
+		options.IsPlain(),
+		ownerID).Scan(&link.ID, &link.ShortID, &link.RedirectType); err != nil {
 
 		return nil, err
 	}
 
 	// shortID != link.ShortID if short_id`s are not the same
-	var err error
 	if shortID != link.ShortID {
 		err = ErrConflict
 	}
@@ -63,13 +104,22 @@ func (repository *PostgresRepository) CreateBatch(ctx context.Context, originalU
 	}()
 
 	insertStmt, err := tx.PrepareContext(
-		ctx, `INSERT INTO "links" ("short_id", "original_url") VALUES($1, $2) RETURNING "id", "short_id"`)
+		ctx,
+		`
+			INSERT INTO "links" ("short_id", "original_url", "original_url_hash") VALUES($1, $2, $3)
+			RETURNING "id", "short_id"
+		`)
 	if err != nil {
 		return nil, err
 	}
 
 	selectStmt, err := tx.PrepareContext(
-		ctx, `SELECT "id", "short_id" FROM "links" WHERE "original_url" = $1 LIMIT 1`)
+		ctx,
+		`
+			SELECT "id", "short_id" FROM "links"
+			WHERE "original_url_hash" = $1 AND "is_plain" AND "is_deleted" IS NOT TRUE
+			LIMIT 1
+		`)
 	if err != nil {
 		return nil, err
 	}
@@ -79,7 +129,8 @@ func (repository *PostgresRepository) CreateBatch(ctx context.Context, originalU
 
 	for i, el := range originalURLs {
 		link := Link{}
-		rows, err := txSelectStmt.QueryContext(ctx, el)
+		hash := HashURL(el)
+		rows, err := txSelectStmt.QueryContext(ctx, hash)
 		if err != nil {
 			return nil, err
 		}
@@ -89,7 +140,8 @@ func (repository *PostgresRepository) CreateBatch(ctx context.Context, originalU
 				return nil, err
 			}
 		} else {
-			if err = txInsertStmt.QueryRowContext(ctx, strconv.Itoa(linksCount+i), el).Scan(&link.ID, &link.ShortID); err != nil {
+			if err = txInsertStmt.QueryRowContext(
+				ctx, strconv.Itoa(linksCount+i), el, hash).Scan(&link.ID, &link.ShortID); err != nil {
 				return nil, err
 			}
 		}
@@ -116,7 +168,17 @@ func (repository *PostgresRepository) CreateBatch(ctx context.Context, originalU
 // FindByShortID finds originalURL and related info by specified short link identifier.
 func (repository *PostgresRepository) FindByShortID(ctx context.Context, shortID string) (*Link, error) {
 	rows, err := repository.db.QueryContext(
-		ctx, `SELECT "id", "short_id", "original_url", "is_deleted" FROM "links" WHERE "short_id" = $1 LIMIT 1`, shortID)
+		ctx,
+		`
+			SELECT
+				"id", "short_id", "original_url", "is_deleted", "redirect_type", "forward_query", "utm_params",
+				"password_hash", "max_clicks", "rules", "split", "active_from", "active_until", "placeholder_url",
+				"is_prefix", "deep_link", "created_at", "trust_override", "owner_id"
+			FROM "links"
+			WHERE "short_id" = $1 OR "id" = (SELECT "link_id" FROM "link_aliases" WHERE "short_id" = $1)
+			LIMIT 1
+		`,
+		shortID)
 	if err != nil {
 		return nil, err
 	}
@@ -130,9 +192,59 @@ func (repository *PostgresRepository) FindByShortID(ctx context.Context, shortID
 
 	link := Link{}
 	if rows.Next() {
-		if err := rows.Scan(&link.ID, &link.ShortID, &link.OriginalURL, &link.IsDeleted); err != nil {
+		var utmParams string
+		var rules, split, deepLink []byte
+		var activeFrom, activeUntil sql.NullTime
+		if err := rows.Scan(
+			&link.ID,
+			&link.ShortID,
+			&link.OriginalURL,
+			&link.IsDeleted,
+			&link.RedirectType,
+			&link.ForwardQuery,
+			&utmParams,
+			&link.PasswordHash,
+			&link.MaxClicks,
+			&rules,
+			&split,
+			&activeFrom,
+			&activeUntil,
+			&link.PlaceholderURL,
+			&link.IsPrefix,
+			&deepLink,
+			&link.CreatedAt,
+			&link.TrustOverride,
+			&link.OwnerID); err != nil {
+			return nil, err
+		}
+
+		if activeFrom.Valid {
+			link.ActiveFrom = &activeFrom.Time
+		}
+
+		if activeUntil.Valid {
+			link.ActiveUntil = &activeUntil.Time
+		}
+
+		if link.UTMParams, err = url.ParseQuery(utmParams); err != nil {
 			return nil, err
 		}
+
+		if err = json.Unmarshal(rules, &link.Rules); err != nil {
+			return nil, err
+		}
+
+		if split != nil {
+			if err = json.Unmarshal(split, &link.Split); err != nil {
+				return nil, err
+			}
+		}
+
+		if deepLink != nil {
+			if err = json.Unmarshal(deepLink, &link.DeepLink); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	err = rows.Err()
@@ -147,11 +259,334 @@ func (repository *PostgresRepository) FindByShortID(ctx context.Context, shortID
 	return nil, nil
 }
 
+// UseClick atomically takes one click from the link with limited number of clicks.
+// It returns false if no clicks left, the link is marked as deleted with the last click.
+func (repository *PostgresRepository) UseClick(ctx context.Context, id int) (bool, error) {
+	result, err := repository.db.ExecContext(
+		ctx,
+		`
+			UPDATE "links"
+			SET "remaining_clicks" = "remaining_clicks" - 1, "is_deleted" = "remaining_clicks" <= 1
+			WHERE "id" = $1 AND "remaining_clicks" > 0 AND NOT "is_deleted"
+		`,
+		id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// UpdateRules replaces redirect rules of the link. Links with changed options are not plain anymore, so they
+// are not given to other users shortening the same URL.
+func (repository *PostgresRepository) UpdateRules(ctx context.Context, id int, rules []Rule) error {
+	serialized, err := marshalRules(rules)
+	if err != nil {
+		return err
+	}
+
+	_, err = repository.db.ExecContext(ctx, `UPDATE "links" SET "rules" = $1, "is_plain" = FALSE WHERE "id" = $2`, serialized, id)
+
+	return err
+}
+
+// RegisterBranch increments clicks counter of the branch (e.g. a rule) that was taken while redirecting.
+func (repository *PostgresRepository) RegisterBranch(ctx context.Context, id int, branch string) error {
+	_, err := repository.db.ExecContext(
+		ctx,
+		`
+			INSERT INTO "link_branches" ("link_id", "branch", "clicks") VALUES ($1, $2, 1)
+			ON CONFLICT ("link_id", "branch") DO UPDATE SET "clicks" = "link_branches"."clicks" + 1
+		`,
+		id,
+		branch)
+
+	return err
+}
+
+// ListBranches returns clicks counters of all branches taken by the link so far.
+func (repository *PostgresRepository) ListBranches(ctx context.Context, id int) (map[string]int, error) {
+	rows, err := repository.db.QueryContext(
+		ctx, `SELECT "branch", "clicks" FROM "link_branches" WHERE "link_id" = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Println("ListBranches close rows error", err)
+		}
+	}()
+
+	result := make(map[string]int)
+	for rows.Next() {
+		var branch string
+		var clicks int
+		if err := rows.Scan(&branch, &clicks); err != nil {
+			return nil, err
+		}
+
+		result[branch] = clicks
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// UpdateSplit replaces split destinations of the link, nil split turns splitting off.
+func (repository *PostgresRepository) UpdateSplit(ctx context.Context, id int, split *Split) error {
+	serialized, err := marshalSplit(split)
+	if err != nil {
+		return err
+	}
+
+	_, err = repository.db.ExecContext(ctx, `UPDATE "links" SET "split" = $1, "is_plain" = FALSE WHERE "id" = $2`, serialized, id)
+
+	return err
+}
+
+// UpdateSchedule replaces activation window of the link.
+func (repository *PostgresRepository) UpdateSchedule(ctx context.Context, id int, schedule Schedule) error {
+	_, err := repository.db.ExecContext(
+		ctx,
+		`
+			UPDATE "links"
+			SET "active_from" = $1, "active_until" = $2, "placeholder_url" = $3, "is_plain" = FALSE
+			WHERE "id" = $4
+		`,
+		schedule.ActiveFrom,
+		schedule.ActiveUntil,
+		schedule.PlaceholderURL,
+		id)
+
+	return err
+}
+
+// UpdateTrustOverride replaces admin trust decision for the link.
+func (repository *PostgresRepository) UpdateTrustOverride(ctx context.Context, id int, trust Trust) error {
+	_, err := repository.db.ExecContext(
+		ctx, `UPDATE "links" SET "trust_override" = $1 WHERE "id" = $2`, string(trust), id)
+
+	return err
+}
+
+// NextRotation atomically increments and returns rotation counter of the link for round-robin splitting.
+func (repository *PostgresRepository) NextRotation(ctx context.Context, id int) (int, error) {
+	counter := 0
+	err := repository.db.QueryRowContext(
+		ctx,
+		`UPDATE "links" SET "rotation_counter" = "rotation_counter" + 1 WHERE "id" = $1 RETURNING "rotation_counter"`,
+		id).Scan(&counter)
+
+	return counter, err
+}
+
+// RegisterVariant increments clicks counter of the split destination that was picked while redirecting.
+func (repository *PostgresRepository) RegisterVariant(ctx context.Context, id int, variant string) error {
+	_, err := repository.db.ExecContext(
+		ctx,
+		`
+			INSERT INTO "link_variants" ("link_id", "variant", "clicks") VALUES ($1, $2, 1)
+			ON CONFLICT ("link_id", "variant") DO UPDATE SET "clicks" = "link_variants"."clicks" + 1
+		`,
+		id,
+		variant)
+
+	return err
+}
+
+// ListVariants returns clicks counters of all split destinations picked for the link so far.
+func (repository *PostgresRepository) ListVariants(ctx context.Context, id int) (map[string]int, error) {
+	rows, err := repository.db.QueryContext(
+		ctx, `SELECT "variant", "clicks" FROM "link_variants" WHERE "link_id" = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Println("ListVariants close rows error", err)
+		}
+	}()
+
+	result := make(map[string]int)
+	for rows.Next() {
+		var variant string
+		var clicks int
+		if err := rows.Scan(&variant, &clicks); err != nil {
+			return nil, err
+		}
+
+		result[variant] = clicks
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ListURLs returns identifiers, owners and original URLs of all links ordered by creation.
+func (repository *PostgresRepository) ListURLs(ctx context.Context) ([]Link, error) {
+	rows, err := repository.db.QueryContext(
+		ctx,
+		`
+			SELECT "id", "short_id", "original_url", "owner_id", "is_plain", COALESCE("is_deleted", FALSE)
+			FROM "links" ORDER BY "id"
+		`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Println("ListURLs close rows error", err)
+		}
+	}()
+
+	result := make([]Link, 0)
+	for rows.Next() {
+		link := Link{}
+		if err := rows.Scan(
+			&link.ID, &link.ShortID, &link.OriginalURL, &link.OwnerID, &link.Plain, &link.IsDeleted); err != nil {
+			return nil, err
+		}
+
+		result = append(result, link)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// mergeQueries move everything of a duplicate link ($2) to the link it is merged into ($1) and delete the duplicate.
+// Short identifier of the duplicate keeps working as an alias.
+var mergeQueries = []string{
+	`UPDATE "link_aliases" SET "link_id" = $1 WHERE "link_id" = $2`,
+	`INSERT INTO "link_aliases" ("short_id", "link_id") SELECT "short_id", $1 FROM "links" WHERE "id" = $2`,
+	`
+		DELETE FROM "user_links"
+		WHERE "link_id" = $2 AND "user_id" IN (SELECT "user_id" FROM "user_links" WHERE "link_id" = $1)
+	`,
+	`UPDATE "user_links" SET "link_id" = $1 WHERE "link_id" = $2`,
+	`
+		INSERT INTO "link_branches" ("link_id", "branch", "clicks")
+		SELECT $1, "branch", "clicks" FROM "link_branches" WHERE "link_id" = $2
+		ON CONFLICT ("link_id", "branch") DO UPDATE SET "clicks" = "link_branches"."clicks" + EXCLUDED."clicks"
+	`,
+	`DELETE FROM "link_branches" WHERE "link_id" = $2`,
+	`
+		INSERT INTO "link_variants" ("link_id", "variant", "clicks")
+		SELECT $1, "variant", "clicks" FROM "link_variants" WHERE "link_id" = $2
+		ON CONFLICT ("link_id", "variant") DO UPDATE SET "clicks" = "link_variants"."clicks" + EXCLUDED."clicks"
+	`,
+	`DELETE FROM "link_variants" WHERE "link_id" = $2`,
+	`DELETE FROM "links" WHERE "id" = $2`,
+}
+
+// Merge merges duplicate links into the link with specified id and sets its original URL in one transaction.
+// Duplicates become aliases of the link, so they must be plain live links.
+func (repository *PostgresRepository) Merge(
+	ctx context.Context, id int, originalURL string, duplicateIDs []int) error {
+	tx, err := repository.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := tx.Rollback()
+		if err != nil && err != sql.ErrTxDone {
+			log.Println("Merge tx rollback error", err)
+		}
+	}()
+
+	for _, duplicateID := range duplicateIDs {
+		for _, query := range mergeQueries {
+			if _, err := tx.ExecContext(ctx, query, id, duplicateID); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := tx.ExecContext(
+		ctx,
+		`UPDATE "links" SET "original_url" = $1, "original_url_hash" = $2 WHERE "id" = $3`,
+		originalURL,
+		HashURL(originalURL),
+		id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// marshalSplit serializes split for storing, nil split is stored as NULL.
+func marshalSplit(split *Split) (interface{}, error) {
+	if split == nil {
+		return nil, nil
+	}
+
+	serialized, err := json.Marshal(split)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(serialized), nil
+}
+
+// marshalDeepLink serializes deep link for storing, nil deep link is stored as NULL.
+func marshalDeepLink(deepLink *DeepLink) (interface{}, error) {
+	if deepLink == nil {
+		return nil, nil
+	}
+
+	serialized, err := json.Marshal(deepLink)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(serialized), nil
+}
+
+// marshalRules serializes rules for storing, no rules are stored as empty array.
+func marshalRules(rules []Rule) (string, error) {
+	if rules == nil {
+		rules = []Rule{}
+	}
+
+	serialized, err := json.Marshal(rules)
+	if err != nil {
+		return "", err
+	}
+
+	return string(serialized), nil
+}
+
 // getNextShortID returns next shortID that can be used for a new shorter link.
 func (repository *PostgresRepository) getNextShortID(ctx context.Context) (int, error) {
 	count := 0
 
-	rows, err := repository.db.QueryContext(ctx, `SELECT COUNT(*) FROM "links"`)
+	// short identifiers of merged links are kept as aliases, so they are counted too
+	rows, err := repository.db.QueryContext(
+		ctx, `SELECT (SELECT COUNT(*) FROM "links") + (SELECT COUNT(*) FROM "link_aliases")`)
 	if err != nil {
 		return 1, err
 	}
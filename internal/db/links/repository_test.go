@@ -3,10 +3,14 @@ package links
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 	"github.com/DATA-DOG/go-sqlmock"
+	"net/url"
 	"reflect"
 	"regexp"
 	"testing"
+	"time"
 )
 
 func TestPostgresRepository_Create(t *testing.T) {
@@ -17,35 +21,96 @@ func TestPostgresRepository_Create(t *testing.T) {
 		ctx         context.Context
 		shortID     string
 		originalURL string
+		ownerID     string
+		options     Options
 	}
 
 	id := 1
 	shortID := "1"
 	originalURL := "https://google.com"
+	redirectType := 301
+
+	query := regexp.QuoteMeta(`
+		INSERT INTO "links" (
+			"short_id", "original_url", "redirect_type", "forward_query", "utm_params", "password_hash",
+			"max_clicks", "remaining_clicks", "rules", "split", "active_from", "active_until", "placeholder_url",
+			"is_prefix", "deep_link", "original_url_hash", "is_plain", "owner_id"
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
+		ON CONFLICT ("original_url_hash") WHERE "is_plain" AND "is_deleted" IS NOT TRUE
+			DO UPDATE SET "original_url" = "links"."original_url"
+		RETURNING "id", "short_id", "redirect_type"
+	`)
 
 	db, sqlMock, _ := sqlmock.New()
-	e := sqlMock.ExpectQuery(
-		regexp.QuoteMeta(`
-			INSERT INTO "links" ("short_id", "original_url") VALUES ($1, $2)
-			ON CONFLICT ("original_url") DO UPDATE SET "original_url" = "links"."original_url"
-			RETURNING "id", "short_id"
-		`))
-	e.WillReturnRows(sqlmock.NewRows([]string{"id", "short_id"}).AddRow(id, shortID))
-	e.WillReturnError(nil)
+	sqlMock.ExpectQuery(query).
+		WithArgs(shortID, originalURL, redirectType, true, "utm_source=newsletter", "", 0, "[]", nil, nil, nil, "",
+			false, nil, HashURL(originalURL), false, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "short_id", "redirect_type"}).AddRow(id, shortID, redirectType))
+
+	// the URL is shortened already, but the password must not be lost, so the link is a new one
+	sqlMock.ExpectQuery(query).
+		WithArgs("2", originalURL, 0, false, "", "hash", 0, "[]", nil, nil, nil, "", false, nil,
+			HashURL(originalURL), false, "user").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "short_id", "redirect_type"}).AddRow(2, "2", 0))
+
+	sqlMock.ExpectQuery(query).
+		WithArgs("3", originalURL, 0, false, "", "", 0, "[]", nil, nil, nil, "", false, nil,
+			HashURL(originalURL), true, "user").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "short_id", "redirect_type"}).AddRow(3, "1", 0))
+
+	// the only link of the URL has all clicks used, so it is deleted and does not conflict with a new one
+	sqlMock.ExpectQuery(query).
+		WithArgs("4", "https://example.com", 0, false, "", "", 0, "[]", nil, nil, nil, "", false, nil,
+			HashURL("https://example.com"), true, "").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "short_id", "redirect_type"}).AddRow(4, "4", 0))
 
 	tests := []struct {
 		name    string
 		fields  fields
 		args    args
 		want    *Link
-		wantErr bool
+		wantErr error
 	}{
 		{
-			name:    "should execute proper query",
+			name:   "should execute proper query",
+			fields: fields{db: db},
+			args: args{
+				ctx:         context.TODO(),
+				shortID:     shortID,
+				originalURL: originalURL,
+				options: Options{
+					RedirectType: redirectType,
+					ForwardQuery: true,
+					UTMParams:    url.Values{"utm_source": {"newsletter"}},
+				},
+			},
+			want: &Link{ID: id, ShortID: shortID, Options: Options{RedirectType: redirectType}},
+		},
+		{
+			name:   "should create protected link of shortened URL",
+			fields: fields{db: db},
+			args: args{
+				ctx:         context.TODO(),
+				shortID:     "2",
+				originalURL: originalURL,
+				ownerID:     "user",
+				options:     Options{PasswordHash: "hash"},
+			},
+			want: &Link{ID: 2, ShortID: "2"},
+		},
+		{
+			name:    "should return plain link of shortened URL",
 			fields:  fields{db: db},
-			args:    args{ctx: context.TODO(), shortID: shortID, originalURL: originalURL},
-			want:    &Link{ID: id, ShortID: shortID},
-			wantErr: false,
+			args:    args{ctx: context.TODO(), shortID: "3", originalURL: originalURL, ownerID: "user"},
+			want:    &Link{ID: 3, ShortID: "1"},
+			wantErr: ErrConflict,
+		},
+		{
+			name:   "should create new link of URL whose link is used up",
+			fields: fields{db: db},
+			args:   args{ctx: context.TODO(), shortID: "4", originalURL: "https://example.com"},
+			want:   &Link{ID: 4, ShortID: "4"},
 		},
 	}
 
@@ -54,9 +119,10 @@ func TestPostgresRepository_Create(t *testing.T) {
 			repository := &PostgresRepository{
 				db: tt.fields.db,
 			}
-			got, err := repository.Create(tt.args.ctx, tt.args.shortID, tt.args.originalURL)
+			got, err := repository.Create(
+				tt.args.ctx, tt.args.shortID, tt.args.originalURL, tt.args.ownerID, tt.args.options)
 
-			if (err != nil) != tt.wantErr {
+			if !errors.Is(err, tt.wantErr) {
 				t.Errorf("Create() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
@@ -66,6 +132,38 @@ func TestPostgresRepository_Create(t *testing.T) {
 			}
 		})
 	}
+
+	if err := sqlMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Create() did not execute proper queries: %v", err)
+	}
+}
+
+func TestOptions_IsPlain(t *testing.T) {
+	activeUntil := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		options Options
+		want    bool
+	}{
+		{name: "no options", options: Options{}, want: true},
+		{name: "redirect type", options: Options{RedirectType: 301}, want: false},
+		{name: "password", options: Options{PasswordHash: "hash"}, want: false},
+		{name: "max clicks", options: Options{MaxClicks: 1}, want: false},
+		{name: "rules", options: Options{Rules: []Rule{{Name: "ios", OS: "ios", URL: "https://apple.com"}}}, want: false},
+		{name: "split", options: Options{Split: &Split{}}, want: false},
+		{name: "schedule", options: Options{Schedule: Schedule{ActiveUntil: &activeUntil}}, want: false},
+		{name: "prefix", options: Options{IsPrefix: true}, want: false},
+		{name: "deep link", options: Options{DeepLink: &DeepLink{AppURL: "app://"}}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.options.IsPlain(); got != tt.want {
+				t.Errorf("IsPlain() = %v, want %v", got, tt.want)
+			}
+		})
+	}
 }
 
 func TestPostgresRepository_FindByShortID(t *testing.T) {
@@ -81,12 +179,32 @@ func TestPostgresRepository_FindByShortID(t *testing.T) {
 	shortID := "2"
 	originalURL := "https://google.com"
 	isDeleted := false
+	redirectType := 0
+	activeFrom := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
 
 	db, sqlMock, _ := sqlmock.New()
 	e := sqlMock.ExpectQuery(
-		regexp.QuoteMeta(`SELECT "id", "short_id", "original_url", "is_deleted" FROM "links" WHERE "short_id" = $1 LIMIT 1`))
-	e.WillReturnRows(sqlmock.NewRows([]string{"id", "short_id", "original_url", "is_deleted"}).AddRow(
-		id, shortID, originalURL, isDeleted))
+		regexp.QuoteMeta(`
+			SELECT
+				"id", "short_id", "original_url", "is_deleted", "redirect_type", "forward_query", "utm_params",
+				"password_hash", "max_clicks", "rules", "split", "active_from", "active_until", "placeholder_url",
+				"is_prefix", "deep_link", "created_at", "trust_override", "owner_id"
+			FROM "links"
+			WHERE "short_id" = $1 OR "id" = (SELECT "link_id" FROM "link_aliases" WHERE "short_id" = $1)
+			LIMIT 1
+		`))
+	e.WillReturnRows(
+		sqlmock.NewRows(
+			[]string{
+				"id", "short_id", "original_url", "is_deleted", "redirect_type", "forward_query", "utm_params",
+				"password_hash", "max_clicks", "rules", "split", "active_from", "active_until", "placeholder_url",
+				"is_prefix", "deep_link", "created_at", "trust_override", "owner_id"},
+		).AddRow(
+			id, shortID, originalURL, isDeleted, redirectType, false, "utm_medium=email", "hash", 1,
+			[]byte(`[{"name":"ios","os":"ios","url":"https://apps.apple.com"}]`),
+			[]byte(`{"rotation":"round_robin","destinations":[{"name":"a","url":"https://a.com"}]}`),
+			activeFrom, nil, "https://example.com/soon", true, []byte(`{"app_url":"myapp://home"}`),
+			activeFrom, "untrusted", "owner"))
 	e.WillReturnError(nil)
 
 	tests := []struct {
@@ -97,10 +215,31 @@ func TestPostgresRepository_FindByShortID(t *testing.T) {
 		wantErr bool
 	}{
 		{
-			name:    "should execute proper query",
-			args:    args{ctx: context.TODO(), shortID: shortID},
-			fields:  fields{db: db},
-			want:    &Link{ShortID: shortID, ID: id, OriginalURL: originalURL, IsDeleted: isDeleted},
+			name:   "should execute proper query",
+			args:   args{ctx: context.TODO(), shortID: shortID},
+			fields: fields{db: db},
+			want: &Link{
+				ShortID:       shortID,
+				ID:            id,
+				OriginalURL:   originalURL,
+				IsDeleted:     isDeleted,
+				CreatedAt:     activeFrom,
+				TrustOverride: TrustUntrusted,
+				OwnerID:       "owner",
+				Options: Options{
+					UTMParams:    url.Values{"utm_medium": {"email"}},
+					PasswordHash: "hash",
+					MaxClicks:    1,
+					Rules:        []Rule{{Name: "ios", OS: "ios", URL: "https://apps.apple.com"}},
+					Split: &Split{
+						Rotation:     RotationRoundRobin,
+						Destinations: []Destination{{Name: "a", URL: "https://a.com"}},
+					},
+					IsPrefix: true,
+					DeepLink: &DeepLink{AppURL: "myapp://home"},
+					Schedule: Schedule{ActiveFrom: &activeFrom, PlaceholderURL: "https://example.com/soon"},
+				},
+			},
 			wantErr: false,
 		},
 	}
@@ -123,3 +262,240 @@ func TestPostgresRepository_FindByShortID(t *testing.T) {
 		})
 	}
 }
+
+func TestPostgresRepository_UseClick(t *testing.T) {
+	type fields struct {
+		db *sql.DB
+	}
+	type args struct {
+		ctx context.Context
+		id  int
+	}
+
+	query := regexp.QuoteMeta(`
+		UPDATE "links"
+		SET "remaining_clicks" = "remaining_clicks" - 1, "is_deleted" = "remaining_clicks" <= 1
+		WHERE "id" = $1 AND "remaining_clicks" > 0 AND NOT "is_deleted"
+	`)
+
+	db, sqlMock, _ := sqlmock.New()
+	sqlMock.ExpectExec(query).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectExec(query).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:    "should take a click",
+			fields:  fields{db: db},
+			args:    args{ctx: context.TODO(), id: 1},
+			want:    true,
+			wantErr: false,
+		},
+		{
+			name:    "should report no clicks left",
+			fields:  fields{db: db},
+			args:    args{ctx: context.TODO(), id: 2},
+			want:    false,
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &PostgresRepository{
+				db: tt.fields.db,
+			}
+			got, err := repository.UseClick(tt.args.ctx, tt.args.id)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UseClick() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("UseClick() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgresRepository_RegisterBranch(t *testing.T) {
+	type fields struct {
+		db *sql.DB
+	}
+	type args struct {
+		ctx    context.Context
+		id     int
+		branch string
+	}
+
+	db, sqlMock, _ := sqlmock.New()
+	e := sqlMock.ExpectExec(
+		regexp.QuoteMeta(`
+			INSERT INTO "link_branches" ("link_id", "branch", "clicks") VALUES ($1, $2, 1)
+			ON CONFLICT ("link_id", "branch") DO UPDATE SET "clicks" = "link_branches"."clicks" + 1
+		`))
+	e.WithArgs(1, "ios")
+	e.WillReturnResult(sqlmock.NewResult(0, 1))
+
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		wantErr bool
+	}{
+		{
+			name:    "should execute proper query",
+			fields:  fields{db: db},
+			args:    args{ctx: context.TODO(), id: 1, branch: "ios"},
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &PostgresRepository{
+				db: tt.fields.db,
+			}
+
+			if err := repository.RegisterBranch(tt.args.ctx, tt.args.id, tt.args.branch); (err != nil) != tt.wantErr {
+				t.Errorf("RegisterBranch() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPostgresRepository_ListBranches(t *testing.T) {
+	type fields struct {
+		db *sql.DB
+	}
+	type args struct {
+		ctx context.Context
+		id  int
+	}
+
+	db, sqlMock, _ := sqlmock.New()
+	e := sqlMock.ExpectQuery(
+		regexp.QuoteMeta(`SELECT "branch", "clicks" FROM "link_branches" WHERE "link_id" = $1`))
+	e.WithArgs(1)
+	e.WillReturnRows(sqlmock.NewRows([]string{"branch", "clicks"}).AddRow("ios", 3).AddRow("default", 5))
+
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    map[string]int
+		wantErr bool
+	}{
+		{
+			name:    "should execute proper query",
+			fields:  fields{db: db},
+			args:    args{ctx: context.TODO(), id: 1},
+			want:    map[string]int{"ios": 3, "default": 5},
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &PostgresRepository{
+				db: tt.fields.db,
+			}
+			got, err := repository.ListBranches(tt.args.ctx, tt.args.id)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ListBranches() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ListBranches() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgresRepository_NextRotation(t *testing.T) {
+	type fields struct {
+		db *sql.DB
+	}
+	type args struct {
+		ctx context.Context
+		id  int
+	}
+
+	db, sqlMock, _ := sqlmock.New()
+	e := sqlMock.ExpectQuery(
+		regexp.QuoteMeta(
+			`UPDATE "links" SET "rotation_counter" = "rotation_counter" + 1 WHERE "id" = $1 RETURNING "rotation_counter"`))
+	e.WithArgs(1)
+	e.WillReturnRows(sqlmock.NewRows([]string{"rotation_counter"}).AddRow(7))
+
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    int
+		wantErr bool
+	}{
+		{
+			name:    "should execute proper query",
+			fields:  fields{db: db},
+			args:    args{ctx: context.TODO(), id: 1},
+			want:    7,
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &PostgresRepository{
+				db: tt.fields.db,
+			}
+			got, err := repository.NextRotation(tt.args.ctx, tt.args.id)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NextRotation() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("NextRotation() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgresRepository_UpdateSchedule(t *testing.T) {
+	activeUntil := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	db, sqlMock, _ := sqlmock.New()
+	sqlMock.ExpectExec(
+		regexp.QuoteMeta(
+			`UPDATE "links" SET "active_from" = $1, "active_until" = $2, "placeholder_url" = $3, "is_plain" = FALSE WHERE "id" = $4`)).
+		WithArgs(nil, activeUntil, "", 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	repository := &PostgresRepository{db: db}
+	err := repository.UpdateSchedule(context.TODO(), 1, Schedule{ActiveUntil: &activeUntil})
+	if err != nil {
+		t.Errorf("UpdateSchedule() error = %v", err)
+	}
+
+	if err := sqlMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("UpdateSchedule() expectations = %v", err)
+	}
+}
+
+func TestHashURL(t *testing.T) {
+	// sha256(convert_to('https://google.com', 'UTF8')) in Postgres
+	want := "05046f26c83e8c88b3ddab2eab63d0d16224ac1e564535fc75cdceee47a0938d"
+	if got := fmt.Sprintf("%x", HashURL("https://google.com")); got != want {
+		t.Errorf("HashURL() got = %v, want %v", got, want)
+	}
+}
@@ -52,12 +52,34 @@ func (db *SQLDB) CreateSchema() error {
 		return err
 	}
 
+	// original URLs are deduplicated by their hashes, so the URLs themselves can be of any length
 	_, err = db.instance.Exec(`
-		ALTER TABLE "links" ADD CONSTRAINT "unique_original_url" UNIQUE (original_url)
+		ALTER TABLE "links"
+			ALTER COLUMN "original_url" TYPE TEXT,
+			ADD COLUMN IF NOT EXISTS "original_url_hash" BYTEA NULL
 	`)
 
 	if err != nil {
-		log.Println("not able to create constraint")
+		log.Println("not able to ALTER links table with adding `original_url_hash` column")
+		return err
+	}
+
+	_, err = db.instance.Exec(`
+		UPDATE "links" SET "original_url_hash" = sha256(convert_to("original_url", 'UTF8'))
+		WHERE "original_url_hash" IS NULL
+	`)
+
+	if err != nil {
+		log.Println("not able to fill `original_url_hash` column")
+		return err
+	}
+
+	_, err = db.instance.Exec(`
+		ALTER TABLE "links" ALTER COLUMN "original_url_hash" SET NOT NULL
+	`)
+
+	if err != nil {
+		log.Println("not able to make `original_url_hash` column required")
 		return err
 	}
 
@@ -70,6 +92,313 @@ func (db *SQLDB) CreateSchema() error {
 		return err
 	}
 
+	_, err = db.instance.Exec(`
+		ALTER TABLE "links" ADD COLUMN IF NOT EXISTS "redirect_type" SMALLINT NOT NULL DEFAULT 0
+	`)
+
+	if err != nil {
+		log.Println("not able to ALTER links table with adding redirect type column")
+		return err
+	}
+
+	_, err = db.instance.Exec(`
+		ALTER TABLE "links"
+			ADD COLUMN IF NOT EXISTS "forward_query" BOOLEAN NOT NULL DEFAULT FALSE,
+			ADD COLUMN IF NOT EXISTS "utm_params" TEXT NOT NULL DEFAULT ''
+	`)
+
+	if err != nil {
+		log.Println("not able to ALTER links table with adding query forwarding columns")
+		return err
+	}
+
+	_, err = db.instance.Exec(`
+		ALTER TABLE "links" ADD COLUMN IF NOT EXISTS "password_hash" TEXT NOT NULL DEFAULT ''
+	`)
+
+	if err != nil {
+		log.Println("not able to ALTER links table with adding password hash column")
+		return err
+	}
+
+	_, err = db.instance.Exec(`
+		ALTER TABLE "links"
+			ADD COLUMN IF NOT EXISTS "max_clicks" INT NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS "remaining_clicks" INT NOT NULL DEFAULT 0
+	`)
+
+	if err != nil {
+		log.Println("not able to ALTER links table with adding clicks limit columns")
+		return err
+	}
+
+	_, err = db.instance.Exec(`
+		ALTER TABLE "links" ADD COLUMN IF NOT EXISTS "rules" JSONB NOT NULL DEFAULT '[]'
+	`)
+
+	if err != nil {
+		log.Println("not able to ALTER links table with adding rules column")
+		return err
+	}
+
+	_, err = db.instance.Exec(`
+		CREATE TABLE IF NOT EXISTS link_branches (
+			link_id INT NOT NULL,
+			branch VARCHAR(255) NOT NULL,
+			clicks INT NOT NULL DEFAULT 0,
+			PRIMARY KEY (link_id, branch),
+			CONSTRAINT fk_link
+				FOREIGN KEY(link_id)
+					REFERENCES links(id)
+		)
+	`)
+
+	if err != nil {
+		log.Println("not able to create `link_branches` table")
+		return err
+	}
+
+	_, err = db.instance.Exec(`
+		ALTER TABLE "links"
+			ADD COLUMN IF NOT EXISTS "split" JSONB NULL,
+			ADD COLUMN IF NOT EXISTS "rotation_counter" BIGINT NOT NULL DEFAULT 0
+	`)
+
+	if err != nil {
+		log.Println("not able to ALTER links table with adding split columns")
+		return err
+	}
+
+	_, err = db.instance.Exec(`
+		CREATE TABLE IF NOT EXISTS link_variants (
+			link_id INT NOT NULL,
+			variant VARCHAR(255) NOT NULL,
+			clicks INT NOT NULL DEFAULT 0,
+			PRIMARY KEY (link_id, variant),
+			CONSTRAINT fk_link
+				FOREIGN KEY(link_id)
+					REFERENCES links(id)
+		)
+	`)
+
+	if err != nil {
+		log.Println("not able to create `link_variants` table")
+		return err
+	}
+
+	_, err = db.instance.Exec(`
+		ALTER TABLE "links"
+			ADD COLUMN IF NOT EXISTS "active_from" TIMESTAMPTZ NULL,
+			ADD COLUMN IF NOT EXISTS "active_until" TIMESTAMPTZ NULL,
+			ADD COLUMN IF NOT EXISTS "placeholder_url" TEXT NOT NULL DEFAULT ''
+	`)
+
+	if err != nil {
+		log.Println("not able to ALTER links table with adding activation window columns")
+		return err
+	}
+
+	_, err = db.instance.Exec(`ALTER TABLE "links" ADD COLUMN IF NOT EXISTS "is_prefix" BOOLEAN NOT NULL DEFAULT FALSE`)
+
+	if err != nil {
+		log.Println("not able to ALTER links table with adding `is_prefix` column")
+		return err
+	}
+
+	_, err = db.instance.Exec(`ALTER TABLE "links" ADD COLUMN IF NOT EXISTS "deep_link" JSONB NULL`)
+
+	if err != nil {
+		log.Println("not able to ALTER links table with adding `deep_link` column")
+		return err
+	}
+
+	_, err = db.instance.Exec(`
+		ALTER TABLE "links"
+			ADD COLUMN IF NOT EXISTS "created_at" TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			ADD COLUMN IF NOT EXISTS "trust_override" VARCHAR(16) NOT NULL DEFAULT ''
+	`)
+
+	if err != nil {
+		log.Println("not able to ALTER links table with adding trust columns")
+		return err
+	}
+
+	_, err = db.instance.Exec(`
+		CREATE TABLE IF NOT EXISTS link_aliases (
+			short_id VARCHAR(255) NOT NULL,
+			link_id INT NOT NULL,
+			PRIMARY KEY (short_id),
+			CONSTRAINT fk_link
+				FOREIGN KEY(link_id)
+					REFERENCES links(id)
+		)
+	`)
+
+	if err != nil {
+		log.Println("not able to create `link_aliases` table")
+		return err
+	}
+
+	_, err = db.instance.Exec(`
+		CREATE TABLE IF NOT EXISTS api_keys (
+			id SERIAL PRIMARY KEY,
+			user_id VARCHAR(255) NOT NULL,
+			name VARCHAR(255) NOT NULL,
+			prefix VARCHAR(16) NOT NULL,
+			key_hash BYTEA NOT NULL,
+			scopes JSONB NOT NULL,
+			expires_at TIMESTAMPTZ NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			revoked_at TIMESTAMPTZ NULL,
+			CONSTRAINT unique_key_hash UNIQUE (key_hash)
+		)
+	`)
+
+	if err != nil {
+		log.Println("not able to create `api_keys` table")
+		return err
+	}
+
+	_, err = db.instance.Exec(`CREATE INDEX IF NOT EXISTS api_keys_user_id ON api_keys (user_id)`)
+
+	if err != nil {
+		log.Println("not able to create index on `api_keys` table")
+		return err
+	}
+
+	_, err = db.instance.Exec(`
+		CREATE TABLE IF NOT EXISTS accounts (
+			id SERIAL PRIMARY KEY,
+			user_id VARCHAR(64) NOT NULL,
+			login VARCHAR(255) NOT NULL,
+			password_hash VARCHAR(255) NOT NULL,
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			CONSTRAINT unique_account_user_id UNIQUE (user_id),
+			CONSTRAINT unique_account_login UNIQUE (login)
+		)
+	`)
+
+	if err != nil {
+		log.Println("not able to create `accounts` table")
+		return err
+	}
+
+	_, err = db.instance.Exec(`
+		ALTER TABLE "accounts"
+			ALTER COLUMN "login" DROP NOT NULL,
+			ADD COLUMN IF NOT EXISTS "issuer" VARCHAR(255) NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS "subject" VARCHAR(255) NOT NULL DEFAULT ''
+	`)
+
+	if err != nil {
+		log.Println("not able to ALTER accounts table with adding external identity columns")
+		return err
+	}
+
+	_, err = db.instance.Exec(`
+		CREATE UNIQUE INDEX IF NOT EXISTS "unique_account_subject" ON "accounts" ("issuer", "subject")
+			WHERE "subject" <> ''
+	`)
+
+	if err != nil {
+		log.Println("not able to create `unique_account_subject` index")
+		return err
+	}
+
+	_, err = db.instance.Exec(`
+		CREATE TABLE IF NOT EXISTS sessions (
+			id VARCHAR(64) PRIMARY KEY,
+			user_id VARCHAR(64) NOT NULL,
+			user_agent VARCHAR(255) NOT NULL DEFAULT '',
+			ip VARCHAR(64) NOT NULL DEFAULT '',
+			created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			expires_at TIMESTAMPTZ NULL,
+			revoked_at TIMESTAMPTZ NULL
+		)
+	`)
+
+	if err != nil {
+		log.Println("not able to create `sessions` table")
+		return err
+	}
+
+	_, err = db.instance.Exec(`CREATE INDEX IF NOT EXISTS sessions_user_id ON sessions (user_id)`)
+
+	if err != nil {
+		log.Println("not able to create index on `sessions` table")
+		return err
+	}
+
+	_, err = db.instance.Exec(`ALTER TABLE "links" ADD COLUMN IF NOT EXISTS "is_plain" BOOLEAN NOT NULL DEFAULT TRUE`)
+
+	if err != nil {
+		log.Println("not able to ALTER links table with adding `is_plain` column")
+		return err
+	}
+
+	_, err = db.instance.Exec(`
+		UPDATE "links" SET "is_plain" = FALSE
+		WHERE "is_plain" AND NOT (
+			"redirect_type" = 0 AND NOT "forward_query" AND "utm_params" = '' AND "password_hash" = ''
+			AND "max_clicks" = 0 AND "rules" = '[]' AND "split" IS NULL AND "active_from" IS NULL
+			AND "active_until" IS NULL AND "placeholder_url" = '' AND NOT "is_prefix" AND "deep_link" IS NULL
+		)
+	`)
+
+	if err != nil {
+		log.Println("not able to fill `is_plain` column")
+		return err
+	}
+
+	_, err = db.instance.Exec(`ALTER TABLE "links" ADD COLUMN IF NOT EXISTS "owner_id" VARCHAR(64) NOT NULL DEFAULT ''`)
+
+	if err != nil {
+		log.Println("not able to ALTER links table with adding `owner_id` column")
+		return err
+	}
+
+	// links shared by deduplication before belong to the user who made them shorter first
+	_, err = db.instance.Exec(`
+		UPDATE "links" AS l SET "owner_id" = ul."user_id"
+		FROM "user_links" AS ul
+		WHERE l."owner_id" = '' AND ul."id" = (
+			SELECT MIN(first."id") FROM "user_links" AS first WHERE first."link_id" = l."id"
+		)
+	`)
+
+	if err != nil {
+		log.Println("not able to fill `owner_id` column")
+		return err
+	}
+
+	// links with options are not deduplicated, otherwise the options of a new link would be lost,
+	// deleted links (e.g. with all clicks used) are not given for new links of the same URL either
+	_, err = db.instance.Exec(`DROP INDEX IF EXISTS "unique_original_url_hash"`)
+
+	if err != nil {
+		log.Println("not able to drop `unique_original_url_hash` index")
+		return err
+	}
+
+	_, err = db.instance.Exec(`
+		CREATE UNIQUE INDEX IF NOT EXISTS "unique_plain_original_url_hash" ON "links" ("original_url_hash")
+			WHERE "is_plain" AND "is_deleted" IS NOT TRUE
+	`)
+
+	if err != nil {
+		log.Println("not able to create `unique_plain_original_url_hash` index")
+		return err
+	}
+
+	// age of link owners is looked up on every redirect
+	_, err = db.instance.Exec(`CREATE INDEX IF NOT EXISTS "links_owner_id_created_at" ON "links" ("owner_id", "created_at")`)
+
+	if err != nil {
+		log.Println("not able to create `links_owner_id_created_at` index")
+		return err
+	}
+
 	log.Println("app schema was successfully restored")
 	return nil
 }
@@ -0,0 +1,111 @@
+package sessions
+
+import (
+	"context"
+	"github.com/magmel48/go-web/internal/auth"
+	"sort"
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often expired sessions are removed from memory.
+const pruneInterval = time.Minute
+
+// MemoryRepository keeps sessions in memory, it is for a single instance of the service, sessions are lost
+// on restart.
+type MemoryRepository struct {
+	mu        sync.Mutex
+	sessions  map[string]auth.Session
+	lastPrune time.Time
+	now       func() time.Time
+}
+
+// NewMemoryRepository returns new empty MemoryRepository.
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{sessions: make(map[string]auth.Session), now: time.Now}
+}
+
+// Create stores new session, expired sessions are removed from time to time.
+func (repository *MemoryRepository) Create(_ context.Context, session auth.Session) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	now := repository.now()
+	if now.Sub(repository.lastPrune) >= pruneInterval {
+		repository.lastPrune = now
+
+		for id, stored := range repository.sessions {
+			if stored.IsExpired(now) {
+				delete(repository.sessions, id)
+			}
+		}
+	}
+
+	userID := *session.UserID
+	session.UserID = &userID
+	session.UserAgent = truncateUserAgent(session.UserAgent)
+	repository.sessions[session.ID] = session
+
+	return nil
+}
+
+// Find finds not revoked session, nil means there is no such session.
+func (repository *MemoryRepository) Find(_ context.Context, id string) (*auth.Session, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	session, ok := repository.sessions[id]
+	if !ok {
+		return nil, nil
+	}
+
+	return &session, nil
+}
+
+// Touch updates last seen and expiration time of the session.
+func (repository *MemoryRepository) Touch(
+	_ context.Context, id string, lastSeenAt time.Time, expiresAt *time.Time) error {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	if session, ok := repository.sessions[id]; ok {
+		session.LastSeenAt, session.ExpiresAt = lastSeenAt, expiresAt
+		repository.sessions[id] = session
+	}
+
+	return nil
+}
+
+// List returns not expired sessions of the user.
+func (repository *MemoryRepository) List(_ context.Context, userID auth.UserID) ([]auth.Session, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	now := repository.now()
+	result := make([]auth.Session, 0)
+	for _, session := range repository.sessions {
+		if *session.UserID == *userID && !session.IsExpired(now) {
+			result = append(result, session)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastSeenAt.After(result[j].LastSeenAt)
+	})
+
+	return result, nil
+}
+
+// Revoke removes session of the user, false means the user has no such session.
+func (repository *MemoryRepository) Revoke(_ context.Context, userID auth.UserID, id string) (bool, error) {
+	repository.mu.Lock()
+	defer repository.mu.Unlock()
+
+	session, ok := repository.sessions[id]
+	if !ok || *session.UserID != *userID {
+		return false, nil
+	}
+
+	delete(repository.sessions, id)
+	return true, nil
+}
@@ -0,0 +1,177 @@
+package sessions
+
+import (
+	"context"
+	"database/sql"
+	"github.com/magmel48/go-web/internal/auth"
+	"log"
+	"time"
+)
+
+// postgresPruneInterval is how often expired and revoked sessions are removed from the database.
+const postgresPruneInterval = time.Hour
+
+// PostgresRepository is implementation of abstract Repository.
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+// NewPostgresRepository returns new PostgresRepository for working with sessions.
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db: db}
+}
+
+// Create stores new session.
+func (repository *PostgresRepository) Create(ctx context.Context, session auth.Session) error {
+	_, err := repository.db.ExecContext(
+		ctx,
+		`INSERT INTO "sessions" ("id", "user_id", "user_agent", "ip", "created_at", "last_seen_at", "expires_at") VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		session.ID,
+		*session.UserID,
+		truncateUserAgent(session.UserAgent),
+		session.IP,
+		session.CreatedAt,
+		session.LastSeenAt,
+		session.ExpiresAt)
+
+	return err
+}
+
+// Find finds not revoked session, nil means there is no such session.
+func (repository *PostgresRepository) Find(ctx context.Context, id string) (*auth.Session, error) {
+	rows, err := repository.db.QueryContext(
+		ctx,
+		`SELECT "id", "user_id", "user_agent", "ip", "created_at", "last_seen_at", "expires_at" FROM "sessions" WHERE "id" = $1 AND "revoked_at" IS NULL LIMIT 1`,
+		id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+
+	return scanSession(rows)
+}
+
+// Touch updates last seen and expiration time of the session.
+func (repository *PostgresRepository) Touch(
+	ctx context.Context, id string, lastSeenAt time.Time, expiresAt *time.Time) error {
+	_, err := repository.db.ExecContext(
+		ctx,
+		`UPDATE "sessions" SET "last_seen_at" = $2, "expires_at" = $3 WHERE "id" = $1`,
+		id,
+		lastSeenAt,
+		expiresAt)
+
+	return err
+}
+
+// List returns not revoked and not expired sessions of the user.
+func (repository *PostgresRepository) List(ctx context.Context, userID auth.UserID) ([]auth.Session, error) {
+	rows, err := repository.db.QueryContext(
+		ctx,
+		`SELECT "id", "user_id", "user_agent", "ip", "created_at", "last_seen_at", "expires_at" FROM "sessions" WHERE "user_id" = $1 AND "revoked_at" IS NULL AND ("expires_at" IS NULL OR "expires_at" > NOW()) ORDER BY "last_seen_at" DESC`,
+		*userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	result := make([]auth.Session, 0)
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, *session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Revoke revokes session of the user, false means the user has no such session.
+func (repository *PostgresRepository) Revoke(ctx context.Context, userID auth.UserID, id string) (bool, error) {
+	result, err := repository.db.ExecContext(
+		ctx,
+		`UPDATE "sessions" SET "revoked_at" = NOW() WHERE "id" = $1 AND "user_id" = $2 AND "revoked_at" IS NULL`,
+		id,
+		*userID)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// Prune removes sessions revoked or expired by now, returns number of removed sessions.
+func (repository *PostgresRepository) Prune(ctx context.Context, now time.Time) (int64, error) {
+	result, err := repository.db.ExecContext(
+		ctx,
+		`DELETE FROM "sessions" WHERE "revoked_at" IS NOT NULL OR "expires_at" <= $1`,
+		now)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// PruneUntilDone prunes sessions periodically until ctx is done.
+func (repository *PostgresRepository) PruneUntilDone(ctx context.Context) {
+	ticker := time.NewTicker(postgresPruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := repository.Prune(ctx, time.Now()); err != nil {
+				log.Println("sessions prune error", err)
+			}
+		}
+	}
+}
+
+// scanSession reads session from the current row.
+func scanSession(rows *sql.Rows) (*auth.Session, error) {
+	var (
+		session   auth.Session
+		userID    string
+		expiresAt sql.NullTime
+	)
+
+	err := rows.Scan(
+		&session.ID,
+		&userID,
+		&session.UserAgent,
+		&session.IP,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&expiresAt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if expiresAt.Valid {
+		session.ExpiresAt = &expiresAt.Time
+	}
+
+	session.UserID = &userID
+	return &session, nil
+}
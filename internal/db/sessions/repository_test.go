@@ -0,0 +1,155 @@
+package sessions
+
+import (
+	"context"
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/magmel48/go-web/internal/auth"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestPostgresRepository_List(t *testing.T) {
+	userID := "test_user_id"
+	createdAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	lastSeenAt := createdAt.Add(time.Hour)
+	expiresAt := createdAt.Add(24 * time.Hour)
+
+	db, sqlMock, _ := sqlmock.New()
+	sqlMock.ExpectQuery(regexp.QuoteMeta(
+		`SELECT "id", "user_id", "user_agent", "ip", "created_at", "last_seen_at", "expires_at" FROM "sessions" WHERE "user_id" = $1 AND "revoked_at" IS NULL AND ("expires_at" IS NULL OR "expires_at" > NOW()) ORDER BY "last_seen_at" DESC`)).
+		WithArgs(userID).
+		WillReturnRows(
+			sqlmock.NewRows([]string{"id", "user_id", "user_agent", "ip", "created_at", "last_seen_at", "expires_at"}).
+				AddRow("first", userID, "curl/8.0", "127.0.0.1", createdAt, lastSeenAt, expiresAt).
+				AddRow("second", userID, "Mozilla/5.0", "10.0.0.1", createdAt, createdAt, nil))
+
+	want := []auth.Session{
+		{
+			ID:         "first",
+			UserID:     &userID,
+			UserAgent:  "curl/8.0",
+			IP:         "127.0.0.1",
+			CreatedAt:  createdAt,
+			LastSeenAt: lastSeenAt,
+			ExpiresAt:  &expiresAt,
+		},
+		{ID: "second", UserID: &userID, UserAgent: "Mozilla/5.0", IP: "10.0.0.1", CreatedAt: createdAt, LastSeenAt: createdAt},
+	}
+
+	repository := &PostgresRepository{db: db}
+	got, err := repository.List(context.TODO(), &userID)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("List() got = %v, want %v", got, want)
+	}
+}
+
+func TestPostgresRepository_Revoke(t *testing.T) {
+	userID := "test_user_id"
+	query := regexp.QuoteMeta(
+		`UPDATE "sessions" SET "revoked_at" = NOW() WHERE "id" = $1 AND "user_id" = $2 AND "revoked_at" IS NULL`)
+
+	db, sqlMock, _ := sqlmock.New()
+	sqlMock.ExpectExec(query).WithArgs("first", userID).WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectExec(query).WithArgs("unknown", userID).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	tests := []struct {
+		name string
+		id   string
+		want bool
+	}{
+		{name: "should revoke session", id: "first", want: true},
+		{name: "should report unknown session", id: "unknown", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &PostgresRepository{db: db}
+			got, err := repository.Revoke(context.TODO(), &userID, tt.id)
+			if err != nil {
+				t.Fatalf("Revoke() error = %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("Revoke() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPostgresRepository_Prune(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	db, sqlMock, _ := sqlmock.New()
+	sqlMock.ExpectExec(regexp.QuoteMeta(
+		`DELETE FROM "sessions" WHERE "revoked_at" IS NOT NULL OR "expires_at" <= $1`)).
+		WithArgs(now).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+
+	repository := &PostgresRepository{db: db}
+	got, err := repository.Prune(context.TODO(), now)
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+
+	if got != 3 {
+		t.Errorf("Prune() got = %v, want 3", got)
+	}
+
+	if err = sqlMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestMemoryRepository(t *testing.T) {
+	userID := "test_user_id"
+	otherUserID := "other_user_id"
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	expired := now.Add(-time.Second)
+
+	repository := NewMemoryRepository()
+	repository.now = func() time.Time { return now }
+
+	sessions := []auth.Session{
+		{ID: "old", UserID: &userID, LastSeenAt: now.Add(-time.Hour)},
+		{ID: "new", UserID: &userID, LastSeenAt: now},
+		{ID: "expired", UserID: &userID, LastSeenAt: now, ExpiresAt: &expired},
+		{ID: "other", UserID: &otherUserID, LastSeenAt: now},
+	}
+
+	for _, session := range sessions {
+		if err := repository.Create(context.TODO(), session); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+	}
+
+	got, _ := repository.List(context.TODO(), &userID)
+	if len(got) != 2 || got[0].ID != "new" || got[1].ID != "old" {
+		t.Errorf("List() got = %v, want new and old sessions", got)
+	}
+
+	if revoked, _ := repository.Revoke(context.TODO(), &userID, "other"); revoked {
+		t.Errorf("Revoke() revoked session of other user")
+	}
+
+	if revoked, _ := repository.Revoke(context.TODO(), &userID, "old"); !revoked {
+		t.Errorf("Revoke() did not revoke session")
+	}
+
+	if session, _ := repository.Find(context.TODO(), "old"); session != nil {
+		t.Errorf("Find() got revoked session %v", session)
+	}
+
+	if err := repository.Touch(context.TODO(), "new", now.Add(time.Minute), nil); err != nil {
+		t.Fatalf("Touch() error = %v", err)
+	}
+
+	if session, _ := repository.Find(context.TODO(), "new"); session == nil || !session.LastSeenAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("Find() got = %v, want touched session", session)
+	}
+}
@@ -0,0 +1,30 @@
+// Package sessions keeps server-side sessions of users, so users can see where they are logged in and log out
+// stolen sessions.
+package sessions
+
+import (
+	"context"
+	"github.com/magmel48/go-web/internal/auth"
+)
+
+// maxUserAgentLength limits stored user agents, they are for people only.
+const maxUserAgentLength = 255
+
+// Repository is common interface for a work with sessions implementation.
+//go:generate mockery --name=Repository
+type Repository interface {
+	auth.SessionStore
+	// List returns active sessions of the user, the last seen go first.
+	List(ctx context.Context, userID auth.UserID) ([]auth.Session, error)
+	// Revoke revokes session of the user, false means the user has no such session.
+	Revoke(ctx context.Context, userID auth.UserID, id string) (bool, error)
+}
+
+// truncateUserAgent cuts too long user agents.
+func truncateUserAgent(userAgent string) string {
+	if len(userAgent) > maxUserAgentLength {
+		return userAgent[:maxUserAgentLength]
+	}
+
+	return userAgent
+}
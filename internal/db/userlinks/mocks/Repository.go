@@ -65,6 +65,29 @@ func (_m *Repository) FindByLinkID(ctx context.Context, userID *string, linkID i
 	return r0, r1
 }
 
+// FindOwner provides a mock function with given fields: ctx, ownerID
+func (_m *Repository) FindOwner(ctx context.Context, ownerID string) (*userlinks.Owner, error) {
+	ret := _m.Called(ctx, ownerID)
+
+	var r0 *userlinks.Owner
+	if rf, ok := ret.Get(0).(func(context.Context, string) *userlinks.Owner); ok {
+		r0 = rf(ctx, ownerID)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*userlinks.Owner)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, ownerID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // List provides a mock function with given fields: ctx, userID
 func (_m *Repository) List(ctx context.Context, userID *string) ([]userlinks.UserLink, error) {
 	ret := _m.Called(ctx, userID)
@@ -87,3 +110,17 @@ func (_m *Repository) List(ctx context.Context, userID *string) ([]userlinks.Use
 
 	return r0, r1
 }
+
+// Reassign provides a mock function with given fields: ctx, fromUserID, toUserID
+func (_m *Repository) Reassign(ctx context.Context, fromUserID *string, toUserID *string) error {
+	ret := _m.Called(ctx, fromUserID, toUserID)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, *string, *string) error); ok {
+		r0 = rf(ctx, fromUserID, toUserID)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
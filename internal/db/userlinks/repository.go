@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/magmel48/go-web/internal/auth"
 	"github.com/magmel48/go-web/internal/db/links"
+	"log"
 	"strings"
 )
 
@@ -90,17 +91,81 @@ func (repository *PostgresRepository) FindByLinkID(ctx context.Context, userID a
 	return nil, nil
 }
 
-// DeleteLinks deletes user links by batches with many links inside.
+// FindOwner returns creation time of the oldest link of the owner and whether the owner has an account.
+func (repository *PostgresRepository) FindOwner(ctx context.Context, ownerID string) (*Owner, error) {
+	var firstLinkAt sql.NullTime
+	owner := Owner{}
+
+	err := repository.db.QueryRowContext(
+		ctx,
+		`
+			SELECT MIN(l."created_at"), EXISTS (SELECT 1 FROM "accounts" AS a WHERE a."user_id" = $1)
+			FROM "links" AS l WHERE l."owner_id" = $1
+		`,
+		ownerID).Scan(&firstLinkAt, &owner.Registered)
+	if err != nil {
+		return nil, err
+	}
+
+	if firstLinkAt.Valid {
+		owner.FirstLinkAt = &firstLinkAt.Time
+	}
+
+	return &owner, nil
+}
+
+// Reassign gives every link of one user to another one in one transaction, links the other user has already
+// are not duplicated. Ownership of the links is given too.
+func (repository *PostgresRepository) Reassign(
+	ctx context.Context, fromUserID auth.UserID, toUserID auth.UserID) error {
+	tx, err := repository.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := tx.Rollback()
+		if err != nil && err != sql.ErrTxDone {
+			log.Println("Reassign tx rollback error", err)
+		}
+	}()
+
+	if _, err := tx.ExecContext(
+		ctx,
+		`
+			UPDATE "user_links" AS ul SET "user_id" = $2
+			WHERE ul."user_id" = $1 AND NOT EXISTS (
+				SELECT 1 FROM "user_links" AS other WHERE other."user_id" = $2 AND other."link_id" = ul."link_id"
+			)
+		`,
+		*fromUserID,
+		*toUserID); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM "user_links" WHERE "user_id" = $1`, *fromUserID); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(
+		ctx, `UPDATE "links" SET "owner_id" = $2 WHERE "owner_id" = $1`, *fromUserID, *toUserID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteLinks deletes user links by batches with many links inside, only owners can delete links.
 func (repository *PostgresRepository) DeleteLinks(ctx context.Context, deleteQueryItems []DeleteQueryItem) error {
 	query := `
 		UPDATE "links" AS l
 		SET "is_deleted" = true
-		FROM "user_links" AS ul WHERE
+		WHERE
 	`
 
 	clauses := make([]string, len(deleteQueryItems))
 	for i := range deleteQueryItems {
-		clause := fmt.Sprintf(`l."short_id" = ANY ($%d) AND l."id" = ul."link_id" AND ul."user_id" = $%d`, 2*i+1, 2*i+2)
+		clause := fmt.Sprintf(`(l."short_id" = ANY ($%d) AND l."owner_id" = $%d)`, 2*i+1, 2*i+2)
 		clauses[i] = clause
 	}
 
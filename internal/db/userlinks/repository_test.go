@@ -3,6 +3,7 @@ package userlinks
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/magmel48/go-web/internal/auth"
 	"github.com/magmel48/go-web/internal/benchmarking"
@@ -12,6 +13,7 @@ import (
 	"regexp"
 	"strconv"
 	"testing"
+	"time"
 )
 
 func TestPostgresRepository_Create(t *testing.T) {
@@ -172,6 +174,106 @@ func TestPostgresRepository_FindByLinkID(t *testing.T) {
 	}
 }
 
+func TestPostgresRepository_FindOwner(t *testing.T) {
+	firstLinkAt := time.Unix(1700000000, 0)
+
+	db, sqlMock, _ := sqlmock.New()
+	query := regexp.QuoteMeta(`
+		SELECT MIN(l."created_at"), EXISTS (SELECT 1 FROM "accounts" AS a WHERE a."user_id" = $1)
+		FROM "links" AS l WHERE l."owner_id" = $1`)
+	sqlMock.ExpectQuery(query).WithArgs("registered_user").WillReturnRows(
+		sqlmock.NewRows([]string{"min", "exists"}).AddRow(firstLinkAt, true))
+	sqlMock.ExpectQuery(query).WithArgs("unknown_user").WillReturnRows(
+		sqlmock.NewRows([]string{"min", "exists"}).AddRow(nil, false))
+
+	tests := []struct {
+		name    string
+		ownerID string
+		want    *Owner
+	}{
+		{name: "should return first link time of registered owner", ownerID: "registered_user", want: &Owner{FirstLinkAt: &firstLinkAt, Registered: true}},
+		{name: "should return owner without links", ownerID: "unknown_user", want: &Owner{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repository := &PostgresRepository{db: db}
+			got, err := repository.FindOwner(context.TODO(), tt.ownerID)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+
+	require.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+// arrayConverter passes arrays to the query as the Postgres driver does.
+type arrayConverter struct{}
+
+func (arrayConverter) ConvertValue(v interface{}) (driver.Value, error) {
+	if ids, ok := v.([]string); ok {
+		return ids, nil
+	}
+
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+func TestPostgresRepository_DeleteLinks(t *testing.T) {
+	firstUserID := "first_user_id"
+	secondUserID := "second_user_id"
+
+	db, sqlMock, _ := sqlmock.New(sqlmock.ValueConverterOption(arrayConverter{}))
+	sqlMock.ExpectExec(regexp.QuoteMeta(`
+		UPDATE "links" AS l
+		SET "is_deleted" = true
+		WHERE
+		(l."short_id" = ANY ($1) AND l."owner_id" = $2) OR (l."short_id" = ANY ($3) AND l."owner_id" = $4)
+	`)).
+		WithArgs([]string{"1"}, firstUserID, []string{"2", "3"}, secondUserID).
+		WillReturnResult(sqlmock.NewResult(0, 2))
+
+	repository := &PostgresRepository{db: db}
+	err := repository.DeleteLinks(context.TODO(), []DeleteQueryItem{
+		{UserID: &firstUserID, ShortIDs: []string{"1"}},
+		{UserID: &secondUserID, ShortIDs: []string{"2", "3"}},
+	})
+	if err != nil {
+		t.Errorf("DeleteLinks() error = %v", err)
+	}
+
+	if err := sqlMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("DeleteLinks() did not execute proper queries: %v", err)
+	}
+}
+
+func TestPostgresRepository_Reassign(t *testing.T) {
+	fromUserID := "anonymous_user_id"
+	toUserID := "account_user_id"
+
+	db, sqlMock, _ := sqlmock.New()
+	sqlMock.ExpectBegin()
+	sqlMock.ExpectExec(regexp.QuoteMeta(`UPDATE "user_links" AS ul SET "user_id" = $2`)).
+		WithArgs(fromUserID, toUserID).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	sqlMock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "user_links" WHERE "user_id" = $1`)).
+		WithArgs(fromUserID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectExec(regexp.QuoteMeta(`UPDATE "links" SET "owner_id" = $2 WHERE "owner_id" = $1`)).
+		WithArgs(fromUserID, toUserID).
+		WillReturnResult(sqlmock.NewResult(0, 3))
+	sqlMock.ExpectCommit()
+
+	repository := &PostgresRepository{db: db}
+	if err := repository.Reassign(context.TODO(), &fromUserID, &toUserID); err != nil {
+		t.Errorf("Reassign() error = %v", err)
+	}
+
+	if err := sqlMock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Reassign() did not execute proper queries: %v", err)
+	}
+}
+
 func BenchmarkPostgresRepository_List(b *testing.B) {
 	db, err := benchmarking.DBConnect()
 	require.NoError(b, err, "database connection error")
@@ -4,6 +4,7 @@ import (
 	"context"
 	"github.com/magmel48/go-web/internal/auth"
 	"github.com/magmel48/go-web/internal/db/links"
+	"time"
 )
 
 // UserLink is representing database table and a user link DTO at the same time.
@@ -20,6 +21,14 @@ type DeleteQueryItem struct {
 	ShortIDs []string
 }
 
+// Owner is what is known about the owner of links for trust decisions.
+type Owner struct {
+	// FirstLinkAt is creation time of the oldest link of the owner, nil if the owner has no links.
+	FirstLinkAt *time.Time
+	// Registered is true if the owner has an account.
+	Registered bool
+}
+
 // Repository is common interface for a work with user links implementation.
 //go:generate mockery --name=Repository
 type Repository interface {
@@ -27,4 +36,6 @@ type Repository interface {
 	List(ctx context.Context, userID auth.UserID) ([]UserLink, error)
 	FindByLinkID(ctx context.Context, userID auth.UserID, linkID int) (*UserLink, error)
 	DeleteLinks(ctx context.Context, deleteQueryItems []DeleteQueryItem) error
+	FindOwner(ctx context.Context, ownerID string) (*Owner, error)
+	Reassign(ctx context.Context, fromUserID auth.UserID, toUserID auth.UserID) error
 }
@@ -0,0 +1,191 @@
+// Package identity manages accounts of registered users, anonymous users are known by session cookies only.
+package identity
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/magmel48/go-web/internal/auth"
+	"github.com/magmel48/go-web/internal/db"
+	"github.com/magmel48/go-web/internal/db/accounts"
+	"github.com/magmel48/go-web/internal/db/userlinks"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"sync"
+)
+
+const (
+	maxLoginLength    = 255
+	minPasswordLength = 8
+	// maxPasswordLength is limit of bcrypt, longer passwords are truncated by it silently.
+	maxPasswordLength = 72
+)
+
+// ErrWrongLogin is using for notifying clients that a login is empty or too long.
+var ErrWrongLogin = fmt.Errorf("login must have from 1 to %d characters", maxLoginLength)
+
+// ErrWeakPassword is using for notifying clients that a password is too short or too long.
+var ErrWeakPassword = fmt.Errorf(
+	"password must have from %d to %d characters", minPasswordLength, maxPasswordLength)
+
+// ErrAccountExists is using for notifying clients that a login is taken already.
+var ErrAccountExists = errors.New("account already exists")
+
+// ErrWrongCredentials is using for notifying clients that there is no account with such login and password.
+var ErrWrongCredentials = errors.New("wrong login or password")
+
+// Service registers users and logs them in.
+type Service struct {
+	accounts  accounts.Repository
+	userLinks userlinks.Repository
+}
+
+// NewService creates new Service.
+func NewService(database db.DB) Service {
+	return Service{
+		accounts:  accounts.NewPostgresRepository(database.Instance()),
+		userLinks: userlinks.NewPostgresRepository(database.Instance()),
+	}
+}
+
+// Register creates account for the current user, so the user keeps links made before registration.
+// If the current user has an account already, the new account gets new user identifier.
+func (s Service) Register(
+	ctx context.Context, userID auth.UserID, login string, password string) (*accounts.Account, error) {
+	login, err := normalizeLogin(login)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return nil, ErrWeakPassword
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	if userID == nil {
+		userID = auth.NewUserID()
+	} else if current, err := s.accounts.FindByUserID(ctx, userID); err != nil {
+		return nil, err
+	} else if current != nil {
+		userID = auth.NewUserID()
+	}
+
+	account, err := s.accounts.Create(ctx, accounts.Account{UserID: userID, Login: login, PasswordHash: string(hash)})
+	if errors.Is(err, accounts.ErrConflict) {
+		return nil, ErrAccountExists
+	}
+
+	return account, err
+}
+
+// Login checks credentials and returns the account. Links of the current user are given to the account
+// if the user is anonymous.
+func (s Service) Login(
+	ctx context.Context, userID auth.UserID, login string, password string) (*accounts.Account, error) {
+	login, err := normalizeLogin(login)
+	if err != nil {
+		return nil, ErrWrongCredentials
+	}
+
+	account, err := s.accounts.FindByLogin(ctx, login)
+	if err != nil {
+		return nil, err
+	}
+
+	if account == nil {
+		// spends the same time as for existing accounts, so logins cannot be found by response time
+		_ = bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return nil, ErrWrongCredentials
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(account.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrWrongCredentials
+	}
+
+	if err := s.mergeAnonymousLinks(ctx, userID, account); err != nil {
+		return nil, err
+	}
+
+	return account, nil
+}
+
+// LoginSubject logs in the user authenticated by an external identity provider and returns the account.
+// The account is created on the first login, the current anonymous user becomes its owner, so links made
+// before the login are kept. Links of the anonymous user are given to existing accounts as on Login.
+func (s Service) LoginSubject(
+	ctx context.Context, userID auth.UserID, issuer string, subject string) (*accounts.Account, error) {
+	if issuer == "" || subject == "" {
+		return nil, ErrWrongCredentials
+	}
+
+	account, err := s.accounts.FindBySubject(ctx, issuer, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if account != nil {
+		if err := s.mergeAnonymousLinks(ctx, userID, account); err != nil {
+			return nil, err
+		}
+
+		return account, nil
+	}
+
+	if userID == nil || *userID == "" {
+		userID = auth.NewUserID()
+	} else if current, err := s.accounts.FindByUserID(ctx, userID); err != nil {
+		return nil, err
+	} else if current != nil {
+		userID = auth.NewUserID()
+	}
+
+	account, err = s.accounts.Create(ctx, accounts.Account{UserID: userID, Issuer: issuer, Subject: subject})
+	if errors.Is(err, accounts.ErrConflict) {
+		// the same user has logged in concurrently
+		return s.accounts.FindBySubject(ctx, issuer, subject)
+	}
+
+	return account, err
+}
+
+// mergeAnonymousLinks gives links of the anonymous user to the account, links of other accounts are kept.
+func (s Service) mergeAnonymousLinks(ctx context.Context, userID auth.UserID, account *accounts.Account) error {
+	if userID == nil || *userID == "" || *userID == *account.UserID {
+		return nil
+	}
+
+	current, err := s.accounts.FindByUserID(ctx, userID)
+	if err != nil || current != nil {
+		return err
+	}
+
+	return s.userLinks.Reassign(ctx, userID, account.UserID)
+}
+
+// normalizeLogin makes logins case-insensitive.
+func normalizeLogin(login string) (string, error) {
+	login = strings.ToLower(strings.TrimSpace(login))
+	if login == "" || len(login) > maxLoginLength {
+		return "", ErrWrongLogin
+	}
+
+	return login, nil
+}
+
+var (
+	dummyHashOnce  sync.Once
+	dummyHashValue []byte
+)
+
+// dummyHash returns hash of no password with the same cost as real ones.
+func dummyHash() []byte {
+	dummyHashOnce.Do(func() {
+		dummyHashValue, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	})
+
+	return dummyHashValue
+}
@@ -0,0 +1,206 @@
+package identity
+
+import (
+	"context"
+	"github.com/magmel48/go-web/internal/db/accounts"
+	accountsmocks "github.com/magmel48/go-web/internal/db/accounts/mocks"
+	userlinksmocks "github.com/magmel48/go-web/internal/db/userlinks/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+	"testing"
+)
+
+func TestService_Register(t *testing.T) {
+	anonymousID := "anonymous_user_id"
+	accountUserID := "account_user_id"
+
+	tests := []struct {
+		name         string
+		userID       string
+		login        string
+		password     string
+		current      *accounts.Account
+		createErr    error
+		wantErr      error
+		wantSameUser bool
+	}{
+		{
+			name:         "should register current anonymous user",
+			userID:       anonymousID,
+			login:        " Alice ",
+			password:     "correct horse",
+			wantSameUser: true,
+		},
+		{
+			name:     "should give new user identifier if current user has account",
+			userID:   accountUserID,
+			login:    "bob",
+			password: "correct horse",
+			current:  &accounts.Account{ID: 1, UserID: &accountUserID, Login: "alice"},
+		},
+		{name: "should reject empty login", userID: anonymousID, login: " ", password: "correct horse", wantErr: ErrWrongLogin},
+		{name: "should reject short password", userID: anonymousID, login: "alice", password: "short", wantErr: ErrWeakPassword},
+		{
+			name:      "should reject taken login",
+			userID:    anonymousID,
+			login:     "alice",
+			password:  "correct horse",
+			createErr: accounts.ErrConflict,
+			wantErr:   ErrAccountExists,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := tt.userID
+
+			accountsRepository := &accountsmocks.Repository{}
+			accountsRepository.On("FindByUserID", mock.Anything, &userID).Return(tt.current, nil)
+			accountsRepository.On("Create", mock.Anything, mock.Anything).Return(
+				func(_ context.Context, account accounts.Account) *accounts.Account {
+					if tt.createErr != nil {
+						return nil
+					}
+
+					return &account
+				}, tt.createErr)
+
+			s := Service{accounts: accountsRepository}
+			got, err := s.Register(context.TODO(), &userID, tt.login, tt.password)
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr != nil {
+				return
+			}
+
+			assert.Equal(t, strings.ToLower(strings.TrimSpace(tt.login)), got.Login)
+			assert.Equal(t, tt.wantSameUser, *got.UserID == userID)
+			assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(got.PasswordHash), []byte(tt.password)))
+		})
+	}
+}
+
+func TestService_Login(t *testing.T) {
+	anonymousID := "anonymous_user_id"
+	otherAccountUserID := "other_account_user_id"
+	accountUserID := "account_user_id"
+	hash, _ := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	account := &accounts.Account{ID: 1, UserID: &accountUserID, Login: "alice", PasswordHash: string(hash)}
+
+	tests := []struct {
+		name      string
+		userID    string
+		login     string
+		password  string
+		current   *accounts.Account
+		wantErr   error
+		wantMerge bool
+	}{
+		{name: "should merge anonymous links", userID: anonymousID, login: "Alice", password: "correct horse", wantMerge: true},
+		{
+			name:     "should keep links of other account",
+			userID:   otherAccountUserID,
+			login:    "alice",
+			password: "correct horse",
+			current:  &accounts.Account{ID: 2, UserID: &otherAccountUserID},
+		},
+		{name: "should not merge the same user", userID: accountUserID, login: "alice", password: "correct horse"},
+		{name: "should reject wrong password", userID: anonymousID, login: "alice", password: "wrong horse", wantErr: ErrWrongCredentials},
+		{name: "should reject unknown login", userID: anonymousID, login: "bob", password: "correct horse", wantErr: ErrWrongCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := tt.userID
+
+			accountsRepository := &accountsmocks.Repository{}
+			accountsRepository.On("FindByLogin", mock.Anything, "alice").Return(account, nil)
+			accountsRepository.On("FindByLogin", mock.Anything, "bob").Return(nil, nil)
+			accountsRepository.On("FindByUserID", mock.Anything, &userID).Return(tt.current, nil)
+
+			userLinksRepository := &userlinksmocks.Repository{}
+			userLinksRepository.On("Reassign", mock.Anything, &userID, &accountUserID).Return(nil)
+
+			s := Service{accounts: accountsRepository, userLinks: userLinksRepository}
+			got, err := s.Login(context.TODO(), &userID, tt.login, tt.password)
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr != nil {
+				return
+			}
+
+			assert.Equal(t, account, got)
+			if tt.wantMerge {
+				userLinksRepository.AssertCalled(t, "Reassign", mock.Anything, &userID, &accountUserID)
+			} else {
+				userLinksRepository.AssertNotCalled(t, "Reassign", mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestService_LoginSubject(t *testing.T) {
+	anonymousID := "anonymous_user_id"
+	accountUserID := "account_user_id"
+	issuer := "https://idp.example.com"
+	account := &accounts.Account{ID: 1, UserID: &accountUserID, Issuer: issuer, Subject: "alice"}
+
+	tests := []struct {
+		name         string
+		subject      string
+		current      *accounts.Account
+		wantErr      error
+		wantMerge    bool
+		wantCreate   bool
+		wantSameUser bool
+	}{
+		{name: "should merge anonymous links into linked account", subject: "alice", wantMerge: true},
+		{name: "should create account for current anonymous user", subject: "bob", wantCreate: true, wantSameUser: true},
+		{
+			name:       "should create account for new user if current user has account",
+			subject:    "bob",
+			current:    &accounts.Account{ID: 2, UserID: &anonymousID, Login: "carol"},
+			wantCreate: true,
+		},
+		{name: "should reject empty subject", subject: "", wantErr: ErrWrongCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID := anonymousID
+
+			accountsRepository := &accountsmocks.Repository{}
+			accountsRepository.On("FindBySubject", mock.Anything, issuer, "alice").Return(account, nil)
+			accountsRepository.On("FindBySubject", mock.Anything, issuer, "bob").Return(nil, nil)
+			accountsRepository.On("FindByUserID", mock.Anything, &userID).Return(tt.current, nil)
+			accountsRepository.On("Create", mock.Anything, mock.Anything).Return(
+				func(_ context.Context, account accounts.Account) *accounts.Account {
+					return &account
+				}, nil)
+
+			userLinksRepository := &userlinksmocks.Repository{}
+			userLinksRepository.On("Reassign", mock.Anything, &userID, &accountUserID).Return(nil)
+
+			s := Service{accounts: accountsRepository, userLinks: userLinksRepository}
+			got, err := s.LoginSubject(context.TODO(), &userID, issuer, tt.subject)
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr != nil {
+				return
+			}
+
+			assert.Equal(t, tt.subject, got.Subject)
+			assert.Equal(t, tt.wantSameUser, *got.UserID == userID)
+			if tt.wantCreate {
+				accountsRepository.AssertCalled(t, "Create", mock.Anything, mock.Anything)
+			} else {
+				accountsRepository.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+			}
+
+			if tt.wantMerge {
+				userLinksRepository.AssertCalled(t, "Reassign", mock.Anything, &userID, &accountUserID)
+			} else {
+				userLinksRepository.AssertNotCalled(t, "Reassign", mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
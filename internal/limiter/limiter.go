@@ -0,0 +1,42 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter counts attempts by keys and restricts their number within fixed time window.
+type Limiter struct {
+	mu          sync.Mutex
+	limit       int
+	window      time.Duration
+	windowStart time.Time
+	attempts    map[string]int
+	now         func() time.Time
+}
+
+// NewLimiter creates new Limiter that allows limit attempts per key during every window.
+func NewLimiter(limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		limit:    limit,
+		window:   window,
+		attempts: make(map[string]int),
+		now:      time.Now,
+	}
+}
+
+// Allow registers new attempt by the key and checks if it is still within the limit.
+func (limiter *Limiter) Allow(key string) bool {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	// all counters are reset at once, so memory is not growing with keys from previous windows
+	if now := limiter.now(); now.Sub(limiter.windowStart) >= limiter.window {
+		limiter.windowStart = now
+		limiter.attempts = make(map[string]int)
+	}
+
+	limiter.attempts[key]++
+
+	return limiter.attempts[key] <= limiter.limit
+}
@@ -0,0 +1,50 @@
+package limiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	type args struct {
+		keys []string
+	}
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		args    args
+		want    []bool
+	}{
+		{
+			name:    "should restrict attempts within window by key",
+			elapsed: 0,
+			args:    args{keys: []string{"1", "1", "2", "1"}},
+			want:    []bool{true, true, true, false},
+		},
+		{
+			name:    "should reset attempts in new window",
+			elapsed: time.Minute,
+			args:    args{keys: []string{"1", "1", "1", "1"}},
+			want:    []bool{true, true, true, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+
+			limiter := NewLimiter(2, time.Minute)
+			limiter.now = func() time.Time {
+				now = now.Add(tt.elapsed / 2)
+				return now
+			}
+
+			for i, key := range tt.args.keys {
+				if got := limiter.Allow(key); got != tt.want[i] {
+					t.Errorf("Allow() attempt %d got = %v, want %v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+// Package oidc implements relying party of OpenID Connect: discovery, authorization code flow with PKCE
+// and ID token verification by keys of the provider.
+package oidc
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// discoveryPath is path of provider metadata relative to the issuer.
+const discoveryPath = "/.well-known/openid-configuration"
+
+// defaultTimeout limits every request to the provider.
+const defaultTimeout = 10 * time.Second
+
+// maxResponseSize limits responses of the provider.
+const maxResponseSize = 1 << 20
+
+// ErrDiscovery is returned when provider metadata cannot be loaded or is not valid.
+var ErrDiscovery = errors.New("provider discovery failed")
+
+// ErrExchange is returned when the provider does not give tokens for authorization code.
+var ErrExchange = errors.New("authorization code exchange failed")
+
+// Config is settings of the relying party.
+type Config struct {
+	// IssuerURL is identifier of the provider, its metadata is discovered by the URL.
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is where the provider sends users with authorization code.
+	RedirectURL string
+	// Scopes are requested in addition to "openid".
+	Scopes []string
+}
+
+// Provider is metadata of the provider.
+type Provider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Client is relying party of one provider, metadata and keys of the provider are loaded on first use.
+type Client struct {
+	config     Config
+	httpClient *http.Client
+	NowFunc    func() time.Time
+
+	mu       sync.Mutex
+	provider *Provider
+
+	keysMu sync.Mutex
+	keys   map[string]*rsa.PublicKey
+}
+
+// tokenResponse is response of token endpoint.
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	TokenType        string `json:"token_type"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// NewClient creates new Client, nil httpClient means client with default timeout.
+func NewClient(config Config, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: defaultTimeout}
+	}
+
+	config.IssuerURL = strings.TrimRight(config.IssuerURL, "/")
+
+	return &Client{config: config, httpClient: httpClient, NowFunc: time.Now}
+}
+
+// Issuer returns identifier of the provider.
+func (client *Client) Issuer() string {
+	return client.config.IssuerURL
+}
+
+// Provider returns metadata of the provider, it is discovered once.
+func (client *Client) Provider(ctx context.Context) (*Provider, error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if client.provider != nil {
+		return client.provider, nil
+	}
+
+	var provider Provider
+	if err := client.getJSON(ctx, client.config.IssuerURL+discoveryPath, &provider); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+
+	// the issuer in metadata must be exactly the configured one, otherwise tokens of other issuers could be accepted
+	if provider.Issuer != client.config.IssuerURL {
+		return nil, fmt.Errorf("%w: issuer %s does not match %s", ErrDiscovery, provider.Issuer, client.config.IssuerURL)
+	}
+
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: endpoints are missing", ErrDiscovery)
+	}
+
+	client.provider = &provider
+	return client.provider, nil
+}
+
+// AuthCodeURL returns URL of the provider where the user is sent to log in. State and nonce are checked
+// when the user returns, challenge is made of PKCE verifier by Challenge.
+func (client *Client) AuthCodeURL(ctx context.Context, state string, nonce string, challenge string) (string, error) {
+	provider, err := client.Provider(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", client.config.ClientID)
+	query.Set("redirect_uri", client.config.RedirectURL)
+	query.Set("scope", strings.Join(append([]string{"openid"}, client.config.Scopes...), " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", challenge)
+	query.Set("code_challenge_method", challengeMethod)
+
+	separator := "?"
+	if strings.Contains(provider.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return provider.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange gives authorization code with PKCE verifier to the provider and returns verified claims
+// of the ID token. The nonce must be the one passed to AuthCodeURL.
+func (client *Client) Exchange(ctx context.Context, code string, verifier string, nonce string) (*Claims, error) {
+	provider, err := client.Provider(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", client.config.RedirectURL)
+	form.Set("code_verifier", verifier)
+
+	request, err := http.NewRequestWithContext(
+		ctx, http.MethodPost, provider.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+	request.SetBasicAuth(url.QueryEscape(client.config.ClientID), url.QueryEscape(client.config.ClientSecret))
+
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+
+	defer response.Body.Close()
+
+	var tokens tokenResponse
+	if err := json.NewDecoder(io.LimitReader(response.Body, maxResponseSize)).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s %s", ErrExchange, tokens.Error, tokens.ErrorDescription)
+	}
+
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: no ID token", ErrExchange)
+	}
+
+	return client.Verify(ctx, tokens.IDToken, nonce)
+}
+
+// getJSON loads JSON document from the provider.
+func (client *Client) getJSON(ctx context.Context, url string, v interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Accept", "application/json")
+
+	response, err := client.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d of %s", response.StatusCode, url)
+	}
+
+	return json.NewDecoder(io.LimitReader(response.Body, maxResponseSize)).Decode(v)
+}
+
+// now returns current time.
+func (client *Client) now() time.Time {
+	if client.NowFunc == nil {
+		return time.Now()
+	}
+
+	return client.NowFunc()
+}
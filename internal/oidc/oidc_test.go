@@ -0,0 +1,228 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"github.com/magmel48/go-web/internal/oidc/oidctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID     = "go-web"
+	testClientSecret = "client secret"
+	testRedirectURL  = "http://localhost:8080/api/auth/oidc/callback"
+)
+
+// authorize follows AuthCodeURL to the fake provider and returns authorization code and state it redirects with.
+func authorize(t *testing.T, authCodeURL string) url.Values {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+
+	response, err := client.Get(authCodeURL)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	require.Equal(t, http.StatusFound, response.StatusCode)
+
+	location, err := url.Parse(response.Header.Get("Location"))
+	require.NoError(t, err)
+
+	return location.Query()
+}
+
+func TestClient_Exchange(t *testing.T) {
+	provider, server, err := oidctest.NewServer(testClientID, testClientSecret)
+	require.NoError(t, err)
+	defer server.Close()
+
+	provider.Subject = "alice"
+
+	tests := []struct {
+		name         string
+		clientSecret string
+		wrongVerify  bool
+		wrongNonce   bool
+		wantErr      error
+	}{
+		{name: "should log user in", clientSecret: testClientSecret},
+		{name: "should reject wrong client secret", clientSecret: "wrong", wantErr: ErrExchange},
+		{name: "should reject wrong code verifier", clientSecret: testClientSecret, wrongVerify: true, wantErr: ErrExchange},
+		{name: "should reject wrong nonce", clientSecret: testClientSecret, wrongNonce: true, wantErr: ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := NewClient(Config{
+				IssuerURL:    server.URL,
+				ClientID:     testClientID,
+				ClientSecret: tt.clientSecret,
+				RedirectURL:  testRedirectURL,
+			}, nil)
+
+			state, _ := RandomString()
+			nonce, _ := RandomString()
+			verifier, _ := RandomString()
+
+			authCodeURL, err := client.AuthCodeURL(context.TODO(), state, nonce, Challenge(verifier))
+			require.NoError(t, err)
+
+			query := authorize(t, authCodeURL)
+			assert.Equal(t, state, query.Get("state"))
+
+			if tt.wrongVerify {
+				verifier, _ = RandomString()
+			}
+
+			if tt.wrongNonce {
+				nonce, _ = RandomString()
+			}
+
+			claims, err := client.Exchange(context.TODO(), query.Get("code"), verifier, nonce)
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr != nil {
+				return
+			}
+
+			assert.Equal(t, "alice", claims.Subject)
+			assert.Equal(t, server.URL, claims.Issuer)
+		})
+	}
+}
+
+func TestClient_Exchange_codeReuse(t *testing.T) {
+	_, server, err := oidctest.NewServer(testClientID, testClientSecret)
+	require.NoError(t, err)
+	defer server.Close()
+
+	client := NewClient(Config{
+		IssuerURL:    server.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	}, nil)
+
+	verifier, _ := RandomString()
+	authCodeURL, err := client.AuthCodeURL(context.TODO(), "state", "nonce", Challenge(verifier))
+	require.NoError(t, err)
+
+	code := authorize(t, authCodeURL).Get("code")
+
+	_, err = client.Exchange(context.TODO(), code, verifier, "nonce")
+	assert.NoError(t, err)
+
+	_, err = client.Exchange(context.TODO(), code, verifier, "nonce")
+	assert.ErrorIs(t, err, ErrExchange)
+}
+
+func TestClient_Verify(t *testing.T) {
+	provider, server, err := oidctest.NewServer(testClientID, testClientSecret)
+	require.NoError(t, err)
+	defer server.Close()
+
+	other, err := oidctest.NewProvider(server.URL, testClientID, testClientSecret)
+	require.NoError(t, err)
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	provider.NowFunc = func() time.Time { return now }
+	other.NowFunc = provider.NowFunc
+
+	valid := func() map[string]interface{} {
+		return provider.Claims("alice", "nonce")
+	}
+
+	tests := []struct {
+		name    string
+		sign    *oidctest.Provider
+		change  func(claims map[string]interface{})
+		wantErr error
+	}{
+		{name: "should accept valid token", sign: provider, change: func(map[string]interface{}) {}},
+		{
+			name: "should accept audience list with authorized party",
+			sign: provider,
+			change: func(claims map[string]interface{}) {
+				claims["aud"] = []string{"other", testClientID}
+				claims["azp"] = testClientID
+			},
+		},
+		{name: "should reject token of other key", sign: other, change: func(map[string]interface{}) {}, wantErr: ErrInvalidToken},
+		{
+			name:    "should reject other issuer",
+			sign:    provider,
+			change:  func(claims map[string]interface{}) { claims["iss"] = "https://evil.example.com" },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "should reject other audience",
+			sign:    provider,
+			change:  func(claims map[string]interface{}) { claims["aud"] = "other" },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name: "should reject audience list without authorized party",
+			sign: provider,
+			change: func(claims map[string]interface{}) {
+				claims["aud"] = []string{"other", testClientID}
+			},
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "should reject expired token",
+			sign:    provider,
+			change:  func(claims map[string]interface{}) { claims["exp"] = now.Add(-2 * time.Minute).Unix() },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "should reject token without subject",
+			sign:    provider,
+			change:  func(claims map[string]interface{}) { delete(claims, "sub") },
+			wantErr: ErrInvalidToken,
+		},
+		{
+			name:    "should reject wrong nonce",
+			sign:    provider,
+			change:  func(claims map[string]interface{}) { claims["nonce"] = "other" },
+			wantErr: ErrInvalidToken,
+		},
+	}
+
+	client := NewClient(Config{IssuerURL: server.URL, ClientID: testClientID}, nil)
+	client.NowFunc = provider.NowFunc
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := valid()
+			tt.change(claims)
+
+			token, err := tt.sign.Token(claims)
+			require.NoError(t, err)
+
+			got, err := client.Verify(context.TODO(), token, "nonce")
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.wantErr == nil {
+				assert.Equal(t, "alice", got.Subject)
+			}
+		})
+	}
+}
+
+func TestClient_Provider(t *testing.T) {
+	_, server, err := oidctest.NewServer(testClientID, testClientSecret)
+	require.NoError(t, err)
+	defer server.Close()
+
+	client := NewClient(Config{IssuerURL: server.URL + "/other"}, nil)
+	_, err = client.Provider(context.TODO())
+	assert.True(t, errors.Is(err, ErrDiscovery))
+
+	client = NewClient(Config{IssuerURL: server.URL + "/"}, nil)
+	provider, err := client.Provider(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL+oidctest.TokenPath, provider.TokenEndpoint)
+}
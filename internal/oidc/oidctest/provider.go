@@ -0,0 +1,290 @@
+// Package oidctest provides fake OpenID Connect provider, so the login flow is tested without network access.
+// The provider logs every user in as Subject without asking anything.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Paths of provider endpoints.
+const (
+	DiscoveryPath     = "/.well-known/openid-configuration"
+	AuthorizationPath = "/authorize"
+	TokenPath         = "/token"
+	JWKSPath          = "/jwks"
+)
+
+// keyID identifies the signing key of the provider.
+const keyID = "test-key"
+
+// tokenTTL is lifetime of ID tokens.
+const tokenTTL = 5 * time.Minute
+
+// authorization is issued authorization code with parameters it is bound to.
+type authorization struct {
+	clientID    string
+	redirectURI string
+	nonce       string
+	challenge   string
+	subject     string
+}
+
+// Provider is fake OpenID Connect provider, it is http.Handler.
+type Provider struct {
+	// Issuer is URL of the provider, NewServer sets it to URL of the server.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// Subject is the user that is logged in by the provider.
+	Subject string
+	// Email is put to ID tokens if it is not empty.
+	Email   string
+	NowFunc func() time.Time
+
+	key   *rsa.PrivateKey
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+// NewProvider creates new Provider with new signing key.
+func NewProvider(issuer string, clientID string, clientSecret string) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Provider{
+		Issuer:       issuer,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Subject:      "test-subject",
+		NowFunc:      time.Now,
+		key:          key,
+		codes:        make(map[string]authorization),
+	}, nil
+}
+
+// NewServer starts the provider on a local port, the server must be closed by the caller.
+func NewServer(clientID string, clientSecret string) (*Provider, *httptest.Server, error) {
+	provider, err := NewProvider("", clientID, clientSecret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	server := httptest.NewServer(provider)
+	provider.Issuer = server.URL
+
+	return provider, server, nil
+}
+
+// ServeHTTP handles requests to the provider.
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case DiscoveryPath:
+		p.handleDiscovery(w)
+	case AuthorizationPath:
+		p.handleAuthorization(w, r)
+	case TokenPath:
+		p.handleToken(w, r)
+	case JWKSPath:
+		p.handleJWKS(w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Token signs ID token with the claims, it is for tests of tokens the provider would not issue.
+func (p *Provider) Token(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": keyID, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// Claims returns claims of ID token the provider issues for the nonce.
+func (p *Provider) Claims(subject string, nonce string) map[string]interface{} {
+	now := p.NowFunc()
+	claims := map[string]interface{}{
+		"iss":   p.Issuer,
+		"sub":   subject,
+		"aud":   p.ClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(tokenTTL).Unix(),
+		"nonce": nonce,
+	}
+
+	if p.Email != "" {
+		claims["email"] = p.Email
+	}
+
+	return claims
+}
+
+// handleDiscovery responds with provider metadata.
+func (p *Provider) handleDiscovery(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.Issuer,
+		"authorization_endpoint":                p.Issuer + AuthorizationPath,
+		"token_endpoint":                        p.Issuer + TokenPath,
+		"jwks_uri":                              p.Issuer + JWKSPath,
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+// handleAuthorization logs the user in as Subject and redirects back with authorization code.
+func (p *Provider) handleAuthorization(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI := query.Get("redirect_uri")
+	if query.Get("client_id") != p.ClientID || redirectURI == "" {
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	}
+
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "wrong redirect uri", http.StatusBadRequest)
+		return
+	}
+
+	values := target.Query()
+	values.Set("state", query.Get("state"))
+
+	switch {
+	case query.Get("response_type") != "code":
+		values.Set("error", "unsupported_response_type")
+	case query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256":
+		values.Set("error", "invalid_request")
+	default:
+		code := randomString()
+
+		p.mu.Lock()
+		p.codes[code] = authorization{
+			clientID:    p.ClientID,
+			redirectURI: redirectURI,
+			nonce:       query.Get("nonce"),
+			challenge:   query.Get("code_challenge"),
+			subject:     p.Subject,
+		}
+		p.mu.Unlock()
+
+		values.Set("code", code)
+	}
+
+	target.RawQuery = values.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// handleToken exchanges authorization code for ID token, the code can be used once.
+func (p *Provider) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+
+	if clientID != p.ClientID || clientSecret != p.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.PostFormValue("code")
+
+	p.mu.Lock()
+	auth, ok := p.codes[code]
+	delete(p.codes, code)
+	p.mu.Unlock()
+
+	verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+
+	switch {
+	case r.PostFormValue("grant_type") != "authorization_code":
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	case !ok || auth.clientID != clientID || auth.redirectURI != r.PostFormValue("redirect_uri"):
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	case base64.RawURLEncoding.EncodeToString(verifier[:]) != auth.challenge:
+		writeJSON(w, http.StatusBadRequest, map[string]string{
+			"error": "invalid_grant", "error_description": "wrong code verifier"})
+		return
+	}
+
+	idToken, err := p.Token(p.Claims(auth.subject, auth.nonce))
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   int(tokenTTL.Seconds()),
+		"id_token":     idToken,
+	})
+}
+
+// handleJWKS responds with the public signing key.
+func (p *Provider) handleJWKS(w http.ResponseWriter) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+// writeJSON writes JSON response.
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// randomString returns random code.
+func randomString() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,29 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// challengeMethod is the only PKCE method that is used, "plain" gives no protection if the request is seen.
+const challengeMethod = "S256"
+
+// randomSize is how many random bytes are in states, nonces and verifiers, it gives 43 characters.
+const randomSize = 32
+
+// RandomString returns URL-safe random string for state, nonce or PKCE verifier.
+func RandomString() (string, error) {
+	b := make([]byte, randomSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge returns PKCE challenge of the verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
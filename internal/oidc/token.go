@@ -0,0 +1,250 @@
+package oidc
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// signingAlgorithm is the only accepted algorithm of ID tokens, it is required by OpenID Connect.
+const signingAlgorithm = "RS256"
+
+// clockSkew is how much clocks of the provider and the service can differ.
+const clockSkew = time.Minute
+
+// ErrInvalidToken is returned when ID token is malformed, not signed by the provider or not issued for the client.
+var ErrInvalidToken = errors.New("invalid ID token")
+
+// Claims are verified claims of ID token.
+type Claims struct {
+	Issuer          string   `json:"iss"`
+	Subject         string   `json:"sub"`
+	Audience        audience `json:"aud"`
+	AuthorizedParty string   `json:"azp,omitempty"`
+	ExpiresAt       int64    `json:"exp"`
+	IssuedAt        int64    `json:"iat"`
+	Nonce           string   `json:"nonce,omitempty"`
+	Email           string   `json:"email,omitempty"`
+}
+
+// audience is "aud" claim, it is a string or an array of strings.
+type audience []string
+
+// UnmarshalJSON reads both forms of audience.
+func (a *audience) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var single string
+		if err := json.Unmarshal(data, &single); err != nil {
+			return err
+		}
+
+		*a = audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+
+	*a = list
+	return nil
+}
+
+// contains says if the audience has the client.
+func (a audience) contains(clientID string) bool {
+	for _, item := range a {
+		if item == clientID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// header is JOSE header of ID token.
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// jwk is public key of the provider in JSON Web Key format.
+type jwk struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	N         string `json:"n"`
+	E         string `json:"e"`
+}
+
+// jwks is JSON Web Key Set.
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// Verify checks signature and claims of ID token and returns the claims. Keys of the provider are loaded again
+// when the token is signed by unknown key, so keys can be rotated by the provider.
+func (client *Client) Verify(ctx context.Context, rawToken string, nonce string) (*Claims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if h.Algorithm != signingAlgorithm {
+		return nil, fmt.Errorf("%w: unsupported algorithm %s", ErrInvalidToken, h.Algorithm)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	key, err := client.key(ctx, h.KeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("%w: wrong signature", ErrInvalidToken)
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	if err := client.checkClaims(&claims, nonce); err != nil {
+		return nil, err
+	}
+
+	return &claims, nil
+}
+
+// checkClaims checks that the token is issued by the provider for the client and the current login.
+func (client *Client) checkClaims(claims *Claims, nonce string) error {
+	now := client.now()
+
+	switch {
+	case claims.Issuer != client.config.IssuerURL:
+		return fmt.Errorf("%w: wrong issuer %s", ErrInvalidToken, claims.Issuer)
+	case claims.Subject == "":
+		return fmt.Errorf("%w: no subject", ErrInvalidToken)
+	case !claims.Audience.contains(client.config.ClientID):
+		return fmt.Errorf("%w: wrong audience", ErrInvalidToken)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != client.config.ClientID:
+		return fmt.Errorf("%w: wrong authorized party", ErrInvalidToken)
+	case claims.ExpiresAt == 0 || now.Add(-clockSkew).Unix() >= claims.ExpiresAt:
+		return fmt.Errorf("%w: expired", ErrInvalidToken)
+	case claims.IssuedAt > now.Add(clockSkew).Unix():
+		return fmt.Errorf("%w: issued in the future", ErrInvalidToken)
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return fmt.Errorf("%w: wrong nonce", ErrInvalidToken)
+	}
+
+	return nil
+}
+
+// key returns key of the provider by identifier, keys are loaded if there is no such key yet.
+func (client *Client) key(ctx context.Context, keyID string) (*rsa.PublicKey, error) {
+	client.keysMu.Lock()
+	defer client.keysMu.Unlock()
+
+	if key, ok := client.findKey(keyID); ok {
+		return key, nil
+	}
+
+	provider, err := client.Provider(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var set jwks
+	if err := client.getJSON(ctx, provider.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("%w: keys: %v", ErrDiscovery, err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, item := range set.Keys {
+		if item.KeyType != "RSA" || (item.Use != "" && item.Use != "sig") {
+			continue
+		}
+
+		if item.Algorithm != "" && item.Algorithm != signingAlgorithm {
+			continue
+		}
+
+		key, err := parseRSAKey(item)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %s: %v", ErrDiscovery, item.KeyID, err)
+		}
+
+		keys[item.KeyID] = key
+	}
+
+	client.keys = keys
+
+	if key, ok := client.findKey(keyID); ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("%w: unknown key %s", ErrInvalidToken, keyID)
+}
+
+// findKey finds loaded key, tokens without key identifier are accepted if the provider has one key only.
+func (client *Client) findKey(keyID string) (*rsa.PublicKey, bool) {
+	if keyID == "" && len(client.keys) == 1 {
+		for _, key := range client.keys {
+			return key, true
+		}
+	}
+
+	key, ok := client.keys[keyID]
+	return key, ok
+}
+
+// parseRSAKey makes RSA public key of JSON Web Key.
+func parseRSAKey(item jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(item.N)
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(item.E)
+	if err != nil {
+		return nil, err
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("wrong key parameters")
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+// decodeSegment decodes base64 JSON part of the token.
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
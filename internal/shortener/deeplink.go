@@ -0,0 +1,63 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"github.com/magmel48/go-web/internal/db/links"
+	"net/url"
+	"strings"
+)
+
+// ErrWrongDeepLink is using for notifying clients about deep link that cannot be used.
+var ErrWrongDeepLink = errors.New("wrong deep link")
+
+// unsafeAppSchemes cannot be used as app schemes because browsers execute them as scripts.
+var unsafeAppSchemes = map[string]bool{"javascript": true, "vbscript": true, "data": true, "file": true}
+
+// validateDeepLink checks deep link can be used for a link.
+func validateDeepLink(deepLink *links.DeepLink) error {
+	if deepLink == nil {
+		return nil
+	}
+
+	appURL, err := url.Parse(deepLink.AppURL)
+	if err != nil || appURL.Scheme == "" {
+		return fmt.Errorf("%w: cannot parse app url", ErrWrongDeepLink)
+	}
+
+	if unsafeAppSchemes[strings.ToLower(appURL.Scheme)] {
+		return fmt.Errorf("%w: scheme %q is not allowed for app url", ErrWrongDeepLink, appURL.Scheme)
+	}
+
+	for _, storeURL := range []string{deepLink.IOSStoreURL, deepLink.AndroidStoreURL} {
+		if storeURL == "" {
+			continue
+		}
+
+		parsed, err := url.ParseRequestURI(storeURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			return fmt.Errorf("%w: store url should be a web url", ErrWrongDeepLink)
+		}
+	}
+
+	return nil
+}
+
+// applyDeepLink makes the redirect open the app on mobile devices. Desktop clients are redirected as usual.
+// If the app is not installed, the client falls back to the app store for its OS or to the web URL.
+func applyDeepLink(redirect *Redirect, deepLink *links.DeepLink, userAgent string) {
+	var storeURL string
+	switch detectOS(userAgent) {
+	case "ios":
+		storeURL = deepLink.IOSStoreURL
+	case "android":
+		storeURL = deepLink.AndroidStoreURL
+	default:
+		return
+	}
+
+	redirect.AppURL = deepLink.AppURL
+	if storeURL != "" {
+		redirect.URL = storeURL
+	}
+}
@@ -0,0 +1,81 @@
+package shortener
+
+import (
+	"github.com/magmel48/go-web/internal/db/links"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_validateDeepLink(t *testing.T) {
+	tests := []struct {
+		name     string
+		deepLink *links.DeepLink
+		wantErr  error
+	}{
+		{
+			name:     "should allow link without deep link",
+			deepLink: nil,
+			wantErr:  nil,
+		},
+		{
+			name:     "should allow app scheme",
+			deepLink: &links.DeepLink{AppURL: "myapp://product/42", IOSStoreURL: "https://apps.apple.com/app/id1"},
+			wantErr:  nil,
+		},
+		{
+			name:     "should reject app url without scheme",
+			deepLink: &links.DeepLink{AppURL: "product/42"},
+			wantErr:  ErrWrongDeepLink,
+		},
+		{
+			name:     "should reject script scheme",
+			deepLink: &links.DeepLink{AppURL: "JavaScript:alert(1)"},
+			wantErr:  ErrWrongDeepLink,
+		},
+		{
+			name:     "should reject store url that is not a web url",
+			deepLink: &links.DeepLink{AppURL: "myapp://home", AndroidStoreURL: "market://details?id=app"},
+			wantErr:  ErrWrongDeepLink,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.ErrorIs(t, validateDeepLink(tt.deepLink), tt.wantErr)
+		})
+	}
+}
+
+func Test_applyDeepLink(t *testing.T) {
+	deepLink := &links.DeepLink{AppURL: "myapp://home", IOSStoreURL: "https://apps.apple.com/app/id1"}
+
+	tests := []struct {
+		name      string
+		userAgent string
+		want      Redirect
+	}{
+		{
+			name:      "should fall back to app store on ios",
+			userAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 15_0 like Mac OS X)",
+			want:      Redirect{URL: "https://apps.apple.com/app/id1", AppURL: "myapp://home"},
+		},
+		{
+			name:      "should fall back to web url without store url",
+			userAgent: "Mozilla/5.0 (Linux; Android 12; Pixel 6)",
+			want:      Redirect{URL: "https://example.com", AppURL: "myapp://home"},
+		},
+		{
+			name:      "should redirect desktop as usual",
+			userAgent: "Mozilla/5.0 (X11; Linux x86_64)",
+			want:      Redirect{URL: "https://example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			redirect := Redirect{URL: "https://example.com"}
+			applyDeepLink(&redirect, deepLink, tt.userAgent)
+			assert.Equal(t, tt.want, redirect)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package shortener
+
+import (
+	"context"
+	"github.com/magmel48/go-web/internal/canonical"
+	"github.com/magmel48/go-web/internal/db/links"
+	"log"
+)
+
+// MergeDuplicateLinks brings original URLs of plain links to canonical form and merges links that became equal. The link already having canonical URL (or the oldest one) is kept, others become its aliases.
+// Deleted links and links with options are skipped, otherwise their short identifiers would lead
+// to the kept link without password, clicks limit or schedule. It returns number of merged links.
+func (s Shortener) MergeDuplicateLinks(ctx context.Context) (int, error) {
+	all, err := s.linksRepository.ListURLs(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	groups := make(map[string][]links.Link)
+	order := make([]string, 0)
+	for _, link := range all {
+		if link.IsDeleted || !link.Plain {
+			continue
+		}
+
+		canonicalURL, err := canonical.Canonicalize(link.OriginalURL, s.canonicalOptions)
+		if err != nil {
+			log.Println("cannot canonicalize url of link", link.ShortID, err)
+			continue
+		}
+
+		if _, ok := groups[canonicalURL]; !ok {
+			order = append(order, canonicalURL)
+		}
+
+		groups[canonicalURL] = append(groups[canonicalURL], link)
+	}
+
+	merged := 0
+	for _, canonicalURL := range order {
+		group := groups[canonicalURL]
+
+		kept := 0
+		for i, link := range group {
+			if link.OriginalURL == canonicalURL {
+				kept = i
+				break
+			}
+		}
+
+		duplicateIDs := make([]int, 0, len(group)-1)
+		for i, link := range group {
+			if i != kept {
+				duplicateIDs = append(duplicateIDs, link.ID)
+			}
+		}
+
+		if len(duplicateIDs) == 0 && group[kept].OriginalURL == canonicalURL {
+			continue
+		}
+
+		if err := s.linksRepository.Merge(ctx, group[kept].ID, canonicalURL, duplicateIDs); err != nil {
+			return merged, err
+		}
+
+		merged += len(duplicateIDs)
+	}
+
+	return merged, nil
+}
@@ -0,0 +1,52 @@
+package shortener
+
+import (
+	"context"
+	"github.com/magmel48/go-web/internal/db/links"
+	linkmocks "github.com/magmel48/go-web/internal/db/links/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+)
+
+func TestShortener_MergeDuplicateLinks(t *testing.T) {
+	linksRepository := linkmocks.Repository{}
+	linksRepository.On("ListURLs", mock.Anything).Return([]links.Link{
+		{ID: 1, ShortID: "1", OriginalURL: "HTTPS://Example.com", Plain: true},
+		{ID: 2, ShortID: "2", OriginalURL: "https://example.com/", Plain: true},
+		{ID: 3, ShortID: "3", OriginalURL: "https://example.com:443/", Plain: true},
+		{ID: 4, ShortID: "4", OriginalURL: "https://other.com/", Plain: true},
+		{ID: 5, ShortID: "5", OriginalURL: "https://Third.com", Plain: true},
+	}, nil)
+	linksRepository.On("Merge", mock.Anything, 2, "https://example.com/", []int{1, 3}).Return(nil).Once()
+	linksRepository.On("Merge", mock.Anything, 5, "https://third.com/", []int{}).Return(nil).Once()
+
+	s := Shortener{linksRepository: &linksRepository}
+
+	merged, err := s.MergeDuplicateLinks(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, merged)
+	linksRepository.AssertExpectations(t)
+}
+
+func TestShortener_MergeDuplicateLinks_skipped(t *testing.T) {
+	linksRepository := linkmocks.Repository{}
+	linksRepository.On("ListURLs", mock.Anything).Return([]links.Link{
+		{ID: 1, ShortID: "1", OriginalURL: "https://example.com/", OwnerID: "alice", Plain: true},
+		// protected by password, limited by clicks or scheduled
+		{ID: 2, ShortID: "2", OriginalURL: "HTTPS://example.com", OwnerID: "alice"},
+		// deleted by the owner or used up
+		{ID: 3, ShortID: "3", OriginalURL: "https://example.com:443/", OwnerID: "alice", Plain: true, IsDeleted: true},
+		// made shorter by another user before deduplication by canonical URL
+		{ID: 4, ShortID: "4", OriginalURL: "https://Example.com", OwnerID: "bob", Plain: true},
+	}, nil)
+	linksRepository.On("Merge", mock.Anything, 1, "https://example.com/", []int{4}).Return(nil).Once()
+
+	s := Shortener{linksRepository: &linksRepository}
+
+	merged, err := s.MergeDuplicateLinks(context.TODO())
+	assert.NoError(t, err)
+	assert.Equal(t, 1, merged)
+	linksRepository.AssertExpectations(t)
+	linksRepository.AssertNumberOfCalls(t, "Merge", 1)
+}
@@ -0,0 +1,45 @@
+package shortener
+
+import (
+	"errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// maxPasswordLength is limited by bcrypt which ignores everything after the 72nd byte.
+const maxPasswordLength = 72
+
+// ErrPasswordRequired is using for notifying clients that the link is protected and password should be provided.
+var ErrPasswordRequired = errors.New("password is required")
+
+// ErrWrongPassword is using for notifying clients that provided password does not match the link one.
+var ErrWrongPassword = errors.New("wrong password")
+
+// ErrPasswordTooLong is using for notifying clients that the password cannot be used for protecting a link.
+var ErrPasswordTooLong = errors.New("password is too long")
+
+// HashPassword makes a hash of a link password suitable for storing in links.Options.
+func HashPassword(password string) (string, error) {
+	if len(password) > maxPasswordLength {
+		return "", ErrPasswordTooLong
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// checkPassword checks if provided password matches the hash stored for the link.
+func checkPassword(hash string, password string) error {
+	if password == "" {
+		return ErrPasswordRequired
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return ErrWrongPassword
+	}
+
+	return nil
+}
@@ -0,0 +1,295 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/magmel48/go-web/internal/config"
+	"github.com/magmel48/go-web/internal/db/links"
+	"github.com/magmel48/go-web/internal/validation"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// RedirectRequest is what is known about a request to a short link.
+type RedirectRequest struct {
+	ShortID string
+	// Path is the rest of request path after short identifier, it is used by prefix links only.
+	Path string
+	// Query is raw query string of the request.
+	Query string
+	// Password is provided by the client for protected links.
+	Password string
+	// UserAgent, AcceptLanguage and Country describe the client for matching redirect rules.
+	UserAgent      string
+	AcceptLanguage string
+	Country        string
+	// Variant is name of split destination pinned for the visitor before.
+	Variant string
+}
+
+// Redirect describes how a client should be redirected from a short link.
+type Redirect struct {
+	URL        string
+	StatusCode int
+	// Cacheable is true if the same request to the short link always leads to the same URL.
+	Cacheable bool
+	// Branch is name of the rule that was matched, empty if the link has no rules.
+	Branch string
+	// Variant is name of picked split destination, empty if the link is not split.
+	Variant string
+	// StickyVariant is true if Variant should be pinned for the visitor.
+	StickyVariant bool
+	// AppURL is a deep link the client should try before going to URL, empty means a plain redirect.
+	AppURL string
+	// Untrusted is true if the client should confirm going to URL after a warning.
+	Untrusted bool
+}
+
+// Resolve finds where a short link leads and which redirect status code should be used for that.
+func (s Shortener) Resolve(ctx context.Context, request RedirectRequest) (*Redirect, error) {
+	link, err := s.findLink(ctx, request.ShortID)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Path != "" && !link.IsPrefix {
+		return nil, ErrNotFound
+	}
+
+	if err := checkSchedule(link, time.Now()); err != nil {
+		if errors.Is(err, ErrNotActiveYet) && link.PlaceholderURL != "" {
+			if err := s.checkRedirectDestination(link.PlaceholderURL); err != nil {
+				return nil, err
+			}
+
+			return &Redirect{
+				URL:        link.PlaceholderURL,
+				StatusCode: http.StatusFound,
+				Untrusted:  !s.isTrusted(ctx, link, link.PlaceholderURL),
+			}, nil
+		}
+
+		return nil, err
+	}
+
+	if link.PasswordHash != "" {
+		if err := checkPassword(link.PasswordHash, request.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	redirect := Redirect{
+		URL:        link.OriginalURL,
+		StatusCode: redirectStatusCode(link),
+		Cacheable:  isStatic(link),
+	}
+
+	var rule *links.Rule
+	if len(link.Rules) > 0 {
+		redirect.Branch = defaultBranch
+		if rule = matchRule(link.Rules, request); rule != nil {
+			redirect.URL = rule.URL
+			redirect.Branch = rule.Name
+		}
+	}
+
+	if rule == nil && link.Split != nil && len(link.Split.Destinations) > 0 {
+		destination, err := s.pickDestination(ctx, link, request.Variant)
+		if err != nil {
+			return nil, err
+		}
+
+		redirect.URL = destination.URL
+		redirect.Variant = destination.Name
+		redirect.StickyVariant = link.Split.Sticky
+	}
+
+	redirect.URL = destinationURL(redirect.URL, link, request)
+
+	if link.DeepLink != nil {
+		applyDeepLink(&redirect, link.DeepLink, request.UserAgent)
+	}
+
+	// blocked redirects must not use clicks up or be counted
+	if err := s.checkRedirectDestination(redirect.URL); err != nil {
+		return nil, err
+	}
+
+	if link.MaxClicks > 0 {
+		ok, err := s.linksRepository.UseClick(ctx, link.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		// clicks were used by concurrent requests after the link was found
+		if !ok {
+			return nil, ErrDeleted
+		}
+	}
+
+	// statistics must not break redirects
+	if redirect.Branch != "" {
+		if err := s.linksRepository.RegisterBranch(ctx, link.ID, redirect.Branch); err != nil {
+			log.Println("cannot register redirect branch", err)
+		}
+	}
+
+	if redirect.Variant != "" {
+		if err := s.linksRepository.RegisterVariant(ctx, link.ID, redirect.Variant); err != nil {
+			log.Println("cannot register split variant", err)
+		}
+	}
+
+	redirect.Untrusted = !s.isTrusted(ctx, link, redirect.URL)
+
+	return &redirect, nil
+}
+
+// checkRedirectDestination checks the destination is not blocked, so links created before blocking
+// their domain stop working too.
+func (s Shortener) checkRedirectDestination(destination string) error {
+	if len(s.redirectValidator) == 0 {
+		return nil
+	}
+
+	// internationalized hosts are checked in punycode as on link creation
+	err := s.redirectValidator.ValidateURL(destination)
+
+	// destinations were validated on link creation, so broken ones are left as is
+	var validationErr *validation.Error
+	if errors.As(err, &validationErr) && validationErr.Code == validation.CodeMalformedURL {
+		return nil
+	}
+
+	if err != nil {
+		log.Println("redirect is blocked", destination, err)
+		return fmt.Errorf("%w: %v", ErrBlocked, err)
+	}
+
+	return nil
+}
+
+// isStatic checks if the link leads to the same place every time, so the redirect can be cached by clients.
+func isStatic(link *links.Link) bool {
+	return link.MaxClicks == 0 && len(link.Rules) == 0 && link.Split == nil &&
+		link.ActiveFrom == nil && link.ActiveUntil == nil && link.DeepLink == nil
+}
+
+// destinationURL builds final URL from target one applying path forwarding, UTM parameters and query forwarding
+// of the link. Fixed UTM parameters override ones from the target URL, forwarded parameters override both of them.
+// Prefix links always forward the query. The target query is kept as is except overridden pairs, so its order
+// and escaping are not changed.
+func destinationURL(target string, link *links.Link, request RedirectRequest) string {
+	forward := (link.ForwardQuery || link.IsPrefix) && request.Query != ""
+	forwardPath := link.IsPrefix && request.Path != ""
+	if !forward && !forwardPath && len(link.UTMParams) == 0 {
+		return target
+	}
+
+	destination, err := url.Parse(target)
+	if err != nil {
+		log.Println("cannot parse destination url", err)
+		return target
+	}
+
+	if forwardPath {
+		joinPath(destination, request.Path)
+	}
+
+	overridden := make(map[string]bool)
+	forwarded := make([]string, 0)
+	if forward {
+		// malformed pairs are skipped, the rest is still forwarded
+		for _, pair := range strings.Split(request.Query, "&") {
+			if key, ok := queryKey(pair); ok {
+				forwarded = append(forwarded, pair)
+				overridden[key] = true
+			}
+		}
+	}
+
+	utm := url.Values{}
+	for key, values := range link.UTMParams {
+		if !overridden[key] {
+			utm[key] = values
+		}
+	}
+
+	for key := range link.UTMParams {
+		overridden[key] = true
+	}
+
+	pairs := make([]string, 0)
+	if destination.RawQuery != "" {
+		for _, pair := range strings.Split(destination.RawQuery, "&") {
+			if key, ok := queryKey(pair); !ok || !overridden[key] {
+				pairs = append(pairs, pair)
+			}
+		}
+	}
+
+	if encoded := utm.Encode(); encoded != "" {
+		pairs = append(pairs, encoded)
+	}
+
+	destination.RawQuery = strings.Join(append(pairs, forwarded...), "&")
+
+	return destination.String()
+}
+
+// queryKey returns unescaped key of raw query pair, ok is false for empty and malformed pairs.
+func queryKey(pair string) (string, bool) {
+	if pair == "" || strings.Contains(pair, ";") {
+		return "", false
+	}
+
+	key := pair
+	if i := strings.Index(pair, "="); i >= 0 {
+		key = pair[:i]
+	}
+
+	unescaped, err := url.QueryUnescape(key)
+	if err != nil {
+		return "", false
+	}
+
+	return unescaped, true
+}
+
+// joinPath appends the rest of request path to the destination path.
+// The rest is cleaned first, so it cannot climb above the destination path with "..".
+func joinPath(destination *url.URL, rest string) {
+	cleaned := path.Clean("/" + rest)
+	if cleaned == "/" {
+		return
+	}
+
+	// trailing slash is meaningful for many sites, so it is kept
+	if strings.HasSuffix(rest, "/") {
+		cleaned += "/"
+	}
+
+	escaped := (&url.URL{Path: cleaned}).EscapedPath()
+	base := strings.TrimSuffix(destination.EscapedPath(), "/")
+
+	destination.Path = strings.TrimSuffix(destination.Path, "/") + cleaned
+	destination.RawPath = base + escaped
+}
+
+// redirectStatusCode returns redirect status code of the link falling back to server default.
+func redirectStatusCode(link *links.Link) int {
+	if link.RedirectType != 0 {
+		return link.RedirectType
+	}
+
+	if config.DefaultRedirectType != 0 {
+		return config.DefaultRedirectType
+	}
+
+	return http.StatusTemporaryRedirect
+}
@@ -0,0 +1,184 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/magmel48/go-web/internal/auth"
+	"github.com/magmel48/go-web/internal/db/links"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// defaultBranch is name of the branch that is taken when no rule of the link matches a request.
+const defaultBranch = "default"
+
+// ErrWrongRule is using for notifying clients about a redirect rule that cannot be used.
+var ErrWrongRule = errors.New("wrong redirect rule")
+
+// RuleStats is part of response when user asks for redirect rules of their link.
+type RuleStats struct {
+	links.Rule
+	Clicks int `json:"clicks"`
+}
+
+// RulesStats is response when user asks for redirect rules of their link.
+type RulesStats struct {
+	Rules         []RuleStats `json:"rules"`
+	DefaultClicks int         `json:"default_clicks"`
+}
+
+// GetRules returns redirect rules of the user link along with clicks made by every rule.
+func (s Shortener) GetRules(ctx context.Context, userID auth.UserID, shortID string) (*RulesStats, error) {
+	link, err := s.findUserLink(ctx, userID, shortID)
+	if err != nil {
+		return nil, err
+	}
+
+	branches, err := s.linksRepository.ListBranches(ctx, link.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := RulesStats{Rules: make([]RuleStats, len(link.Rules)), DefaultClicks: branches[defaultBranch]}
+	for i, rule := range link.Rules {
+		result.Rules[i] = RuleStats{Rule: rule, Clicks: branches[rule.Name]}
+	}
+
+	return &result, nil
+}
+
+// UpdateRules replaces redirect rules of the user link.
+func (s Shortener) UpdateRules(ctx context.Context, userID auth.UserID, shortID string, rules []links.Rule) error {
+	rules, err := normalizeRules(rules)
+	if err != nil {
+		return err
+	}
+
+	if err := s.validateDestinations(links.Options{Rules: rules}); err != nil {
+		return err
+	}
+
+	link, err := s.findUserLink(ctx, userID, shortID)
+	if err != nil {
+		return err
+	}
+
+	return s.linksRepository.UpdateRules(ctx, link.ID, rules)
+}
+
+// normalizeRules checks redirect rules and brings their conditions to the form they are matched in.
+func normalizeRules(rules []links.Rule) ([]links.Rule, error) {
+	names := make(map[string]bool, len(rules))
+	result := make([]links.Rule, len(rules))
+
+	for i, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = "rule-" + strconv.Itoa(i+1)
+		}
+
+		if rule.Name == defaultBranch || names[rule.Name] {
+			return nil, fmt.Errorf("%w: name %q is not unique", ErrWrongRule, rule.Name)
+		}
+
+		names[rule.Name] = true
+
+		rule.OS = strings.ToLower(rule.OS)
+		if rule.OS != "" && rule.OS != "ios" && rule.OS != "android" {
+			return nil, fmt.Errorf("%w: unsupported os %q", ErrWrongRule, rule.OS)
+		}
+
+		rule.Language = strings.ToLower(rule.Language)
+		rule.Country = strings.ToUpper(rule.Country)
+
+		if _, err := url.ParseRequestURI(rule.URL); err != nil {
+			return nil, fmt.Errorf("%w: cannot parse url of %q", ErrWrongRule, rule.Name)
+		}
+
+		result[i] = rule
+	}
+
+	return result, nil
+}
+
+// matchRule returns the first rule that matches the request or nil if there is no such rule.
+func matchRule(rules []links.Rule, request RedirectRequest) *links.Rule {
+	os := detectOS(request.UserAgent)
+	language := preferredLanguage(request.AcceptLanguage)
+	country := strings.ToUpper(request.Country)
+
+	for i, rule := range rules {
+		if rule.OS != "" && rule.OS != os {
+			continue
+		}
+
+		if rule.Language != "" && rule.Language != language {
+			continue
+		}
+
+		if rule.Country != "" && rule.Country != country {
+			continue
+		}
+
+		return &rules[i]
+	}
+
+	return nil
+}
+
+// detectOS detects mobile operating system of a client by User-Agent, empty string means any other one.
+func detectOS(userAgent string) string {
+	switch {
+	case strings.Contains(userAgent, "iPhone"), strings.Contains(userAgent, "iPad"), strings.Contains(userAgent, "iPod"):
+		return "ios"
+	case strings.Contains(userAgent, "Android"):
+		return "android"
+	default:
+		return ""
+	}
+}
+
+// preferredLanguage returns primary tag of the language with the highest quality from Accept-Language.
+func preferredLanguage(acceptLanguage string) string {
+	type language struct {
+		tag     string
+		quality float64
+	}
+
+	languages := make([]language, 0)
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		params := strings.Split(strings.TrimSpace(part), ";")
+
+		tag := strings.ToLower(strings.TrimSpace(params[0]))
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					quality = q
+				}
+			}
+		}
+
+		if quality > 0 {
+			languages = append(languages, language{tag: tag, quality: quality})
+		}
+	}
+
+	if len(languages) == 0 {
+		return ""
+	}
+
+	// stable sort keeps order of the header for languages with the same quality
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].quality > languages[j].quality
+	})
+
+	return strings.SplitN(languages[0].tag, "-", 2)[0]
+}
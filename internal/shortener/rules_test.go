@@ -0,0 +1,176 @@
+package shortener
+
+import (
+	"context"
+	"github.com/magmel48/go-web/internal/db/links"
+	linkmocks "github.com/magmel48/go-web/internal/db/links/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+)
+
+func Test_matchRule(t *testing.T) {
+	type args struct {
+		request RedirectRequest
+	}
+
+	rules := []links.Rule{
+		{Name: "ios", OS: "ios", URL: "https://apps.apple.com/app"},
+		{Name: "android", OS: "android", URL: "https://play.google.com/store/apps/details?id=app"},
+		{Name: "german", Language: "de", URL: "https://example.com/de"},
+		{Name: "swiss", Country: "CH", Language: "fr", URL: "https://example.com/ch"},
+	}
+
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "should match ios by user agent",
+			args: args{request: RedirectRequest{
+				UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 15_0 like Mac OS X) AppleWebKit/605.1.15"}},
+			want: "ios",
+		},
+		{
+			name: "should match android by user agent",
+			args: args{request: RedirectRequest{
+				UserAgent: "Mozilla/5.0 (Linux; Android 12; Pixel 6) AppleWebKit/537.36", AcceptLanguage: "de"}},
+			want: "android",
+		},
+		{
+			name: "should match the most preferred language",
+			args: args{request: RedirectRequest{AcceptLanguage: "en;q=0.5, de-DE;q=0.9"}},
+			want: "german",
+		},
+		{
+			name: "should match all conditions of a rule",
+			args: args{request: RedirectRequest{AcceptLanguage: "fr-CH", Country: "ch"}},
+			want: "swiss",
+		},
+		{
+			name: "should not match anything",
+			args: args{request: RedirectRequest{AcceptLanguage: "en-US,de;q=0.5", Country: "CH"}},
+			want: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if rule := matchRule(rules, tt.args.request); rule != nil {
+				got = rule.Name
+			}
+
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_normalizeRules(t *testing.T) {
+	type args struct {
+		rules []links.Rule
+	}
+
+	tests := []struct {
+		name    string
+		args    args
+		want    []links.Rule
+		wantErr bool
+	}{
+		{
+			name: "should name rules and normalize conditions",
+			args: args{rules: []links.Rule{{OS: "iOS", Language: "DE", Country: "de", URL: "https://example.com"}}},
+			want: []links.Rule{
+				{Name: "rule-1", OS: "ios", Language: "de", Country: "DE", URL: "https://example.com"}},
+			wantErr: false,
+		},
+		{
+			name:    "should reject unsupported os",
+			args:    args{rules: []links.Rule{{OS: "windows", URL: "https://example.com"}}},
+			wantErr: true,
+		},
+		{
+			name:    "should reject reserved name",
+			args:    args{rules: []links.Rule{{Name: defaultBranch, URL: "https://example.com"}}},
+			wantErr: true,
+		},
+		{
+			name:    "should reject malformed url",
+			args:    args{rules: []links.Rule{{Name: "broken", URL: "example"}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeRules(tt.args.rules)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("normalizeRules() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestShortener_GetRules(t *testing.T) {
+	type fields struct {
+		linksRepository links.Repository
+	}
+	type args struct {
+		userID  string
+		shortID string
+	}
+
+	link := &links.Link{
+		ID:          1,
+		ShortID:     "1",
+		OriginalURL: "https://example.com",
+		OwnerID:     "owner",
+		Options:     links.Options{Rules: []links.Rule{{Name: "ios", OS: "ios", URL: "https://apps.apple.com"}}},
+	}
+
+	linksRepository := linkmocks.Repository{}
+	linksRepository.On("FindByShortID", mock.Anything, "1").Return(link, nil)
+	linksRepository.On("ListBranches", mock.Anything, 1).Return(map[string]int{"ios": 2, defaultBranch: 3}, nil)
+
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    *RulesStats
+		wantErr error
+	}{
+		{
+			name:   "should return rules with clicks",
+			fields: fields{linksRepository: &linksRepository},
+			args:   args{userID: "owner", shortID: "1"},
+			want: &RulesStats{
+				Rules:         []RuleStats{{Rule: link.Rules[0], Clicks: 2}},
+				DefaultClicks: 3,
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "should not return rules of another user",
+			fields:  fields{linksRepository: &linksRepository},
+			args:    args{userID: "stranger", shortID: "1"},
+			want:    nil,
+			wantErr: ErrNotOwner,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Shortener{linksRepository: tt.fields.linksRepository}
+
+			got, err := s.GetRules(context.TODO(), &tt.args.userID, tt.args.shortID)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
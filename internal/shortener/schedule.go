@@ -0,0 +1,77 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/magmel48/go-web/internal/auth"
+	"github.com/magmel48/go-web/internal/db/links"
+	"net/url"
+	"time"
+)
+
+// ErrNotActiveYet is using for notifying clients that the link cannot be used before its activation time.
+var ErrNotActiveYet = errors.New("the link is not active yet")
+
+// ErrExpired is using for notifying clients that activation window of the link is over.
+var ErrExpired = errors.New("the link is expired")
+
+// ErrWrongSchedule is using for notifying clients about activation window that cannot be used.
+var ErrWrongSchedule = errors.New("wrong activation window")
+
+// GetSchedule returns activation window of the user link.
+func (s Shortener) GetSchedule(ctx context.Context, userID auth.UserID, shortID string) (*links.Schedule, error) {
+	link, err := s.findUserLink(ctx, userID, shortID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &link.Schedule, nil
+}
+
+// UpdateSchedule replaces activation window of the user link.
+func (s Shortener) UpdateSchedule(
+	ctx context.Context, userID auth.UserID, shortID string, schedule links.Schedule) error {
+	if err := validateSchedule(schedule); err != nil {
+		return err
+	}
+
+	if err := s.validateDestinations(links.Options{Schedule: schedule}); err != nil {
+		return err
+	}
+
+	link, err := s.findUserLink(ctx, userID, shortID)
+	if err != nil {
+		return err
+	}
+
+	return s.linksRepository.UpdateSchedule(ctx, link.ID, schedule)
+}
+
+// validateSchedule checks activation window can be used for a link.
+func validateSchedule(schedule links.Schedule) error {
+	if schedule.ActiveFrom != nil && schedule.ActiveUntil != nil && !schedule.ActiveUntil.After(*schedule.ActiveFrom) {
+		return fmt.Errorf("%w: active_until should be after active_from", ErrWrongSchedule)
+	}
+
+	if schedule.PlaceholderURL != "" {
+		if _, err := url.ParseRequestURI(schedule.PlaceholderURL); err != nil {
+			return fmt.Errorf("%w: cannot parse placeholder url", ErrWrongSchedule)
+		}
+	}
+
+	return nil
+}
+
+// checkSchedule checks if the link can be used at specified time.
+func checkSchedule(link *links.Link, now time.Time) error {
+	if link.ActiveFrom != nil && now.Before(*link.ActiveFrom) {
+		return ErrNotActiveYet
+	}
+
+	if link.ActiveUntil != nil && !now.Before(*link.ActiveUntil) {
+		return ErrExpired
+	}
+
+	return nil
+}
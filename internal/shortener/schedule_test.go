@@ -0,0 +1,93 @@
+package shortener
+
+import (
+	"context"
+	"github.com/magmel48/go-web/internal/db/links"
+	linkmocks "github.com/magmel48/go-web/internal/db/links/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+func Test_checkSchedule(t *testing.T) {
+	now := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	before := now.Add(-time.Hour)
+	after := now.Add(time.Hour)
+
+	tests := []struct {
+		name     string
+		schedule links.Schedule
+		wantErr  error
+	}{
+		{
+			name:     "should allow link without schedule",
+			schedule: links.Schedule{},
+			wantErr:  nil,
+		},
+		{
+			name:     "should allow link inside activation window",
+			schedule: links.Schedule{ActiveFrom: &before, ActiveUntil: &after},
+			wantErr:  nil,
+		},
+		{
+			name:     "should reject link before activation",
+			schedule: links.Schedule{ActiveFrom: &after},
+			wantErr:  ErrNotActiveYet,
+		},
+		{
+			name:     "should reject expired link",
+			schedule: links.Schedule{ActiveUntil: &before},
+			wantErr:  ErrExpired,
+		},
+		{
+			name:     "should reject link exactly at expiration",
+			schedule: links.Schedule{ActiveUntil: &now},
+			wantErr:  ErrExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link := &links.Link{Options: links.Options{Schedule: tt.schedule}}
+			assert.ErrorIs(t, checkSchedule(link, now), tt.wantErr)
+		})
+	}
+}
+
+func Test_validateSchedule(t *testing.T) {
+	from := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	until := from.Add(time.Hour)
+
+	assert.NoError(t, validateSchedule(links.Schedule{ActiveFrom: &from, ActiveUntil: &until}))
+	assert.ErrorIs(t, validateSchedule(links.Schedule{ActiveFrom: &until, ActiveUntil: &from}), ErrWrongSchedule)
+	assert.ErrorIs(t, validateSchedule(links.Schedule{PlaceholderURL: "soon"}), ErrWrongSchedule)
+}
+
+func TestShortener_Resolve_schedule(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	pendingRepository := linkmocks.Repository{}
+	pendingRepository.On("FindByShortID", mock.Anything, "1").Return(
+		&links.Link{ShortID: "1", OriginalURL: "https://google.com", Options: links.Options{
+			Schedule: links.Schedule{ActiveFrom: &future}}}, nil)
+	pendingRepository.On("FindByShortID", mock.Anything, "2").Return(
+		&links.Link{ShortID: "2", OriginalURL: "https://google.com", Options: links.Options{
+			Schedule: links.Schedule{ActiveFrom: &future, PlaceholderURL: "https://example.com/soon"}}}, nil)
+	pendingRepository.On("FindByShortID", mock.Anything, "3").Return(
+		&links.Link{ShortID: "3", OriginalURL: "https://google.com", Options: links.Options{
+			Schedule: links.Schedule{ActiveUntil: &past}}}, nil)
+
+	s := Shortener{linksRepository: &pendingRepository}
+
+	_, err := s.Resolve(context.TODO(), RedirectRequest{ShortID: "1"})
+	assert.ErrorIs(t, err, ErrNotActiveYet)
+
+	got, err := s.Resolve(context.TODO(), RedirectRequest{ShortID: "2"})
+	assert.NoError(t, err)
+	assert.Equal(t, &Redirect{URL: "https://example.com/soon", StatusCode: 302}, got)
+
+	_, err = s.Resolve(context.TODO(), RedirectRequest{ShortID: "3"})
+	assert.ErrorIs(t, err, ErrExpired)
+}
@@ -5,16 +5,42 @@ import (
 	"errors"
 	"fmt"
 	"github.com/magmel48/go-web/internal/auth"
+	"github.com/magmel48/go-web/internal/canonical"
+	"github.com/magmel48/go-web/internal/config"
 	"github.com/magmel48/go-web/internal/daemons"
 	"github.com/magmel48/go-web/internal/db"
 	"github.com/magmel48/go-web/internal/db/links"
 	"github.com/magmel48/go-web/internal/db/userlinks"
-	"net/url"
+	"github.com/magmel48/go-web/internal/validation"
+	"log"
+	"strings"
+	"time"
 )
 
 // ErrDeleted is using for notifying clients about the fact the link is already deleted.
 var ErrDeleted = errors.New("the link is deleted")
 
+// ErrNotFound is using for notifying clients about the fact the link does not exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrNotOwner is using for notifying clients that the link was not made shorter by them.
+var ErrNotOwner = errors.New("the link belongs to another user")
+
+// ErrUnsupportedRedirectType is using for notifying clients about wrong redirect type of a new link.
+var ErrUnsupportedRedirectType = errors.New("unsupported redirect type")
+
+// ErrWrongMaxClicks is using for notifying clients about negative clicks limit of a new link.
+var ErrWrongMaxClicks = errors.New("max clicks cannot be negative")
+
+// ErrBlocked is using for notifying clients that the link leads to a blocked domain.
+var ErrBlocked = errors.New("the link destination is blocked")
+
+// domainListsReloadInterval is how often domain list files are checked for changes.
+const domainListsReloadInterval = 30 * time.Second
+
+// ErrWrongUTMParameter is using for notifying clients that a parameter appended to a link is not a UTM one.
+var ErrWrongUTMParameter = errors.New("only utm_ parameters can be appended to a link")
+
 // Shortener makes links shorter.
 type Shortener struct {
 	ctx                 context.Context
@@ -23,17 +49,24 @@ type Shortener struct {
 	linksRepository     links.Repository
 	userLinksRepository userlinks.Repository
 	daemon              daemons.Daemon
+	validator           validation.Chain
+	// redirectValidator checks destinations of existing links on every redirect
+	redirectValidator validation.Chain
+	canonicalOptions  canonical.Options
 }
 
 // UrlsMap is part of response when user asks for their links stored previously.
 type UrlsMap struct {
 	ShortURL    string `json:"short_url"`
 	OriginalURL string `json:"original_url"`
+	// DisplayURL is OriginalURL readable by people.
+	DisplayURL string `json:"display_url"`
 }
 
 // NewShortener creates new shortener.
 func NewShortener(ctx context.Context, prefix string, database db.DB) Shortener {
 	userLinksRepository := userlinks.NewPostgresRepository(database.Instance())
+	domainValidator := newDomainValidator(ctx)
 
 	shortener := Shortener{
 		prefix:              prefix,
@@ -41,6 +74,15 @@ func NewShortener(ctx context.Context, prefix string, database db.DB) Shortener
 		linksRepository:     links.NewPostgresRepository(database.Instance()),
 		userLinksRepository: userLinksRepository,
 		daemon:              daemons.NewDeletingRecordsDaemon(ctx, userLinksRepository),
+		validator:           newValidator(domainValidator),
+		canonicalOptions: canonical.Options{
+			SortQuery:     config.SortQuery,
+			StripTracking: config.StripTrackingParams,
+		},
+	}
+
+	if domainValidator != nil {
+		shortener.redirectValidator = validation.Chain{domainValidator}
 	}
 
 	// starting deleting requests processing
@@ -49,6 +91,59 @@ func NewShortener(ctx context.Context, prefix string, database db.DB) Shortener
 	return shortener
 }
 
+// newValidator returns validation chain for link destinations configured by server settings.
+func newValidator(domainValidator validation.Validator) validation.Chain {
+	validator := validation.Chain{
+		validation.MaxLengthValidator(config.MaxURLLength),
+		validation.SchemeValidator(config.AllowedSchemes),
+		validation.SelfLoopValidator(config.BaseShortenerURL),
+		validation.ShortenerValidator(config.OtherShorteners),
+	}
+
+	if config.BlockPrivateAddresses {
+		validator = append(validator, validation.PrivateAddressValidator())
+	}
+
+	if config.HomographPolicy == config.HomographReject {
+		validator = append(validator, validation.HomographValidator())
+	}
+
+	if domainValidator != nil {
+		validator = append(validator, domainValidator)
+	}
+
+	return validator
+}
+
+// newDomainValidator loads configured domain lists and keeps them up to date until ctx is done.
+// It returns nil if there is no blocklist.
+func newDomainValidator(ctx context.Context) validation.Validator {
+	if config.BlocklistPath == "" {
+		return nil
+	}
+
+	blocklist, err := validation.LoadDomainList(config.BlocklistPath)
+	if err != nil {
+		log.Fatalf("cannot load blocklist %s: %v", config.BlocklistPath, err)
+	}
+
+	lists := []*validation.DomainList{blocklist}
+
+	var allowlist *validation.DomainList
+	if config.AllowlistPath != "" {
+		allowlist, err = validation.LoadDomainList(config.AllowlistPath)
+		if err != nil {
+			log.Fatalf("cannot load allowlist %s: %v", config.AllowlistPath, err)
+		}
+
+		lists = append(lists, allowlist)
+	}
+
+	go validation.WatchDomainLists(ctx, domainListsReloadInterval, lists...)
+
+	return validation.DomainListValidator(blocklist, allowlist)
+}
+
 // IsStorageAvailable checks if storage (database) available.
 func (s Shortener) IsStorageAvailable(ctx context.Context) bool {
 	return s.database.CheckConnection(ctx)
@@ -56,7 +151,21 @@ func (s Shortener) IsStorageAvailable(ctx context.Context) bool {
 
 // MakeShorterBatch makes shorter links by specified batch payload.
 func (s Shortener) MakeShorterBatch(ctx context.Context, originalURLs []string) ([]string, error) {
-	linkRecords, err := s.linksRepository.CreateBatch(ctx, originalURLs)
+	canonicalURLs := make([]string, len(originalURLs))
+	for i, originalURL := range originalURLs {
+		if err := s.validator.ValidateURL(originalURL); err != nil {
+			return nil, fmt.Errorf("%s: %w", originalURL, err)
+		}
+
+		canonicalURL, err := canonical.Canonicalize(originalURL, s.canonicalOptions)
+		if err != nil {
+			return nil, err
+		}
+
+		canonicalURLs[i] = canonicalURL
+	}
+
+	linkRecords, err := s.linksRepository.CreateBatch(ctx, canonicalURLs)
 	if err != nil {
 		return nil, err
 	}
@@ -69,14 +178,66 @@ func (s Shortener) MakeShorterBatch(ctx context.Context, originalURLs []string)
 	return result, nil
 }
 
+// URLForms returns stored ASCII form of original URL and its Unicode form for showing to people.
+func (s Shortener) URLForms(originalURL string) (canonical.Forms, error) {
+	return canonical.URLForms(originalURL, s.canonicalOptions)
+}
+
 // MakeShorter makes a link shorter.
-func (s Shortener) MakeShorter(ctx context.Context, originalURL string, userID auth.UserID) (string, error) {
-	_, err := url.ParseRequestURI(originalURL)
+func (s Shortener) MakeShorter(
+	ctx context.Context, originalURL string, userID auth.UserID, options links.Options) (string, error) {
+	if err := s.validator.ValidateURL(originalURL); err != nil {
+		return "", err
+	}
+
+	if !links.IsRedirectTypeValid(options.RedirectType) {
+		return "", ErrUnsupportedRedirectType
+	}
+
+	if options.MaxClicks < 0 {
+		return "", ErrWrongMaxClicks
+	}
+
+	for key := range options.UTMParams {
+		if !strings.HasPrefix(key, "utm_") {
+			return "", ErrWrongUTMParameter
+		}
+	}
+
+	var err error
+	options.Rules, err = normalizeRules(options.Rules)
 	if err != nil {
-		return "", errors.New("cannot parse url")
+		return "", err
 	}
 
-	link, err := s.linksRepository.Create(ctx, "", originalURL)
+	options.Split, err = normalizeSplit(options.Split)
+	if err != nil {
+		return "", err
+	}
+
+	if err := validateSchedule(options.Schedule); err != nil {
+		return "", err
+	}
+
+	if err := validateDeepLink(options.DeepLink); err != nil {
+		return "", err
+	}
+
+	if err := s.validateDestinations(options); err != nil {
+		return "", err
+	}
+
+	originalURL, err = canonical.Canonicalize(originalURL, s.canonicalOptions)
+	if err != nil {
+		return "", err
+	}
+
+	ownerID := ""
+	if userID != nil {
+		ownerID = *userID
+	}
+
+	link, err := s.linksRepository.Create(ctx, "", originalURL, ownerID, options)
 	if err != nil {
 		if !errors.Is(err, links.ErrConflict) {
 			return "", err
@@ -96,22 +257,14 @@ func (s Shortener) MakeShorter(ctx context.Context, originalURL string, userID a
 	return fmt.Sprintf("%s/%s", s.prefix, link.ShortID), err
 }
 
-// RestoreLong restores short link to initial state if an info was stored before.
+// RestoreLong returns destination of the short link as it is resolved for redirects, with the same checks.
 func (s Shortener) RestoreLong(ctx context.Context, shortID string) (string, error) {
-	link, err := s.linksRepository.FindByShortID(ctx, shortID)
+	redirect, err := s.Resolve(ctx, RedirectRequest{ShortID: shortID})
 	if err != nil {
 		return "", err
 	}
 
-	if link == nil {
-		return "", errors.New("not found")
-	}
-
-	if link.IsDeleted {
-		return link.OriginalURL, ErrDeleted
-	}
-
-	return link.OriginalURL, nil
+	return redirect.URL, nil
 }
 
 // GetUserLinks returns all links belongs to specified userID.
@@ -130,12 +283,90 @@ func (s Shortener) GetUserLinks(ctx context.Context, userID auth.UserID) ([]Urls
 		result[i] = UrlsMap{
 			ShortURL:    fmt.Sprintf("%s/%s", s.prefix, userLink.Link.ShortID),
 			OriginalURL: userLink.Link.OriginalURL,
+			DisplayURL:  canonical.URLToUnicode(userLink.Link.OriginalURL),
 		}
 	}
 
 	return result, nil
 }
 
+// findLink finds a link by short identifier and checks whether it can be used.
+// Deleted link is returned along with ErrDeleted.
+func (s Shortener) findLink(ctx context.Context, shortID string) (*links.Link, error) {
+	link, err := s.linksRepository.FindByShortID(ctx, shortID)
+	if err != nil {
+		return nil, err
+	}
+
+	if link == nil {
+		return nil, ErrNotFound
+	}
+
+	if link.IsDeleted {
+		return link, ErrDeleted
+	}
+
+	return link, nil
+}
+
+// validateDestinations checks alternative destinations of the link (rules, split, placeholder and app stores)
+// the same way as the original URL.
+func (s Shortener) validateDestinations(options links.Options) error {
+	for _, rule := range options.Rules {
+		if err := s.validator.ValidateURL(rule.URL); err != nil {
+			return fmt.Errorf("rule %q: %w", rule.Name, err)
+		}
+	}
+
+	if options.Split != nil {
+		for _, destination := range options.Split.Destinations {
+			if err := s.validator.ValidateURL(destination.URL); err != nil {
+				return fmt.Errorf("destination %q: %w", destination.Name, err)
+			}
+		}
+	}
+
+	if options.PlaceholderURL != "" {
+		if err := s.validator.ValidateURL(options.PlaceholderURL); err != nil {
+			return fmt.Errorf("placeholder: %w", err)
+		}
+	}
+
+	if options.DeepLink != nil {
+		if storeURL := options.DeepLink.IOSStoreURL; storeURL != "" {
+			if err := s.validator.ValidateURL(storeURL); err != nil {
+				return fmt.Errorf("ios store: %w", err)
+			}
+		}
+
+		if storeURL := options.DeepLink.AndroidStoreURL; storeURL != "" {
+			if err := s.validator.ValidateURL(storeURL); err != nil {
+				return fmt.Errorf("android store: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// findUserLink finds a link by short identifier and checks it was made shorter by the user.
+func (s Shortener) findUserLink(ctx context.Context, userID auth.UserID, shortID string) (*links.Link, error) {
+	if userID == nil {
+		return nil, ErrNotOwner
+	}
+
+	link, err := s.findLink(ctx, shortID)
+	if err != nil {
+		return nil, err
+	}
+
+	if link.OwnerID == "" || link.OwnerID != *userID {
+		return nil, ErrNotOwner
+	}
+
+	return link, nil
+}
+
 // DeleteURLs is registering links deletion intentions.
 func (s Shortener) DeleteURLs(userID auth.UserID, shortIDs []string) {
 	s.daemon.EnqueueJob(daemons.QueryItem{UserID: userID, ShortIDs: shortIDs})
@@ -10,8 +10,12 @@ import (
 	linkmocks "github.com/magmel48/go-web/internal/db/links/mocks"
 	"github.com/magmel48/go-web/internal/db/userlinks"
 	userlinkmocks "github.com/magmel48/go-web/internal/db/userlinks/mocks"
+	"github.com/magmel48/go-web/internal/validation"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -26,7 +30,7 @@ func TestShortener_MakeShorter(t *testing.T) {
 	}
 
 	linksRepository := linkmocks.Repository{}
-	linksRepository.On("Create", mock.Anything, mock.Anything, mock.Anything).Return(
+	linksRepository.On("Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(
 		&links.Link{ShortID: "1"}, nil)
 
 	userLinksRepository := userlinkmocks.Repository{}
@@ -59,7 +63,7 @@ func TestShortener_MakeShorter(t *testing.T) {
 				userLinksRepository: tt.fields.userLinksRepository,
 			}
 
-			if got, err := s.MakeShorter(context.TODO(), tt.args.url, auth.NewUserID()); got != tt.want {
+			if got, err := s.MakeShorter(context.TODO(), tt.args.url, auth.NewUserID(), links.Options{}); got != tt.want {
 				t.Errorf("MakeShorter() = %v, want %v, err %v", got, tt.want, err)
 			}
 		})
@@ -131,6 +135,205 @@ func TestShortener_RestoreLong(t *testing.T) {
 	}
 }
 
+func TestShortener_Resolve(t *testing.T) {
+	type fields struct {
+		linksRepository links.Repository
+	}
+	type args struct {
+		request RedirectRequest
+	}
+
+	defaultRepository := linkmocks.Repository{}
+	defaultRepository.On("FindByShortID", mock.Anything, mock.Anything).Return(
+		&links.Link{ShortID: "1", OriginalURL: "https://google.com"}, nil)
+
+	permanentRepository := linkmocks.Repository{}
+	permanentRepository.On("FindByShortID", mock.Anything, mock.Anything).Return(
+		&links.Link{ShortID: "1", OriginalURL: "https://google.com", Options: links.Options{RedirectType: 308}}, nil)
+
+	forwardingRepository := linkmocks.Repository{}
+	forwardingRepository.On("FindByShortID", mock.Anything, mock.Anything).Return(
+		&links.Link{
+			ShortID:     "1",
+			OriginalURL: "https://google.com/search?q=go&utm_source=site",
+			Options: links.Options{
+				ForwardQuery: true,
+				UTMParams:    url.Values{"utm_source": {"newsletter"}, "utm_medium": {"email"}},
+			},
+		}, nil)
+
+	encodedRepository := linkmocks.Repository{}
+	encodedRepository.On("FindByShortID", mock.Anything, mock.Anything).Return(
+		&links.Link{
+			ShortID:     "1",
+			OriginalURL: "https://example.com/page?z=1&path=%2Fa%2Fb&q=x+y&a=%7E",
+			Options:     links.Options{ForwardQuery: true},
+		}, nil)
+
+	passwordHash, _ := HashPassword("secret")
+	protectedRepository := linkmocks.Repository{}
+	protectedRepository.On("FindByShortID", mock.Anything, mock.Anything).Return(
+		&links.Link{ShortID: "1", OriginalURL: "https://google.com", Options: links.Options{PasswordHash: passwordHash}}, nil)
+
+	limitedRepository := linkmocks.Repository{}
+	limitedRepository.On("FindByShortID", mock.Anything, mock.Anything).Return(
+		&links.Link{ID: 1, ShortID: "1", OriginalURL: "https://google.com", Options: links.Options{MaxClicks: 1}}, nil)
+	limitedRepository.On("UseClick", mock.Anything, 1).Return(true, nil).Once()
+	limitedRepository.On("UseClick", mock.Anything, 1).Return(false, nil)
+
+	rulesRepository := linkmocks.Repository{}
+	rulesRepository.On("FindByShortID", mock.Anything, mock.Anything).Return(
+		&links.Link{
+			ID:          2,
+			ShortID:     "2",
+			OriginalURL: "https://google.com",
+			Options:     links.Options{Rules: []links.Rule{{Name: "german", Language: "de", URL: "https://google.de"}}},
+		}, nil)
+	rulesRepository.On("RegisterBranch", mock.Anything, 2, mock.Anything).Return(nil)
+
+	prefixRepository := linkmocks.Repository{}
+	prefixRepository.On("FindByShortID", mock.Anything, mock.Anything).Return(
+		&links.Link{ShortID: "docs", OriginalURL: "https://example.com/docs/", Options: links.Options{IsPrefix: true}}, nil)
+
+	tests := []struct {
+		name    string
+		fields  fields
+		args    args
+		want    *Redirect
+		wantErr error
+	}{
+		{
+			name:    "should fall back to temporary redirect",
+			fields:  fields{linksRepository: &defaultRepository},
+			args:    args{request: RedirectRequest{ShortID: "1", Query: "utm_source=x"}},
+			want:    &Redirect{URL: "https://google.com", StatusCode: 307, Cacheable: true},
+			wantErr: nil,
+		},
+		{
+			name:    "should use redirect type of the link",
+			fields:  fields{linksRepository: &permanentRepository},
+			args:    args{request: RedirectRequest{ShortID: "1"}},
+			want:    &Redirect{URL: "https://google.com", StatusCode: 308, Cacheable: true},
+			wantErr: nil,
+		},
+		{
+			name:   "should append utm parameters",
+			fields: fields{linksRepository: &forwardingRepository},
+			args:   args{request: RedirectRequest{ShortID: "1"}},
+			want: &Redirect{
+				URL:        "https://google.com/search?q=go&utm_medium=email&utm_source=newsletter",
+				StatusCode: 307,
+				Cacheable:  true,
+			},
+			wantErr: nil,
+		},
+		{
+			name:   "should merge forwarded query",
+			fields: fields{linksRepository: &forwardingRepository},
+			args:   args{request: RedirectRequest{ShortID: "1", Query: "utm_source=x&ref=a%26b"}},
+			want: &Redirect{
+				URL:        "https://google.com/search?q=go&utm_medium=email&utm_source=x&ref=a%26b",
+				StatusCode: 307,
+				Cacheable:  true,
+			},
+			wantErr: nil,
+		},
+		{
+			name:   "should keep order and escaping of destination query",
+			fields: fields{linksRepository: &encodedRepository},
+			args:   args{request: RedirectRequest{ShortID: "1", Query: "ref=b%20c&z=2"}},
+			want: &Redirect{
+				URL:        "https://example.com/page?path=%2Fa%2Fb&q=x+y&a=%7E&ref=b%20c&z=2",
+				StatusCode: 307,
+				Cacheable:  true,
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "should require password for protected link",
+			fields:  fields{linksRepository: &protectedRepository},
+			args:    args{request: RedirectRequest{ShortID: "1"}},
+			want:    nil,
+			wantErr: ErrPasswordRequired,
+		},
+		{
+			name:    "should reject wrong password",
+			fields:  fields{linksRepository: &protectedRepository},
+			args:    args{request: RedirectRequest{ShortID: "1", Password: "wrong"}},
+			want:    nil,
+			wantErr: ErrWrongPassword,
+		},
+		{
+			name:    "should redirect with correct password",
+			fields:  fields{linksRepository: &protectedRepository},
+			args:    args{request: RedirectRequest{ShortID: "1", Password: "secret"}},
+			want:    &Redirect{URL: "https://google.com", StatusCode: 307, Cacheable: true},
+			wantErr: nil,
+		},
+		{
+			name:    "should take a click from limited link",
+			fields:  fields{linksRepository: &limitedRepository},
+			args:    args{request: RedirectRequest{ShortID: "1"}},
+			want:    &Redirect{URL: "https://google.com", StatusCode: 307, Cacheable: false},
+			wantErr: nil,
+		},
+		{
+			name:    "should treat link without clicks left as deleted",
+			fields:  fields{linksRepository: &limitedRepository},
+			args:    args{request: RedirectRequest{ShortID: "1"}},
+			want:    nil,
+			wantErr: ErrDeleted,
+		},
+		{
+			name:    "should take matching rule",
+			fields:  fields{linksRepository: &rulesRepository},
+			args:    args{request: RedirectRequest{ShortID: "2", AcceptLanguage: "de-DE,en;q=0.8"}},
+			want:    &Redirect{URL: "https://google.de", StatusCode: 307, Cacheable: false, Branch: "german"},
+			wantErr: nil,
+		},
+		{
+			name:    "should take default branch",
+			fields:  fields{linksRepository: &rulesRepository},
+			args:    args{request: RedirectRequest{ShortID: "2", AcceptLanguage: "en"}},
+			want:    &Redirect{URL: "https://google.com", StatusCode: 307, Cacheable: false, Branch: defaultBranch},
+			wantErr: nil,
+		},
+		{
+			name:    "should append path and query to prefix link",
+			fields:  fields{linksRepository: &prefixRepository},
+			args:    args{request: RedirectRequest{ShortID: "docs", Path: "/guides/intro", Query: "v=2"}},
+			want:    &Redirect{URL: "https://example.com/docs/guides/intro?v=2", StatusCode: 307, Cacheable: true},
+			wantErr: nil,
+		},
+		{
+			name:    "should not climb above destination path of prefix link",
+			fields:  fields{linksRepository: &prefixRepository},
+			args:    args{request: RedirectRequest{ShortID: "docs", Path: "/../../admin/"}},
+			want:    &Redirect{URL: "https://example.com/docs/admin/", StatusCode: 307, Cacheable: true},
+			wantErr: nil,
+		},
+		{
+			name:    "should not append path to regular link",
+			fields:  fields{linksRepository: &defaultRepository},
+			args:    args{request: RedirectRequest{ShortID: "1", Path: "/guides/intro"}},
+			want:    nil,
+			wantErr: ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Shortener{
+				linksRepository: tt.fields.linksRepository,
+			}
+
+			got, err := s.Resolve(context.TODO(), tt.args.request)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
 func TestShortener_DeleteURLs(t *testing.T) {
 	type fields struct {
 		ctx                 context.Context
@@ -179,3 +382,86 @@ func TestShortener_DeleteURLs(t *testing.T) {
 		})
 	}
 }
+
+func TestShortener_validateDestinations(t *testing.T) {
+	s := Shortener{validator: validation.Chain{validation.SelfLoopValidator("http://localhost:8080")}}
+
+	tests := []struct {
+		name     string
+		deepLink *links.DeepLink
+		wantErr  bool
+	}{
+		{
+			name:     "should accept store urls",
+			deepLink: &links.DeepLink{AppURL: "myapp://home", IOSStoreURL: "https://apps.apple.com/app/id1"},
+			wantErr:  false,
+		},
+		{
+			name:     "should reject ios store url leading to the shortener",
+			deepLink: &links.DeepLink{AppURL: "myapp://home", IOSStoreURL: "http://localhost:8080/1"},
+			wantErr:  true,
+		},
+		{
+			name:     "should reject android store url leading to the shortener",
+			deepLink: &links.DeepLink{AppURL: "myapp://home", AndroidStoreURL: "http://localhost:8080/1"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.validateDestinations(links.Options{DeepLink: tt.deepLink})
+			assert.Equal(t, tt.wantErr, err != nil, "validateDestinations() error = %v", err)
+		})
+	}
+}
+
+func TestShortener_Resolve_blocked(t *testing.T) {
+	linksRepository := linkmocks.Repository{}
+	linksRepository.On("FindByShortID", mock.Anything, mock.Anything).Return(
+		&links.Link{
+			ID:          1,
+			ShortID:     "1",
+			OriginalURL: "https://bad.com/page",
+			Options: links.Options{
+				MaxClicks: 1,
+				Rules:     []links.Rule{{Name: "ios", OS: "ios", URL: "https://bad.com/ios"}},
+			},
+		}, nil)
+
+	s := Shortener{
+		linksRepository: &linksRepository,
+		redirectValidator: validation.Chain{validation.ValidatorFunc(func(destination *url.URL) error {
+			if destination.Hostname() == "bad.com" {
+				return &validation.Error{Code: validation.CodeBlockedDomain, Reason: "blocked"}
+			}
+
+			return nil
+		})},
+	}
+
+	_, err := s.Resolve(context.TODO(), RedirectRequest{ShortID: "1"})
+	assert.ErrorIs(t, err, ErrBlocked)
+	linksRepository.AssertNotCalled(t, "UseClick", mock.Anything, mock.Anything)
+	linksRepository.AssertNotCalled(t, "RegisterBranch", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestShortener_Resolve_blockedUnicodeHost(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("xn--e1afmkfd.xn--p1ai\n"), 0600))
+
+	blocklist, err := validation.LoadDomainList(path)
+	assert.NoError(t, err)
+
+	linksRepository := linkmocks.Repository{}
+	linksRepository.On("FindByShortID", mock.Anything, mock.Anything).Return(
+		&links.Link{ID: 1, ShortID: "1", OriginalURL: "https://пример.рф/page"}, nil)
+
+	s := Shortener{
+		linksRepository:   &linksRepository,
+		redirectValidator: validation.Chain{validation.DomainListValidator(blocklist, nil)},
+	}
+
+	_, err = s.Resolve(context.TODO(), RedirectRequest{ShortID: "1"})
+	assert.ErrorIs(t, err, ErrBlocked)
+}
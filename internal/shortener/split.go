@@ -0,0 +1,177 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/magmel48/go-web/internal/auth"
+	"github.com/magmel48/go-web/internal/db/links"
+	"math/rand"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrWrongSplit is using for notifying clients about split destinations that cannot be used.
+var ErrWrongSplit = errors.New("wrong split destinations")
+
+// random picks weighted destinations, it is not safe for concurrent use, so randomMu is guarding it.
+var (
+	random   = rand.New(rand.NewSource(time.Now().UnixNano()))
+	randomMu sync.Mutex
+)
+
+// DestinationStats is part of response when user asks for split destinations of their link.
+type DestinationStats struct {
+	links.Destination
+	Clicks int `json:"clicks"`
+}
+
+// SplitStats is response when user asks for split destinations of their link.
+type SplitStats struct {
+	Rotation     links.Rotation     `json:"rotation"`
+	Sticky       bool               `json:"sticky"`
+	Destinations []DestinationStats `json:"destinations"`
+}
+
+// GetSplit returns split destinations of the user link along with clicks made by every destination.
+func (s Shortener) GetSplit(ctx context.Context, userID auth.UserID, shortID string) (*SplitStats, error) {
+	link, err := s.findUserLink(ctx, userID, shortID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := SplitStats{Destinations: make([]DestinationStats, 0)}
+	if link.Split == nil {
+		return &result, nil
+	}
+
+	variants, err := s.linksRepository.ListVariants(ctx, link.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Rotation = link.Split.Rotation
+	result.Sticky = link.Split.Sticky
+	for _, destination := range link.Split.Destinations {
+		result.Destinations = append(
+			result.Destinations, DestinationStats{Destination: destination, Clicks: variants[destination.Name]})
+	}
+
+	return &result, nil
+}
+
+// UpdateSplit replaces split destinations of the user link, empty destinations turn splitting off.
+func (s Shortener) UpdateSplit(ctx context.Context, userID auth.UserID, shortID string, split *links.Split) error {
+	split, err := normalizeSplit(split)
+	if err != nil {
+		return err
+	}
+
+	if err := s.validateDestinations(links.Options{Split: split}); err != nil {
+		return err
+	}
+
+	link, err := s.findUserLink(ctx, userID, shortID)
+	if err != nil {
+		return err
+	}
+
+	return s.linksRepository.UpdateSplit(ctx, link.ID, split)
+}
+
+// normalizeSplit checks split destinations and fills defaults, split without destinations is turned into nil.
+func normalizeSplit(split *links.Split) (*links.Split, error) {
+	if split == nil || len(split.Destinations) == 0 {
+		return nil, nil
+	}
+
+	result := links.Split{
+		Rotation:     split.Rotation,
+		Sticky:       split.Sticky,
+		Destinations: make([]links.Destination, len(split.Destinations)),
+	}
+
+	switch result.Rotation {
+	case "":
+		result.Rotation = links.RotationWeighted
+	case links.RotationWeighted, links.RotationRoundRobin:
+	default:
+		return nil, fmt.Errorf("%w: unsupported rotation %q", ErrWrongSplit, split.Rotation)
+	}
+
+	names := make(map[string]bool, len(split.Destinations))
+	totalWeight := 0
+
+	for i, destination := range split.Destinations {
+		if destination.Name == "" {
+			destination.Name = "variant-" + strconv.Itoa(i+1)
+		}
+
+		if names[destination.Name] {
+			return nil, fmt.Errorf("%w: name %q is not unique", ErrWrongSplit, destination.Name)
+		}
+
+		names[destination.Name] = true
+
+		if destination.Weight < 0 {
+			return nil, fmt.Errorf("%w: weight of %q cannot be negative", ErrWrongSplit, destination.Name)
+		}
+
+		if _, err := url.ParseRequestURI(destination.URL); err != nil {
+			return nil, fmt.Errorf("%w: cannot parse url of %q", ErrWrongSplit, destination.Name)
+		}
+
+		totalWeight += destination.Weight
+		result.Destinations[i] = destination
+	}
+
+	if result.Rotation == links.RotationWeighted && totalWeight == 0 {
+		return nil, fmt.Errorf("%w: at least one destination should have positive weight", ErrWrongSplit)
+	}
+
+	return &result, nil
+}
+
+// pickDestination picks one of split destinations of the link,
+// destination pinned for the visitor is kept if it still exists.
+func (s Shortener) pickDestination(ctx context.Context, link *links.Link, pinned string) (*links.Destination, error) {
+	destinations := link.Split.Destinations
+
+	if link.Split.Sticky && pinned != "" {
+		for i := range destinations {
+			if destinations[i].Name == pinned {
+				return &destinations[i], nil
+			}
+		}
+	}
+
+	if link.Split.Rotation == links.RotationRoundRobin {
+		counter, err := s.linksRepository.NextRotation(ctx, link.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		return &destinations[(counter-1)%len(destinations)], nil
+	}
+
+	totalWeight := 0
+	for _, destination := range destinations {
+		totalWeight += destination.Weight
+	}
+
+	randomMu.Lock()
+	point := random.Intn(totalWeight)
+	randomMu.Unlock()
+
+	for i := range destinations {
+		if point < destinations[i].Weight {
+			return &destinations[i], nil
+		}
+
+		point -= destinations[i].Weight
+	}
+
+	return &destinations[len(destinations)-1], nil
+}
@@ -0,0 +1,138 @@
+package shortener
+
+import (
+	"context"
+	"github.com/magmel48/go-web/internal/db/links"
+	linkmocks "github.com/magmel48/go-web/internal/db/links/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+)
+
+func Test_normalizeSplit(t *testing.T) {
+	type args struct {
+		split *links.Split
+	}
+
+	tests := []struct {
+		name    string
+		args    args
+		want    *links.Split
+		wantErr bool
+	}{
+		{
+			name:    "should turn empty split off",
+			args:    args{split: &links.Split{Rotation: links.RotationRoundRobin}},
+			want:    nil,
+			wantErr: false,
+		},
+		{
+			name: "should fill defaults",
+			args: args{split: &links.Split{Destinations: []links.Destination{
+				{URL: "https://a.com", Weight: 70}, {URL: "https://b.com", Weight: 30}}}},
+			want: &links.Split{
+				Rotation: links.RotationWeighted,
+				Destinations: []links.Destination{
+					{Name: "variant-1", URL: "https://a.com", Weight: 70},
+					{Name: "variant-2", URL: "https://b.com", Weight: 30},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "should reject weighted split without weights",
+			args: args{split: &links.Split{Destinations: []links.Destination{
+				{URL: "https://a.com"}, {URL: "https://b.com"}}}},
+			wantErr: true,
+		},
+		{
+			name: "should reject unsupported rotation",
+			args: args{split: &links.Split{Rotation: "random", Destinations: []links.Destination{
+				{URL: "https://a.com", Weight: 1}}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeSplit(tt.args.split)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("normalizeSplit() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if !tt.wantErr {
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestShortener_pickDestination(t *testing.T) {
+	type args struct {
+		link   *links.Link
+		pinned string
+	}
+
+	destinations := []links.Destination{
+		{Name: "a", URL: "https://a.com", Weight: 0},
+		{Name: "b", URL: "https://b.com", Weight: 1},
+		{Name: "c", URL: "https://c.com", Weight: 0},
+	}
+
+	linksRepository := linkmocks.Repository{}
+	linksRepository.On("NextRotation", mock.Anything, 1).Return(3, nil)
+
+	tests := []struct {
+		name string
+		args args
+		want string
+	}{
+		{
+			name: "should pick destination by weight",
+			args: args{link: &links.Link{
+				ID: 1, Options: links.Options{Split: &links.Split{Rotation: links.RotationWeighted, Destinations: destinations}}}},
+			want: "b",
+		},
+		{
+			name: "should pick destinations one by one",
+			args: args{link: &links.Link{
+				ID: 1, Options: links.Options{Split: &links.Split{Rotation: links.RotationRoundRobin, Destinations: destinations}}}},
+			want: "c",
+		},
+		{
+			name: "should keep pinned destination of sticky split",
+			args: args{
+				link: &links.Link{
+					ID: 1,
+					Options: links.Options{Split: &links.Split{
+						Rotation: links.RotationWeighted, Sticky: true, Destinations: destinations}}},
+				pinned: "a",
+			},
+			want: "a",
+		},
+		{
+			name: "should ignore pinned destination that does not exist anymore",
+			args: args{
+				link: &links.Link{
+					ID: 1,
+					Options: links.Options{Split: &links.Split{
+						Rotation: links.RotationWeighted, Sticky: true, Destinations: destinations}}},
+				pinned: "d",
+			},
+			want: "b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := Shortener{
+				linksRepository: &linksRepository,
+			}
+
+			got, err := s.pickDestination(context.TODO(), tt.args.link, tt.args.pinned)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got.Name)
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/magmel48/go-web/internal/config"
+	"github.com/magmel48/go-web/internal/db/links"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrWrongTrust is using for notifying admins about unknown trust override.
+var ErrWrongTrust = errors.New("wrong trust override")
+
+// SetTrustOverride replaces trust policy decision for the link, it is available to admins only.
+func (s Shortener) SetTrustOverride(ctx context.Context, shortID string, trust links.Trust) error {
+	switch trust {
+	case links.TrustDefault, links.TrustTrusted, links.TrustUntrusted:
+	default:
+		return fmt.Errorf("%w: %q", ErrWrongTrust, trust)
+	}
+
+	link, err := s.findLink(ctx, shortID)
+	if link == nil {
+		return err
+	}
+
+	log.Printf("trust override of link %s is set to %q", shortID, trust)
+
+	return s.linksRepository.UpdateTrustOverride(ctx, link.ID, trust)
+}
+
+// isTrusted decides if the client can be redirected to destination of the link without a warning.
+// The link is trusted if the destination domain is trusted or the link and its owner are established enough.
+func (s Shortener) isTrusted(ctx context.Context, link *links.Link, destination string) bool {
+	trusted, reason := s.trustDecision(ctx, link, destination)
+	if reason != "" {
+		log.Printf("link %s is trusted: %t (%s)", link.ShortID, trusted, reason)
+	}
+
+	return trusted
+}
+
+// trustDecision returns trust decision for the link and the reason of it,
+// the reason is empty if there is no trust policy configured.
+func (s Shortener) trustDecision(ctx context.Context, link *links.Link, destination string) (bool, string) {
+	switch link.TrustOverride {
+	case links.TrustTrusted:
+		return true, "admin override"
+	case links.TrustUntrusted:
+		return false, "admin override"
+	}
+
+	if len(config.TrustedDomains) == 0 && config.TrustMinLinkAge == 0 && config.TrustMinOwnerAge == 0 {
+		return true, ""
+	}
+
+	if isTrustedDomain(destination, config.TrustedDomains) {
+		return true, "trusted domain"
+	}
+
+	if config.TrustMinLinkAge == 0 && config.TrustMinOwnerAge == 0 {
+		return false, "untrusted domain"
+	}
+
+	if time.Since(link.CreatedAt) < config.TrustMinLinkAge {
+		return false, "new link"
+	}
+
+	// links are cheap to make, so the owner is judged by the age of their first link and their account
+	if config.TrustMinOwnerAge > 0 {
+		if link.OwnerID == "" {
+			return false, "unknown owner"
+		}
+
+		owner, err := s.userLinksRepository.FindOwner(ctx, link.OwnerID)
+		if err != nil {
+			log.Println("cannot find link owner", err)
+			return false, "unknown owner"
+		}
+
+		if !owner.Registered {
+			return false, "unregistered owner"
+		}
+
+		if owner.FirstLinkAt == nil || time.Since(*owner.FirstLinkAt) < config.TrustMinOwnerAge {
+			return false, "new owner"
+		}
+	}
+
+	return true, "established link"
+}
+
+// isTrustedDomain checks if destination host is one of trusted domains or their subdomain.
+func isTrustedDomain(destination string, trustedDomains []string) bool {
+	parsed, err := url.Parse(destination)
+	if err != nil {
+		return false
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	for _, domain := range trustedDomains {
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,115 @@
+package shortener
+
+import (
+	"context"
+	"github.com/magmel48/go-web/internal/config"
+	"github.com/magmel48/go-web/internal/db/links"
+	"github.com/magmel48/go-web/internal/db/userlinks"
+	userlinkmocks "github.com/magmel48/go-web/internal/db/userlinks/mocks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"testing"
+	"time"
+)
+
+func TestShortener_trustDecision(t *testing.T) {
+	defer func() {
+		config.TrustedDomains = nil
+		config.TrustMinLinkAge = 0
+		config.TrustMinOwnerAge = 0
+	}()
+
+	monthAgo := time.Now().Add(-30 * 24 * time.Hour)
+	userLinksRepository := userlinkmocks.Repository{}
+	userLinksRepository.On("FindOwner", mock.Anything, "new_user").Return(
+		&userlinks.Owner{FirstLinkAt: &monthAgo}, nil)
+	userLinksRepository.On("FindOwner", mock.Anything, "registered_user").Return(
+		&userlinks.Owner{FirstLinkAt: &monthAgo, Registered: true}, nil)
+
+	oldLink := &links.Link{ID: 2, OwnerID: "registered_user", CreatedAt: time.Now().Add(-48 * time.Hour)}
+
+	tests := []struct {
+		name        string
+		domains     []string
+		minLinkAge  time.Duration
+		minOwnerAge time.Duration
+		link        *links.Link
+		destination string
+		want        bool
+	}{
+		{
+			name:        "should trust everything without policy",
+			link:        &links.Link{ID: 1, CreatedAt: time.Now()},
+			destination: "https://evil.com",
+			want:        true,
+		},
+		{
+			name:        "should follow admin override",
+			domains:     []string{"example.com"},
+			link:        &links.Link{ID: 1, TrustOverride: links.TrustUntrusted},
+			destination: "https://example.com",
+			want:        false,
+		},
+		{
+			name:        "should trust subdomain of trusted domain",
+			domains:     []string{"example.com"},
+			link:        &links.Link{ID: 1, CreatedAt: time.Now()},
+			destination: "https://docs.Example.com/guide",
+			want:        true,
+		},
+		{
+			name:        "should not trust other domain by allowlist only",
+			domains:     []string{"example.com"},
+			link:        oldLink,
+			destination: "https://notexample.com",
+			want:        false,
+		},
+		{
+			name:        "should not trust new link",
+			minLinkAge:  24 * time.Hour,
+			link:        &links.Link{ID: 2, CreatedAt: time.Now()},
+			destination: "https://evil.com",
+			want:        false,
+		},
+		{
+			name:        "should not trust owner without account",
+			minOwnerAge: 7 * 24 * time.Hour,
+			link:        &links.Link{ID: 1, OwnerID: "new_user", CreatedAt: time.Now()},
+			destination: "https://evil.com",
+			want:        false,
+		},
+		{
+			name:        "should not trust new owner",
+			minOwnerAge: 60 * 24 * time.Hour,
+			link:        oldLink,
+			destination: "https://evil.com",
+			want:        false,
+		},
+		{
+			name:        "should not trust link without owner",
+			minOwnerAge: 7 * 24 * time.Hour,
+			link:        &links.Link{ID: 3, CreatedAt: time.Now().Add(-48 * time.Hour)},
+			destination: "https://evil.com",
+			want:        false,
+		},
+		{
+			name:        "should trust established link",
+			minLinkAge:  24 * time.Hour,
+			minOwnerAge: 7 * 24 * time.Hour,
+			link:        oldLink,
+			destination: "https://evil.com",
+			want:        true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.TrustedDomains = tt.domains
+			config.TrustMinLinkAge = tt.minLinkAge
+			config.TrustMinOwnerAge = tt.minOwnerAge
+
+			s := Shortener{userLinksRepository: &userLinksRepository}
+			assert.Equal(t, tt.want, s.isTrusted(context.TODO(), tt.link, tt.destination))
+		})
+	}
+}
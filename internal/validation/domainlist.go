@@ -0,0 +1,203 @@
+package validation
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// CodeBlockedDomain is code of the rule rejecting domains from the blocklist.
+const CodeBlockedDomain = "blocked_domain"
+
+// hostsFileNames are special names of hosts files that are not real domains.
+var hostsFileNames = map[string]bool{
+	"localhost": true, "localhost.localdomain": true, "local": true, "broadcasthost": true,
+	"ip6-localhost": true, "ip6-loopback": true,
+}
+
+// DomainList is a set of domains loaded from a file. Every line of the file is either a domain or a hosts file entry
+// ("0.0.0.0 example.com"), "*.example.com" matches all subdomains of example.com, "#" starts a comment.
+// The list is safe for concurrent use and can be reloaded while in use.
+type DomainList struct {
+	path string
+
+	mu        sync.RWMutex
+	modTime   time.Time
+	domains   map[string]bool
+	wildcards map[string]bool
+}
+
+// LoadDomainList loads domain list from specified file.
+func LoadDomainList(path string) (*DomainList, error) {
+	list := &DomainList{path: path}
+	if err := list.Reload(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// Reload reads the file of the list again.
+func (list *DomainList) Reload() error {
+	file, err := os.Open(list.path)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := file.Close()
+		if err != nil {
+			log.Println("domain list close error", err)
+		}
+	}()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	domains, wildcards, err := parseDomainList(file)
+	if err != nil {
+		return err
+	}
+
+	list.mu.Lock()
+	defer list.mu.Unlock()
+
+	list.modTime = info.ModTime()
+	list.domains = domains
+	list.wildcards = wildcards
+
+	return nil
+}
+
+// ReloadIfChanged reloads the list if its file was modified since the last load.
+func (list *DomainList) ReloadIfChanged() (bool, error) {
+	info, err := os.Stat(list.path)
+	if err != nil {
+		return false, err
+	}
+
+	list.mu.RLock()
+	changed := !info.ModTime().Equal(list.modTime)
+	list.mu.RUnlock()
+
+	if !changed {
+		return false, nil
+	}
+
+	return true, list.Reload()
+}
+
+// Contains checks if host is in the list directly or as a subdomain of a wildcard entry.
+func (list *DomainList) Contains(host string) bool {
+	if list == nil {
+		return false
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	list.mu.RLock()
+	defer list.mu.RUnlock()
+
+	if list.domains[host] {
+		return true
+	}
+
+	for i := strings.Index(host, "."); i >= 0; i = strings.Index(host, ".") {
+		host = host[i+1:]
+		if list.wildcards[host] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseDomainList reads domains and wildcard parent domains from plain domain list or hosts file.
+func parseDomainList(r io.Reader) (map[string]bool, map[string]bool, error) {
+	domains := make(map[string]bool)
+	wildcards := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		// hosts file entries start with an address
+		if net.ParseIP(fields[0]) != nil {
+			fields = fields[1:]
+		}
+
+		for _, field := range fields {
+			domain := strings.TrimSuffix(strings.ToLower(field), ".")
+			switch {
+			case hostsFileNames[domain]:
+			case strings.HasPrefix(domain, "*."):
+				wildcards[domain[2:]] = true
+			case domain != "":
+				domains[domain] = true
+			}
+		}
+	}
+
+	return domains, wildcards, scanner.Err()
+}
+
+// DomainListValidator rejects URLs with domains from the blocklist unless they are in the allowlist too.
+// Both lists are optional.
+func DomainListValidator(blocklist *DomainList, allowlist *DomainList) Validator {
+	return ValidatorFunc(func(destination *url.URL) error {
+		host := destination.Hostname()
+		if blocklist.Contains(host) && !allowlist.Contains(host) {
+			return &Error{Code: CodeBlockedDomain, Reason: "domain " + host + " is blocked"}
+		}
+
+		return nil
+	})
+}
+
+// WatchDomainLists reloads lists when their files change or the process receives SIGHUP until ctx is done.
+func WatchDomainLists(ctx context.Context, interval time.Duration, lists ...*DomainList) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			for _, list := range lists {
+				if err := list.Reload(); err != nil {
+					log.Println("domain list reload error", list.path, err)
+				}
+			}
+		case <-ticker.C:
+			for _, list := range lists {
+				if _, err := list.ReloadIfChanged(); err != nil {
+					log.Println("domain list reload error", list.path, err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package validation
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDomainList_Contains(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	content := `# hosts file
+0.0.0.0 tracker.com ads.tracker.com
+127.0.0.1 localhost
+::1 ip6-localhost
+*.phishing.net
+Malware.org.  # trailing dot and case
+`
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+
+	list, err := LoadDomainList(path)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{host: "tracker.com", want: true},
+		{host: "ads.tracker.com", want: true},
+		{host: "cdn.tracker.com", want: false},
+		{host: "login.phishing.net", want: true},
+		{host: "a.b.phishing.net", want: true},
+		{host: "phishing.net", want: false},
+		{host: "MALWARE.org", want: true},
+		{host: "localhost", want: false},
+		{host: "example.com", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			assert.Equal(t, tt.want, list.Contains(tt.host))
+		})
+	}
+}
+
+func TestDomainList_ReloadIfChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("old.com\n"), 0600))
+
+	list, err := LoadDomainList(path)
+	assert.NoError(t, err)
+
+	changed, err := list.ReloadIfChanged()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	assert.NoError(t, os.WriteFile(path, []byte("new.com\n"), 0600))
+	later := time.Now().Add(time.Minute)
+	assert.NoError(t, os.Chtimes(path, later, later))
+
+	changed, err = list.ReloadIfChanged()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.False(t, list.Contains("old.com"))
+	assert.True(t, list.Contains("new.com"))
+}
+
+func TestDomainListValidator(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "block.txt"), []byte("*.example.com\n"), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "allow.txt"), []byte("docs.example.com\n"), 0600))
+
+	blocklist, err := LoadDomainList(filepath.Join(dir, "block.txt"))
+	assert.NoError(t, err)
+	allowlist, err := LoadDomainList(filepath.Join(dir, "allow.txt"))
+	assert.NoError(t, err)
+
+	validator := DomainListValidator(blocklist, allowlist)
+
+	blocked, _ := url.Parse("https://shop.example.com/")
+	assert.ErrorIs(t, validator.Validate(blocked), ErrInvalidURL)
+
+	allowed, _ := url.Parse("https://docs.example.com/")
+	assert.NoError(t, validator.Validate(allowed))
+}
@@ -0,0 +1,213 @@
+// Package validation checks if URLs can be used as destinations of short links.
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"github.com/magmel48/go-web/internal/canonical"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// ErrInvalidURL is matched by every validation error, so clients can check them without knowing the rule.
+var ErrInvalidURL = errors.New("invalid url")
+
+// Codes of validation rules, they are returned to API clients as is.
+const (
+	CodeMalformedURL      = "malformed_url"
+	CodeUnsupportedScheme = "unsupported_scheme"
+	CodeSelfLoop          = "self_loop"
+	CodeOtherShortener    = "other_shortener"
+	CodePrivateAddress    = "private_address"
+	CodeTooLong           = "url_too_long"
+	CodeHomograph         = "homograph"
+)
+
+// Error is a violation of a validation rule.
+type Error struct {
+	// Code identifies the violated rule.
+	Code   string
+	Reason string
+}
+
+// Error returns the reason of violation.
+func (e *Error) Error() string {
+	return e.Reason
+}
+
+// Is makes every validation error match ErrInvalidURL.
+func (e *Error) Is(target error) bool {
+	return target == ErrInvalidURL
+}
+
+// Validator checks if a URL can be used as a link destination.
+type Validator interface {
+	Validate(destination *url.URL) error
+}
+
+// ValidatorFunc is an adapter to use ordinary functions as validators.
+type ValidatorFunc func(destination *url.URL) error
+
+// Validate calls f(destination).
+func (f ValidatorFunc) Validate(destination *url.URL) error {
+	return f(destination)
+}
+
+// Chain runs validators one by one and stops on the first violation.
+type Chain []Validator
+
+// Validate runs every validator of the chain on destination.
+func (chain Chain) Validate(destination *url.URL) error {
+	for _, validator := range chain {
+		if err := validator.Validate(destination); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ValidateURL parses raw URL and runs the chain on it. Internationalized host is converted into punycode first,
+// so validators can compare it with ASCII domains.
+func (chain Chain) ValidateURL(rawURL string) error {
+	destination, err := url.ParseRequestURI(rawURL)
+	if err != nil {
+		return &Error{Code: CodeMalformedURL, Reason: "cannot parse url"}
+	}
+
+	if host := destination.Hostname(); host != "" {
+		asciiHost, err := canonical.HostToASCII(host)
+		if err != nil {
+			return &Error{Code: CodeMalformedURL, Reason: "cannot encode internationalized host"}
+		}
+
+		if port := destination.Port(); port != "" {
+			asciiHost = net.JoinHostPort(asciiHost, port)
+		} else if strings.Contains(asciiHost, ":") {
+			asciiHost = "[" + asciiHost + "]"
+		}
+
+		destination.Host = asciiHost
+	}
+
+	return chain.Validate(destination)
+}
+
+// MaxLengthValidator rejects URLs longer than specified number of characters, zero means no limit.
+func MaxLengthValidator(maxLength int) Validator {
+	return ValidatorFunc(func(destination *url.URL) error {
+		if maxLength > 0 && len(destination.String()) > maxLength {
+			return &Error{Code: CodeTooLong, Reason: fmt.Sprintf("url is longer than %d characters", maxLength)}
+		}
+
+		return nil
+	})
+}
+
+// DefaultSchemes are URL schemes allowed by SchemeValidator if nothing is specified.
+var DefaultSchemes = []string{"http", "https"}
+
+// SchemeValidator allows only specified URL schemes, e.g. to reject javascript: or file: URLs.
+func SchemeValidator(schemes []string) Validator {
+	if len(schemes) == 0 {
+		schemes = DefaultSchemes
+	}
+
+	allowed := make(map[string]bool, len(schemes))
+	for _, scheme := range schemes {
+		allowed[strings.ToLower(scheme)] = true
+	}
+
+	return ValidatorFunc(func(destination *url.URL) error {
+		scheme := strings.ToLower(destination.Scheme)
+		if !allowed[scheme] {
+			return &Error{Code: CodeUnsupportedScheme, Reason: fmt.Sprintf("scheme %q is not allowed", scheme)}
+		}
+
+		if (scheme == "http" || scheme == "https") && destination.Host == "" {
+			return &Error{Code: CodeMalformedURL, Reason: "url has no host"}
+		}
+
+		return nil
+	})
+}
+
+// SelfLoopValidator rejects URLs leading to the shortener itself, they would redirect in a loop.
+func SelfLoopValidator(baseURL string) Validator {
+	base, err := url.Parse(baseURL)
+	ownHost := ""
+	if err == nil {
+		ownHost = strings.ToLower(base.Hostname())
+	}
+
+	return ValidatorFunc(func(destination *url.URL) error {
+		if ownHost != "" && strings.ToLower(destination.Hostname()) == ownHost {
+			return &Error{Code: CodeSelfLoop, Reason: "url leads to this shortener"}
+		}
+
+		return nil
+	})
+}
+
+// ShortenerValidator rejects URLs of other shorteners (and their subdomains), they hide real destinations.
+func ShortenerValidator(hosts []string) Validator {
+	return ValidatorFunc(func(destination *url.URL) error {
+		if host := matchHost(destination.Hostname(), hosts); host != "" {
+			return &Error{Code: CodeOtherShortener, Reason: fmt.Sprintf("links of %s cannot be shortened", host)}
+		}
+
+		return nil
+	})
+}
+
+// PrivateAddressValidator rejects URLs with literal loopback, private or link-local IP addresses.
+func PrivateAddressValidator() Validator {
+	return ValidatorFunc(func(destination *url.URL) error {
+		host := strings.ToLower(destination.Hostname())
+		if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+			return &Error{Code: CodePrivateAddress, Reason: "url leads to a private network"}
+		}
+
+		ip := net.ParseIP(host)
+		if ip == nil {
+			return nil
+		}
+
+		if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+			ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+			return &Error{Code: CodePrivateAddress, Reason: "url leads to a private network"}
+		}
+
+		return nil
+	})
+}
+
+// HomographValidator rejects URLs with host labels mixing letters of different scripts, e.g. Latin "a"
+// with Cyrillic "а", they are likely to imitate other domains.
+func HomographValidator() Validator {
+	return ValidatorFunc(func(destination *url.URL) error {
+		labels := canonical.MixedScriptLabels(canonical.HostToUnicode(destination.Hostname()))
+		if len(labels) > 0 {
+			return &Error{
+				Code:   CodeHomograph,
+				Reason: fmt.Sprintf("host label %q mixes letters of different scripts", labels[0]),
+			}
+		}
+
+		return nil
+	})
+}
+
+// matchHost returns one of hosts that is equal to host or is its parent domain, empty string if nothing matches.
+func matchHost(host string, hosts []string) string {
+	host = strings.ToLower(host)
+	for _, candidate := range hosts {
+		candidate = strings.ToLower(candidate)
+		if host == candidate || strings.HasSuffix(host, "."+candidate) {
+			return candidate
+		}
+	}
+
+	return ""
+}
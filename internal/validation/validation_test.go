@@ -0,0 +1,59 @@
+package validation
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestChain_ValidateURL(t *testing.T) {
+	chain := Chain{
+		MaxLengthValidator(64),
+		SchemeValidator(nil),
+		SelfLoopValidator("http://short.ly:8080"),
+		ShortenerValidator([]string{"bit.ly"}),
+		PrivateAddressValidator(),
+		HomographValidator(),
+	}
+
+	tests := []struct {
+		name     string
+		url      string
+		wantCode string
+	}{
+		{name: "should allow public web url", url: "https://example.com/page", wantCode: ""},
+		{
+			name:     "should reject too long url",
+			url:      "https://example.com/?q=" + strings.Repeat("a", 64),
+			wantCode: CodeTooLong,
+		},
+		{name: "should reject malformed url", url: "example.com", wantCode: CodeMalformedURL},
+		{name: "should reject script url", url: "javascript:alert(1)", wantCode: CodeUnsupportedScheme},
+		{name: "should reject file url", url: "file:///etc/passwd", wantCode: CodeUnsupportedScheme},
+		{name: "should reject url without host", url: "http:///path", wantCode: CodeMalformedURL},
+		{name: "should reject self loop", url: "http://SHORT.ly/1", wantCode: CodeSelfLoop},
+		{name: "should reject other shortener", url: "https://www.bit.ly/abc", wantCode: CodeOtherShortener},
+		{name: "should reject loopback address", url: "http://127.0.0.1:6060/debug", wantCode: CodePrivateAddress},
+		{name: "should reject private address", url: "http://[fd00::1]/", wantCode: CodePrivateAddress},
+		{name: "should reject localhost", url: "http://localhost/", wantCode: CodePrivateAddress},
+		{name: "should allow internationalized host", url: "https://пример.рф/путь", wantCode: ""},
+		{name: "should reject mixed script host", url: "https://аpple.com/", wantCode: CodeHomograph},
+		{name: "should reject mixed script punycode host", url: "https://xn--pple-43d.com/", wantCode: CodeHomograph},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := chain.ValidateURL(tt.url)
+			if tt.wantCode == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			var validationErr *Error
+			assert.True(t, errors.As(err, &validationErr))
+			assert.Equal(t, tt.wantCode, validationErr.Code)
+			assert.ErrorIs(t, err, ErrInvalidURL)
+		})
+	}
+}